@@ -1,7 +1,10 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -12,17 +15,83 @@ type Config struct {
 	Database    Database
 	Server      Server
 	Schedule    Schedule
+	WebSocket   WebSocket
+	Features    Features
+	Limits      Limits
+	Cookie      Cookie
+	Admin       Admin
+}
+
+type Features struct {
+	Phases bool `yaml:"phases"`
+}
+
+// Enabled maps each optional feature name to whether it is turned on.
+func (f Features) Enabled() map[string]bool {
+	return map[string]bool{
+		"phases": f.Phases,
+	}
+}
+
+// Limits caps how much content a retrospective can hold, 0 means no limit.
+type Limits struct {
+	MaxQuestions          int `yaml:"max_questions"`
+	MaxAnswersPerQuestion int `yaml:"max_answers_per_question"`
+}
+
+// Cookie holds the attributes of the cookies set by the API. Browsers only
+// send Secure cookies over HTTPS, and only accept SameSite none on them.
+type Cookie struct {
+	Domain string `yaml:"domain"`
+	Path   string `yaml:"path"`
+	Secure bool   `yaml:"secure"`
+	// lax, strict or none
+	SameSite string `yaml:"same_site"`
+	// Upper bound of the lifetime of the retrospective cookie, which
+	// otherwise expires with the retrospective. 0 for no bound
+	MaxAgeHours int `yaml:"max_age_hours"`
+}
+
+// Admin protects the operator endpoints under /api/admin, which are only
+// served when a token is set. Requests send it in an X-Admin-Token header.
+type Admin struct {
+	Token string `yaml:"token"`
+}
+
+type WebSocket struct {
+	WriteTimeoutSeconds int `yaml:"write_timeout_seconds"`
+	IdleTimeoutSeconds  int `yaml:"idle_timeout_seconds"`
+	PingIntervalSeconds int `yaml:"ping_interval_seconds"`
+	// How long broadcast messages are kept for reconnecting clients
+	EventRetentionMinutes int `yaml:"event_retention_minutes"`
+	// Largest message accepted from a client, 0 for no limit
+	MaxMessageBytes int64 `yaml:"max_message_bytes"`
 }
 
 type Schedule struct {
-	CleanUpDays     int `yaml:"clean_up_days"`
-	IntervalMinutes int `yaml:"interval_minutes"`
+	CleanUpDays       int `yaml:"clean_up_days"`
+	IntervalMinutes   int `yaml:"interval_minutes"`
+	EmptyGraceMinutes int `yaml:"empty_grace_minutes"`
+	// Hours before deletion when subscribers start being warned, 0 disables it
+	DeletionNoticeHours int `yaml:"deletion_notice_hours"`
+	// Only log the retrospectives the clean up would delete
+	DryRun bool `yaml:"dry_run"`
+	// Also run the clean up once on startup, after the delay plus a random
+	// part of the jitter so replicas restarted together don't run at once
+	RunOnStart         bool `yaml:"run_on_start"`
+	StartDelaySeconds  int  `yaml:"start_delay_seconds"`
+	StartJitterSeconds int  `yaml:"start_jitter_seconds"`
 }
 
 type Server struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	WithCors bool   `yaml:"with_cors"`
+	Host           string `yaml:"host"`
+	Port           int    `yaml:"port"`
+	WithCors       bool   `yaml:"with_cors"`
+	MaxConnections int    `yaml:"max_connections"`
+	// How long a response is answered again for a retried Idempotency-Key
+	IdempotencyTTLMinutes int `yaml:"idempotency_ttl_minutes"`
+	// Largest request body accepted by the API, 0 for no limit
+	MaxBodyBytes int64 `yaml:"max_body_bytes"`
 }
 
 type Database struct {
@@ -30,26 +99,127 @@ type Database struct {
 	Address string `yaml:"address"`
 	Cache   string `yaml:"cache"`
 	MaxConn int    `yaml:"max_conn"`
-	Schema  string `yaml:"schema"`
+	// Directory of the SQL migrations, empty uses the built-in ones
+	Migrations string `yaml:"migrations"`
+	// SQLite open mode, memory keeps a named database in memory. Empty opens
+	// the file at the address
+	Mode string `yaml:"mode"`
+	// SQLite journal mode, such as WAL. Empty keeps the SQLite default
+	JournalMode string `yaml:"journal_mode"`
+	// How long a connection waits for a locked database before failing
+	BusyTimeoutMs int `yaml:"busy_timeout_ms"`
+	// Upper bound of each database call of the service, 0 disables it
+	QueryTimeoutMs int `yaml:"query_timeout_ms"`
 }
 
-var config *Config
+// The current configuration, swapped as a whole when it is reloaded
+var config atomic.Pointer[Config]
 
+// Load reads the configuration file over the defaults, then applies the
+// SIMPLE_RETRO_ environment overrides. A missing file leaves the defaults.
 func Load(filename string) (*Config, error) {
-	data, err := os.ReadFile(filename)
+	conf, err := read(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	var conf Config
-	if err := yaml.Unmarshal(data, &conf); err != nil {
+	config.Store(conf)
+	return conf, nil
+}
+
+// Reload reads the configuration file again, and only replaces the current
+// configuration when the new one is valid. Settings only read on startup,
+// such as the port or the database, still need a restart.
+func Reload(filename string) (*Config, error) {
+	conf, err := read(filename)
+	if err != nil {
+		return nil, err
+	}
+	if err := conf.Validate(); err != nil {
+		return nil, err
+	}
+
+	config.Store(conf)
+	return conf, nil
+}
+
+func read(filename string) (*Config, error) {
+	conf := Default()
+
+	data, err := os.ReadFile(filename)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return nil, err
 	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, conf); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(conf, os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	return conf, nil
+}
+
+// Validate checks the values the service can't run without, and returns
+// every problem found at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port >= 1 && c.Server.Port <= 65535, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	check(c.Server.MaxConnections >= 0, "server.max_connections cannot be negative")
+	check(c.Server.IdempotencyTTLMinutes >= 0, "server.idempotency_ttl_minutes cannot be negative")
+	check(c.Server.MaxBodyBytes >= 0, "server.max_body_bytes cannot be negative")
+
+	check(c.Database.Type != "", "database.type is required")
+	check(c.Database.Address != "", "database.address is required")
+	check(c.Database.MaxConn >= 0, "database.max_conn cannot be negative")
+	check(c.Database.BusyTimeoutMs >= 0, "database.busy_timeout_ms cannot be negative")
+	check(c.Database.QueryTimeoutMs >= 0, "database.query_timeout_ms cannot be negative")
+	if c.Database.Migrations != "" {
+		info, err := os.Stat(c.Database.Migrations)
+		check(err == nil, "database.migrations: %w", err)
+		check(err != nil || info.IsDir(), "database.migrations must be a directory")
+	}
+
+	check(c.Schedule.IntervalMinutes > 0, "schedule.interval_minutes must be positive, got %d", c.Schedule.IntervalMinutes)
+	check(c.Schedule.CleanUpDays > 0, "schedule.clean_up_days must be positive, got %d", c.Schedule.CleanUpDays)
+	check(c.Schedule.EmptyGraceMinutes >= 0, "schedule.empty_grace_minutes cannot be negative")
+	check(c.Schedule.DeletionNoticeHours >= 0, "schedule.deletion_notice_hours cannot be negative")
+	check(c.Schedule.StartDelaySeconds >= 0, "schedule.start_delay_seconds cannot be negative")
+	check(c.Schedule.StartJitterSeconds >= 0, "schedule.start_jitter_seconds cannot be negative")
+
+	switch c.Cookie.SameSite {
+	case "lax", "strict":
+	case "none":
+		check(c.Cookie.Secure, "cookie.same_site none requires cookie.secure")
+	default:
+		check(false, "cookie.same_site must be lax, strict or none, got %q", c.Cookie.SameSite)
+	}
+
+	check(c.Cookie.MaxAgeHours >= 0, "cookie.max_age_hours cannot be negative")
+
+	check(c.WebSocket.WriteTimeoutSeconds >= 0, "websocket.write_timeout_seconds cannot be negative")
+	check(c.WebSocket.IdleTimeoutSeconds >= 0, "websocket.idle_timeout_seconds cannot be negative")
+	check(c.WebSocket.PingIntervalSeconds >= 0, "websocket.ping_interval_seconds cannot be negative")
+	check(c.WebSocket.EventRetentionMinutes >= 0, "websocket.event_retention_minutes cannot be negative")
+	check(c.WebSocket.MaxMessageBytes >= 0, "websocket.max_message_bytes cannot be negative")
+
+	check(c.Limits.MaxQuestions >= 0, "limits.max_questions cannot be negative")
+	check(c.Limits.MaxAnswersPerQuestion >= 0, "limits.max_answers_per_question cannot be negative")
+
+	check(c.Admin.Token == "" || len(c.Admin.Token) >= 16, "admin.token must be at least 16 characters")
 
-	config = &conf
-	return config, nil
+	return errors.Join(errs...)
 }
 
 func Get() *Config {
-	return config
+	return config.Load()
 }
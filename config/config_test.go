@@ -0,0 +1,291 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// validConfig returns a configuration passing every check.
+func validConfig() *Config {
+	return &Config{
+		Server: Server{Port: 8080},
+		Database: Database{
+			Type:    "file:",
+			Address: ":memory:",
+		},
+		Schedule: Schedule{CleanUpDays: 1, IntervalMinutes: 1},
+		Cookie:   Cookie{SameSite: "lax"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name        string
+		change      func(c *Config)
+		expectedErr string
+	}{
+		{
+			name:        "missing port",
+			change:      func(c *Config) { c.Server.Port = 0 },
+			expectedErr: "server.port must be between 1 and 65535, got 0",
+		},
+		{
+			name:        "port out of range",
+			change:      func(c *Config) { c.Server.Port = 70000 },
+			expectedErr: "server.port must be between 1 and 65535, got 70000",
+		},
+		{
+			name:        "negative max connections",
+			change:      func(c *Config) { c.Server.MaxConnections = -1 },
+			expectedErr: "server.max_connections cannot be negative",
+		},
+		{
+			name:        "negative idempotency ttl",
+			change:      func(c *Config) { c.Server.IdempotencyTTLMinutes = -1 },
+			expectedErr: "server.idempotency_ttl_minutes cannot be negative",
+		},
+		{
+			name:        "negative max body bytes",
+			change:      func(c *Config) { c.Server.MaxBodyBytes = -1 },
+			expectedErr: "server.max_body_bytes cannot be negative",
+		},
+		{
+			name:        "short admin token",
+			change:      func(c *Config) { c.Admin.Token = "secret" },
+			expectedErr: "admin.token must be at least 16 characters",
+		},
+		{
+			name:        "missing database type",
+			change:      func(c *Config) { c.Database.Type = "" },
+			expectedErr: "database.type is required",
+		},
+		{
+			name:        "missing database address",
+			change:      func(c *Config) { c.Database.Address = "" },
+			expectedErr: "database.address is required",
+		},
+		{
+			name:        "negative max conn",
+			change:      func(c *Config) { c.Database.MaxConn = -1 },
+			expectedErr: "database.max_conn cannot be negative",
+		},
+		{
+			name:        "negative busy timeout",
+			change:      func(c *Config) { c.Database.BusyTimeoutMs = -1 },
+			expectedErr: "database.busy_timeout_ms cannot be negative",
+		},
+		{
+			name:        "negative query timeout",
+			change:      func(c *Config) { c.Database.QueryTimeoutMs = -1 },
+			expectedErr: "database.query_timeout_ms cannot be negative",
+		},
+		{
+			name:        "migrations directory not found",
+			change:      func(c *Config) { c.Database.Migrations = "missing" },
+			expectedErr: "database.migrations: stat missing: no such file or directory",
+		},
+		{
+			name:        "migrations not a directory",
+			change:      func(c *Config) { c.Database.Migrations = "config.go" },
+			expectedErr: "database.migrations must be a directory",
+		},
+		{
+			name:        "zero schedule interval",
+			change:      func(c *Config) { c.Schedule.IntervalMinutes = 0 },
+			expectedErr: "schedule.interval_minutes must be positive, got 0",
+		},
+		{
+			name:        "zero clean up days",
+			change:      func(c *Config) { c.Schedule.CleanUpDays = 0 },
+			expectedErr: "schedule.clean_up_days must be positive, got 0",
+		},
+		{
+			name:        "negative empty grace",
+			change:      func(c *Config) { c.Schedule.EmptyGraceMinutes = -1 },
+			expectedErr: "schedule.empty_grace_minutes cannot be negative",
+		},
+		{
+			name:        "negative deletion notice",
+			change:      func(c *Config) { c.Schedule.DeletionNoticeHours = -1 },
+			expectedErr: "schedule.deletion_notice_hours cannot be negative",
+		},
+		{
+			name:        "negative start delay",
+			change:      func(c *Config) { c.Schedule.StartDelaySeconds = -1 },
+			expectedErr: "schedule.start_delay_seconds cannot be negative",
+		},
+		{
+			name:        "negative start jitter",
+			change:      func(c *Config) { c.Schedule.StartJitterSeconds = -1 },
+			expectedErr: "schedule.start_jitter_seconds cannot be negative",
+		},
+		{
+			name:        "negative write timeout",
+			change:      func(c *Config) { c.WebSocket.WriteTimeoutSeconds = -1 },
+			expectedErr: "websocket.write_timeout_seconds cannot be negative",
+		},
+		{
+			name:        "negative idle timeout",
+			change:      func(c *Config) { c.WebSocket.IdleTimeoutSeconds = -1 },
+			expectedErr: "websocket.idle_timeout_seconds cannot be negative",
+		},
+		{
+			name:        "negative ping interval",
+			change:      func(c *Config) { c.WebSocket.PingIntervalSeconds = -1 },
+			expectedErr: "websocket.ping_interval_seconds cannot be negative",
+		},
+		{
+			name:        "negative event retention",
+			change:      func(c *Config) { c.WebSocket.EventRetentionMinutes = -1 },
+			expectedErr: "websocket.event_retention_minutes cannot be negative",
+		},
+		{
+			name:        "negative max message size",
+			change:      func(c *Config) { c.WebSocket.MaxMessageBytes = -1 },
+			expectedErr: "websocket.max_message_bytes cannot be negative",
+		},
+		{
+			name:        "unknown same site",
+			change:      func(c *Config) { c.Cookie.SameSite = "loose" },
+			expectedErr: `cookie.same_site must be lax, strict or none, got "loose"`,
+		},
+		{
+			name:        "same site none without secure",
+			change:      func(c *Config) { c.Cookie.SameSite = "none" },
+			expectedErr: "cookie.same_site none requires cookie.secure",
+		},
+		{
+			name:        "negative cookie max age",
+			change:      func(c *Config) { c.Cookie.MaxAgeHours = -1 },
+			expectedErr: "cookie.max_age_hours cannot be negative",
+		},
+		{
+			name:        "negative question limit",
+			change:      func(c *Config) { c.Limits.MaxQuestions = -1 },
+			expectedErr: "limits.max_questions cannot be negative",
+		},
+		{
+			name:        "negative answer limit",
+			change:      func(c *Config) { c.Limits.MaxAnswersPerQuestion = -1 },
+			expectedErr: "limits.max_answers_per_question cannot be negative",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := validConfig()
+			tt.change(conf)
+
+			err := conf.Validate()
+			if assert.NotNil(t, err) {
+				assert.Equal(t, tt.expectedErr, err.Error())
+			}
+		})
+	}
+}
+
+func TestValidateValid(t *testing.T) {
+	assert.Nil(t, validConfig().Validate())
+
+	custom := validConfig()
+	custom.Database.Migrations = "../database/migrations"
+	assert.Nil(t, custom.Validate())
+
+	conf, err := Load("config.yaml")
+	assert.Nilf(t, err, "error loading config")
+	assert.Nil(t, conf.Validate(), "the default config should be valid")
+}
+
+func TestValidateListsEveryProblem(t *testing.T) {
+	conf := validConfig()
+	conf.Server.Port = 0
+	conf.Schedule.IntervalMinutes = 0
+
+	err := conf.Validate()
+	assert.EqualError(t, err, "server.port must be between 1 and 65535, got 0\n"+
+		"schedule.interval_minutes must be positive, got 0")
+}
+
+func TestLoadEnvOverrides(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filename, []byte("server:\n  port: 9000\n  host: \"file\"\ndatabase:\n  address: \"file.db\"\n"), 0o600)
+	assert.Nilf(t, err, "error writing config")
+
+	t.Setenv("SIMPLE_RETRO_SERVER_PORT", "9100")
+	t.Setenv("SIMPLE_RETRO_DATABASE_ADDRESS", "env.db")
+	t.Setenv("SIMPLE_RETRO_FEATURES_PHASES", "false")
+	t.Setenv("SIMPLE_RETRO_WEBSOCKET_IDLE_TIMEOUT_SECONDS", "")
+	t.Setenv("SIMPLE_RETRO_SERVER_MAX_BODY_BYTES", "2097152")
+	t.Setenv("SIMPLE_RETRO_WEBSOCKET_MAX_MESSAGE_BYTES", "8192")
+
+	conf, err := Load(filename)
+	assert.Nilf(t, err, "error loading config")
+
+	assert.Equal(t, 9100, conf.Server.Port, "env should win over the file")
+	assert.Equal(t, "env.db", conf.Database.Address, "env should win over the file")
+	assert.False(t, conf.Features.Phases, "env should win over the defaults")
+	assert.Equal(t, int64(2097152), conf.Server.MaxBodyBytes, "env should set int64 values")
+	assert.Equal(t, int64(8192), conf.WebSocket.MaxMessageBytes, "env should set int64 values")
+	assert.Equal(t, "file", conf.Server.Host, "the file should win over the defaults")
+	assert.Equal(t, Default().Database.MaxConn, conf.Database.MaxConn, "missing values should keep the defaults")
+	assert.Equal(t, Default().WebSocket.IdleTimeoutSeconds, conf.WebSocket.IdleTimeoutSeconds, "empty variables should be ignored")
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("SIMPLE_RETRO_NAME", "Retro")
+
+	conf, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Nilf(t, err, "a missing file should leave the defaults")
+
+	expected := Default()
+	expected.Name = "Retro"
+	assert.Equal(t, expected, conf)
+
+	assert.Equal(t, 8080, conf.Server.Port)
+	assert.Equal(t, 30, conf.Schedule.CleanUpDays)
+	assert.Equal(t, 60, conf.Schedule.IntervalMinutes)
+	assert.Equal(t, "WAL", conf.Database.JournalMode)
+	assert.Empty(t, conf.Database.Migrations, "the built-in migrations should be used")
+	assert.Nil(t, conf.Validate(), "the defaults should be valid")
+}
+
+func TestLoadMalformedFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filename, []byte("server: [port"), 0o600)
+	assert.Nilf(t, err, "error writing config")
+
+	_, err = Load(filename)
+	assert.NotNil(t, err, "malformed YAML should still fail")
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	t.Setenv("SIMPLE_RETRO_SCHEDULE_INTERVAL_MINUTES", "hourly")
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "invalid SIMPLE_RETRO_SCHEDULE_INTERVAL_MINUTES")
+}
+
+func TestReload(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(filename, []byte("schedule:\n  interval_minutes: 5\n"), 0o600)
+	assert.Nilf(t, err, "error writing config")
+
+	_, err = Load(filename)
+	assert.Nilf(t, err, "error loading config")
+
+	err = os.WriteFile(filename, []byte("schedule:\n  interval_minutes: 10\n"), 0o600)
+	assert.Nilf(t, err, "error writing config")
+	conf, err := Reload(filename)
+	assert.Nilf(t, err, "error reloading config")
+	assert.Equal(t, 10, conf.Schedule.IntervalMinutes)
+	assert.Same(t, conf, Get())
+
+	err = os.WriteFile(filename, []byte("schedule:\n  interval_minutes: 0\n"), 0o600)
+	assert.Nilf(t, err, "error writing config")
+	_, err = Reload(filename)
+	assert.EqualError(t, err, "schedule.interval_minutes must be positive, got 0")
+	assert.Same(t, conf, Get(), "an invalid config should keep the current one")
+}
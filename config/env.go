@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// ENV_PREFIX starts the name of every environment variable overriding the
+// configuration, such as SIMPLE_RETRO_SERVER_PORT for server.port.
+const ENV_PREFIX = "SIMPLE_RETRO_"
+
+// Default returns the configuration used for the values missing from both
+// the file and the environment.
+func Default() *Config {
+	return &Config{
+		Name: "Simple Retro API",
+		Server: Server{
+			Host:                  "localhost",
+			Port:                  8080,
+			MaxConnections:        5000,
+			IdempotencyTTLMinutes: 1440,
+			MaxBodyBytes:          1 << 20,
+		},
+		Database: Database{
+			Type:           "file:",
+			Address:        "database.db",
+			Cache:          "private",
+			MaxConn:        20,
+			JournalMode:    "WAL",
+			BusyTimeoutMs:  5000,
+			QueryTimeoutMs: 10000,
+		},
+		Schedule: Schedule{
+			CleanUpDays:         30,
+			IntervalMinutes:     60,
+			EmptyGraceMinutes:   1440,
+			DeletionNoticeHours: 72,
+		},
+		WebSocket: WebSocket{
+			WriteTimeoutSeconds:   10,
+			IdleTimeoutSeconds:    30,
+			PingIntervalSeconds:   15,
+			EventRetentionMinutes: 1440,
+			MaxMessageBytes:       4096,
+		},
+		Features: Features{
+			Phases: true,
+		},
+		Limits: Limits{
+			MaxQuestions:          50,
+			MaxAnswersPerQuestion: 200,
+		},
+		Cookie: Cookie{
+			Path:     "/",
+			Secure:   true,
+			SameSite: "none",
+		},
+	}
+}
+
+// applyEnv overrides the configuration with the environment variables named
+// after the YAML keys of each field. Empty variables are ignored.
+func applyEnv(conf *Config, lookup func(string) (string, bool)) error {
+	return applyEnvTo(reflect.ValueOf(conf).Elem(), ENV_PREFIX, lookup)
+}
+
+func applyEnvTo(value reflect.Value, prefix string, lookup func(string) (string, bool)) error {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name := prefix + strings.ToUpper(yamlKey(field))
+
+		if field.Type.Kind() == reflect.Struct {
+			if err := applyEnvTo(value.Field(i), name+"_", lookup); err != nil {
+				return err
+			}
+			continue
+		}
+
+		env, ok := lookup(name)
+		if !ok || env == "" {
+			continue
+		}
+
+		switch field.Type.Kind() {
+		case reflect.String:
+			value.Field(i).SetString(env)
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(env, 10, field.Type.Bits())
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			value.Field(i).SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(env)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+			value.Field(i).SetBool(b)
+		default:
+			return fmt.Errorf("%s can't be set from the environment", name)
+		}
+	}
+	return nil
+}
+
+// yamlKey returns the key of a field in the config file.
+func yamlKey(field reflect.StructField) string {
+	if key, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); key != "" {
+		return key
+	}
+	return strings.ToLower(field.Name)
+}
@@ -0,0 +1,12 @@
+package config
+
+import "go.uber.org/zap"
+
+// NewLogger builds a human readable logger in development and a JSON one,
+// suited for log aggregation, in production.
+func NewLogger(config *Config) (*zap.Logger, error) {
+	if config.Development {
+		return zap.NewDevelopment()
+	}
+	return zap.NewProduction()
+}
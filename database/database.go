@@ -0,0 +1,10 @@
+package database
+
+import "embed"
+
+// Migrations holds the SQL migrations built into the binary, in the
+// migrations directory. Each file is named <version>_<description>.sql and
+// is applied once, in version order.
+//
+//go:embed migrations/*.sql
+var Migrations embed.FS
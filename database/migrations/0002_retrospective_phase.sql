@@ -0,0 +1,6 @@
+-- Phase of the retrospective, see types/phase.go
+ALTER TABLE retrospectives ADD COLUMN phase TEXT DEFAULT 'brainstorm';
+
+-- Existing retrospectives showed every answer to everyone, which brainstorm
+-- would now hide
+UPDATE retrospectives SET phase = 'discussion';
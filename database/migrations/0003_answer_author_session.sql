@@ -0,0 +1,2 @@
+-- Session which wrote the answer, NULL for the answers written before
+ALTER TABLE answers ADD COLUMN author_session TEXT;
@@ -0,0 +1,5 @@
+-- Set once a retrospective gets a question, so the clean up of empty
+-- retrospectives spares the ones emptied afterwards
+ALTER TABLE retrospectives ADD COLUMN had_content INTEGER DEFAULT 0;
+
+UPDATE retrospectives SET had_content = 1 WHERE id IN (SELECT retrospective_id FROM questions);
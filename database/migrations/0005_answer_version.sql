@@ -0,0 +1,2 @@
+-- Bumped on every update of the answer, for optimistic locking
+ALTER TABLE answers ADD COLUMN version INTEGER DEFAULT 1;
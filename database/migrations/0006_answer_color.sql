@@ -0,0 +1,2 @@
+-- Palette color of the answer card, empty for the neutral one
+ALTER TABLE answers ADD COLUMN color TEXT DEFAULT '';
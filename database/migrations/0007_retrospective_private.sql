@@ -0,0 +1,2 @@
+-- Private retrospectives are only streamed to sessions holding their cookie
+ALTER TABLE retrospectives ADD COLUMN private INTEGER DEFAULT 0;
@@ -0,0 +1,10 @@
+-- Table for the responses of requests sent with an Idempotency-Key
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key        TEXT,
+    session    TEXT,
+    route      TEXT,
+    status     INTEGER,
+    body       BLOB,
+    created_at DATETIME,
+    PRIMARY KEY(key, session)
+);
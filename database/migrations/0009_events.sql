@@ -0,0 +1,12 @@
+-- Table for the messages broadcast to subscribers, replayed to clients
+-- reconnecting with the last seq they got
+CREATE TABLE IF NOT EXISTS events (
+    seq              INTEGER PRIMARY KEY AUTOINCREMENT,
+    retrospective_id TEXT,
+    action           TEXT,
+    type             TEXT,
+    payload          TEXT,
+    created_at       DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS events_retrospective ON events (retrospective_id, seq);
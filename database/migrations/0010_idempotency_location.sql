@@ -0,0 +1,2 @@
+-- Location header of the stored responses, replayed with them
+ALTER TABLE idempotency_keys ADD COLUMN location TEXT NOT NULL DEFAULT '';
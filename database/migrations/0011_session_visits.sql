@@ -0,0 +1,10 @@
+-- Table for the retrospectives each session visited, forgotten with them
+CREATE TABLE IF NOT EXISTS session_visits (
+    session          TEXT,
+    retrospective_id TEXT,
+    visited_at       DATETIME,
+    PRIMARY KEY(session, retrospective_id),
+    FOREIGN KEY(retrospective_id) REFERENCES retrospectives(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS session_visits_recent ON session_visits (session, visited_at);
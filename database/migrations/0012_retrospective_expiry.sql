@@ -0,0 +1,2 @@
+-- Set on creation, backfilled from created_at + clean_up_days on startup
+ALTER TABLE retrospectives ADD COLUMN expire_at DATETIME;
@@ -0,0 +1,2 @@
+-- Session the event is restricted to, NULL when every subscriber gets it
+ALTER TABLE events ADD COLUMN author_session TEXT;
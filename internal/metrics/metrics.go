@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "simple_retro"
+
+var (
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "Total of HTTP requests by route, method and status.",
+	}, []string{"route", "method", "status"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+
+	WebSocketConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Number of WebSocket connections currently open.",
+	})
+
+	WebSocketRejected = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "websocket_rejected_total",
+		Help:      "Total of WebSocket connections refused for reaching the server limit.",
+	})
+
+	CreatedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "created_total",
+		Help:      "Total of retrospectives, questions and answers created.",
+	}, []string{"type"})
+
+	Stored = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stored",
+		Help:      "Number of retrospectives, questions and answers currently stored.",
+	}, []string{"type"})
+
+	CleanUpDeleted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_deleted_total",
+		Help:      "Total of retrospectives deleted by the clean up routines.",
+	}, []string{"routine"})
+
+	CleanUpFailed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_failed_total",
+		Help:      "Total of retrospectives the clean up routines failed to delete.",
+	}, []string{"routine"})
+)
+
+func init() {
+	// Expose the series from startup instead of after the first creation
+	for _, t := range []string{"retrospective", "question", "answer"} {
+		CreatedTotal.WithLabelValues(t)
+		Stored.WithLabelValues(t)
+	}
+	for _, r := range []string{"old", "empty"} {
+		CleanUpDeleted.WithLabelValues(r)
+		CleanUpFailed.WithLabelValues(r)
+	}
+}
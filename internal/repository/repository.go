@@ -9,22 +9,73 @@ import (
 	"github.com/google/uuid"
 )
 
-type Repository interface {
+// Reader reads retrospectives and their content.
+type Reader interface {
 	GetOldRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error)
 	GetAllRetrospectives(ctx context.Context) ([]uuid.UUID, error)
+	GetEmptyRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error)
 	GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error)
+	GetRetrospectivePage(ctx context.Context, id uuid.UUID, query types.AnswersQuery) (*types.Retrospective, error)
+	GetRetrospectiveSummary(ctx context.Context, id uuid.UUID) (*types.RetrospectiveSummary, error)
+	GetRetrospectivePhase(ctx context.Context, id uuid.UUID) (string, error)
+	GetRetrospectiveStats(ctx context.Context, id uuid.UUID) (*types.RetrospectiveStats, error)
+	SearchRetrospectives(ctx context.Context, search types.RetrospectiveSearch) (*types.RetrospectiveList, error)
+	CountContent(ctx context.Context) (*types.ContentCount, error)
+	GetQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error)
+	CountQuestions(ctx context.Context) (int, error)
+	GetAnswer(ctx context.Context, id uuid.UUID) (*types.Answer, error)
+	GetAnswers(ctx context.Context, questionID uuid.UUID) ([]types.Answer, error)
+	CountAnswers(ctx context.Context, questionID uuid.UUID) (int, error)
+}
+
+// Writer applies changes to retrospectives and their content.
+type Writer interface {
 	CreateRetrospective(ctx context.Context, retro *types.Retrospective) error
 	UpdateRetrospective(ctx context.Context, retro *types.Retrospective) error
 	DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error)
+	UpdateRetrospectivePhase(ctx context.Context, retro *types.Retrospective) error
 	CreateQuestion(ctx context.Context, question *types.Question) error
+	CreateQuestions(ctx context.Context, questions []*types.Question) error
 	UpdateQuestion(ctx context.Context, question *types.Question) error
 	DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error)
+	MoveAnswersAndDeleteQuestion(ctx context.Context, question *types.Question, targetID uuid.UUID) error
 	CreateAnswer(ctx context.Context, answer *types.Answer) error
+	CreateAnswers(ctx context.Context, answers []*types.Answer) error
 	UpdateAnswer(ctx context.Context, answer *types.Answer) error
 	DeleteAnswer(ctx context.Context, answer *types.Answer) error
+	MergeAnswers(ctx context.Context, source *types.Answer, target *types.Answer) error
+	DeleteAnswersByRetrospective(ctx context.Context, clear *types.RetrospectiveClear) error
+}
+
+// Repository is the storage of retrospectives.
+type Repository interface {
+	Reader
+	Writer
+	Ping(ctx context.Context) error
+	GetIdempotentResponse(ctx context.Context, key string, since time.Time) (*types.IdempotentResponse, error)
+	ReserveIdempotencyKey(ctx context.Context, key string, route string, since time.Time) (bool, error)
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	SaveIdempotentResponse(ctx context.Context, key string, response *types.IdempotentResponse) error
+	DeleteIdempotentResponses(ctx context.Context, before time.Time) (int, error)
+	DeleteEvents(ctx context.Context, before time.Time) (int, error)
+	DuplicateRetrospective(ctx context.Context, sourceID uuid.UUID, retro *types.Retrospective) error
+	SaveVisit(ctx context.Context, retroID uuid.UUID) error
+	GetVisits(ctx context.Context, limit int) ([]types.RetrospectiveVisit, error)
+	SetRetrospectiveExpiry(ctx context.Context, id uuid.UUID, expireAt time.Time) error
+}
+
+// EventLog keeps the broadcast messages so reconnecting clients can get the
+// ones they missed.
+type EventLog interface {
+	AppendEvent(ctx context.Context, retroID uuid.UUID, message *types.WebSocketMessage) error
+	GetEventsSince(ctx context.Context, retroID uuid.UUID, seq int64, limit int) ([]types.WebSocketMessage, error)
 }
 
-type WebSocketRepository interface {
-	Repository
+// Broadcaster notifies the subscribers of each retrospective about its
+// changes. It has nothing to read from, so it only implements Writer.
+type Broadcaster interface {
+	Writer
 	AddConnection(ctx context.Context, w http.ResponseWriter, r *http.Request) error
+	ConnectionCount() int
+	NotifyPendingDeletion(ctx context.Context, retro *types.Retrospective) error
 }
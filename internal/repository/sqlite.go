@@ -2,33 +2,63 @@ package repository
 
 import (
 	"api/config"
+	"api/database"
 	"api/types"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
+// ErrForeignKey is returned when a row references a parent that doesn't
+// exist, such as a question of an unknown retrospective.
+var ErrForeignKey = errors.New("foreign key constraint failed")
+
+// ErrDifferentQuestions is returned when merging answers of two questions.
+var ErrDifferentQuestions = errors.New("answers belong to different questions")
+
+// ErrInvalidMoveTarget is returned when moving answers to a question that
+// isn't another one of the retrospective.
+var ErrInvalidMoveTarget = errors.New("answers can only be moved to another question of the retrospective")
+
+// ErrConflict is returned when a row changed since the version the caller
+// expected.
+var ErrConflict = errors.New("version conflict")
+
 type SQLite struct {
 	conn *sql.DB
 }
 
+// wrapConstraintError maps driver constraint errors to repository errors.
+func wrapConstraintError(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey {
+		return fmt.Errorf("%w: %v", ErrForeignKey, err)
+	}
+	return err
+}
+
 func NewSQLite() (*SQLite, error) {
 	conf := config.Get()
-	db, err := sql.Open(
-		"sqlite3",
-		fmt.Sprintf("%s%s?_foreign_keys=on&cache=%s", conf.Database.Type, conf.Database.Address, conf.Database.Cache),
-	)
+	db, err := sql.Open("sqlite3", dataSourceName(conf.Database))
 	if err != nil {
 		return nil, err
 	}
 
-	// Set the maximum number of open connections
+	// Set the maximum number of open connections, and keep them around once
+	// idle so they aren't reopened on every burst of requests
 	db.SetMaxOpenConns(conf.Database.MaxConn)
+	db.SetMaxIdleConns(conf.Database.MaxConn)
 
 	// Ping to check if the database connection is established
 	err = db.Ping()
@@ -40,7 +70,13 @@ func NewSQLite() (*SQLite, error) {
 		conn: db,
 	}
 
-	err = repo.migrate(conf.Database.Schema)
+	err = repo.Migrate(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	retention := time.Duration(conf.Schedule.CleanUpDays) * 24 * time.Hour
+	err = repo.backfillExpiry(context.Background(), retention)
 	if err != nil {
 		return nil, err
 	}
@@ -48,40 +84,345 @@ func NewSQLite() (*SQLite, error) {
 	return repo, nil
 }
 
-func (s *SQLite) migrate(filepath string) error {
-	// Read the schema file
-	schema, err := os.ReadFile(filepath)
+// backfillExpiry stores the expiry of the retrospectives created before it
+// was stored, from their creation and the retention. Migrations can't do it
+// as the retention is configured.
+func (s *SQLite) backfillExpiry(ctx context.Context, retention time.Duration) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	type pending struct {
+		id        uuid.UUID
+		createdAt time.Time
+	}
+	var retros []pending
+
+	sqlQuery := `SELECT id, created_at FROM retrospectives WHERE expire_at IS NULL`
+	rows, err := tx.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var retro pending
+		if err := rows.Scan(&retro.id, &retro.createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		retros = append(retros, retro)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sqlQuery = `UPDATE retrospectives SET expire_at = $1 WHERE id = $2`
+	for _, retro := range retros {
+		_, err = tx.ExecContext(ctx, sqlQuery, retro.createdAt.Add(retention).UTC(), retro.id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// dataSourceName builds the connection string of the database. In WAL mode
+// SQLite keeps database.db-wal and database.db-shm files next to the
+// database, they are part of it and must be kept (and backed up) with it.
+func dataSourceName(conf config.Database) string {
+	dsn := fmt.Sprintf("%s%s?_foreign_keys=on&cache=%s", conf.Type, conf.Address, conf.Cache)
+	if conf.Mode != "" {
+		dsn += "&mode=" + conf.Mode
+	}
+	if conf.JournalMode != "" {
+		dsn += "&_journal_mode=" + conf.JournalMode
+	}
+	if conf.BusyTimeoutMs > 0 {
+		dsn += fmt.Sprintf("&_busy_timeout=%d", conf.BusyTimeoutMs)
+	}
+	return dsn
+}
+
+// sessionFromContext returns the session of the caller, or NULL when the
+// request has none so that it never matches a stored author.
+func sessionFromContext(ctx context.Context) interface{} {
+	sessionID, ok := ctx.Value("session_id").(string)
+	if !ok || sessionID == "" {
+		return nil
+	}
+	return sessionID
+}
+
+// Ping checks the database is reachable and its schema was applied.
+func (s *SQLite) Ping(ctx context.Context) error {
+	if err := s.conn.PingContext(ctx); err != nil {
+		return err
+	}
+
+	var tables int
+	sqlQuery := `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name IN ('retrospectives', 'questions', 'answers')`
+	if err := s.conn.QueryRowContext(ctx, sqlQuery).Scan(&tables); err != nil {
+		return err
+	}
+
+	if tables != 3 {
+		return fmt.Errorf("database schema not applied")
+	}
+	return nil
+}
+
+// Migrate applies the migrations the database is missing. They are read
+// from the configured directory, or from the ones built into the binary.
+func (s *SQLite) Migrate(ctx context.Context) error {
+	var migrations fs.FS = os.DirFS(config.Get().Database.Migrations)
+	if config.Get().Database.Migrations == "" {
+		var err error
+		migrations, err = fs.Sub(database.Migrations, "migrations")
+		if err != nil {
+			return err
+		}
+	}
+	return s.applyMigrations(ctx, migrations)
+}
+
+// migration is a SQL file of a migrations directory.
+type migration struct {
+	version int
+	name    string
+}
+
+// applyMigrations runs each migration of the directory that isn't recorded
+// in schema_migrations yet, in its own transaction and in version order.
+func (s *SQLite) applyMigrations(ctx context.Context, migrations fs.FS) error {
+	sqlQuery := `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY, name TEXT, applied_at DATETIME)`
+	if _, err := s.conn.ExecContext(ctx, sqlQuery); err != nil {
+		return err
+	}
+
+	all, err := listMigrations(migrations)
 	if err != nil {
 		return err
 	}
 
-	// Execute the SQL statements from the schema file
-	_, err = s.conn.Exec(string(schema))
+	rows, err := s.conn.QueryContext(ctx, `SELECT version FROM schema_migrations`)
 	if err != nil {
 		return err
 	}
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err := rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+		applied[version] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
 
+	for _, m := range all {
+		if applied[m.version] {
+			continue
+		}
+		if err := s.applyMigration(ctx, migrations, m); err != nil {
+			return fmt.Errorf("error applying migration %s: %w", m.name, err)
+		}
+	}
 	return nil
 }
 
+func (s *SQLite) applyMigration(ctx context.Context, migrations fs.FS, m migration) error {
+	statements, err := fs.ReadFile(migrations, m.name)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, string(statements)); err != nil {
+		return err
+	}
+
+	sqlQuery := `INSERT INTO schema_migrations (version, name, applied_at) VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, sqlQuery, m.version, m.name, time.Now().UTC()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// listMigrations lists the SQL files of the directory sorted by version.
+func listMigrations(migrations fs.FS) ([]migration, error) {
+	names, err := fs.Glob(migrations, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]migration, 0, len(names))
+	seen := make(map[int]string)
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s doesn't start with a version", name)
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("migrations %s and %s have the same version", other, name)
+		}
+		seen[version] = name
+		list = append(list, migration{version: version, name: name})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+	return list, nil
+}
+
+// CreateRetrospective inserts the retrospective along with its questions and
+// their answers, if it already has any, in a single transaction. Inserted
+// answers keep their position and have no author.
 func (s *SQLite) CreateRetrospective(ctx context.Context, retro *types.Retrospective) error {
-	sql := `INSERT INTO retrospectives (id, name, description, created_at) VALUES ($1, $2, $3, $4)`
-	_, err := s.conn.Exec(sql,
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sql := `INSERT INTO retrospectives (id, name, description, phase, private, had_content, created_at, expire_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.ExecContext(ctx, sql,
 		retro.ID,
 		retro.Name,
 		retro.Description,
+		retro.Phase,
+		retro.Private,
+		len(retro.Questions) > 0,
 		retro.CreatedAt,
+		retro.ExpireAt,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+
+	sql = `INSERT INTO questions (id, text, retrospective_id) VALUES ($1, $2, $3)`
+	answerSql := `INSERT INTO answers (id, text, question_id, position, color) VALUES ($1, $2, $3, $4, $5)`
+	for _, question := range retro.Questions {
+		_, err = tx.ExecContext(ctx, sql,
+			question.ID,
+			question.Text,
+			retro.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		for _, answer := range question.Answers {
+			_, err = tx.ExecContext(ctx, answerSql,
+				answer.ID,
+				answer.Text,
+				question.ID,
+				answer.Position,
+				answer.Color,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DuplicateRetrospective stores retro as a copy of the source retrospective,
+// with its description and questions but none of its answers. The ID, phase,
+// creation and expiry dates of retro are kept, the rest is filled from the
+// source.
+func (s *SQLite) DuplicateRetrospective(ctx context.Context, sourceID uuid.UUID, retro *types.Retrospective) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	sqlQuery := `SELECT name, description, private FROM retrospectives WHERE id = $1`
+	err = tx.QueryRowContext(ctx, sqlQuery, sourceID).Scan(
+		&name,
+		&retro.Description,
+		&retro.Private,
+	)
+	if err != nil {
+		return err
+	}
+	retro.Name = types.CopyName(name)
+
+	sqlQuery = `SELECT text FROM questions WHERE retrospective_id = $1 ORDER BY rowid`
+	rows, err := tx.QueryContext(ctx, sqlQuery, sourceID)
+	if err != nil {
+		return err
+	}
+
+	retro.Questions = []types.Question{}
+	for rows.Next() {
+		question := types.Question{Answers: []types.Answer{}}
+		if err := rows.Scan(&question.Text); err != nil {
+			rows.Close()
+			return err
+		}
+		if question.ID, err = uuid.NewV7(); err != nil {
+			rows.Close()
+			return err
+		}
+		retro.Questions = append(retro.Questions, question)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sqlQuery = `INSERT INTO retrospectives (id, name, description, phase, private, had_content, created_at, expire_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err = tx.ExecContext(ctx, sqlQuery,
+		retro.ID,
+		retro.Name,
+		retro.Description,
+		retro.Phase,
+		retro.Private,
+		len(retro.Questions) > 0,
+		retro.CreatedAt,
+		retro.ExpireAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	sqlQuery = `INSERT INTO questions (id, text, retrospective_id) VALUES ($1, $2, $3)`
+	for _, question := range retro.Questions {
+		_, err = tx.ExecContext(ctx, sqlQuery, question.ID, question.Text, retro.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
 
+// UpdateRetrospective replaces the name and description with their trimmed
+// values. An empty or whitespace-only value keeps the stored one, and nothing
+// is written when the result is identical to what is stored.
 func (s *SQLite) UpdateRetrospective(ctx context.Context, retro *types.Retrospective) error {
 	foundRetro := &types.Retrospective{
 		ID: retro.ID,
 	}
 
 	sqlQuery := `SELECT name, description FROM retrospectives WHERE id = $1`
-	err := s.conn.QueryRow(sqlQuery, foundRetro.ID).Scan(
+	err := s.conn.QueryRowContext(ctx, sqlQuery, foundRetro.ID).Scan(
 		&foundRetro.Name,
 		&foundRetro.Description,
 	)
@@ -89,12 +430,22 @@ func (s *SQLite) UpdateRetrospective(ctx context.Context, retro *types.Retrospec
 		return err
 	}
 
+	retro.Name = strings.TrimSpace(retro.Name)
 	if len(retro.Name) == 0 {
 		retro.Name = foundRetro.Name
 	}
 
+	retro.Description = strings.TrimSpace(retro.Description)
+	if len(retro.Description) == 0 {
+		retro.Description = foundRetro.Description
+	}
+
+	if retro.Name == foundRetro.Name && retro.Description == foundRetro.Description {
+		return nil
+	}
+
 	sqlQuery = `UPDATE retrospectives SET name = $1, description = $2 WHERE id = $3`
-	_, err = s.conn.Exec(sqlQuery,
+	_, err = s.conn.ExecContext(ctx, sqlQuery,
 		retro.Name,
 		retro.Description,
 		retro.ID,
@@ -103,6 +454,28 @@ func (s *SQLite) UpdateRetrospective(ctx context.Context, retro *types.Retrospec
 	return err
 }
 
+func (s *SQLite) UpdateRetrospectivePhase(ctx context.Context, retro *types.Retrospective) error {
+	sqlQuery := `UPDATE retrospectives SET phase = $1 WHERE id = $2`
+	res, err := s.conn.ExecContext(ctx, sqlQuery,
+		retro.Phase,
+		retro.ID,
+	)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+
+	return nil
+}
+
 func (s *SQLite) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
 	retro := &types.Retrospective{
 		ID:        id,
@@ -110,7 +483,7 @@ func (s *SQLite) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.
 	}
 
 	sqlQuery := `SELECT name, description FROM retrospectives WHERE id = $1`
-	err := s.conn.QueryRow(sqlQuery, id).Scan(
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id).Scan(
 		&retro.Name,
 		&retro.Description,
 	)
@@ -118,7 +491,7 @@ func (s *SQLite) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.
 		return nil, err
 	}
 
-	tx, err := s.conn.Begin()
+	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return retro, err
 	}
@@ -132,21 +505,21 @@ func (s *SQLite) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.
 
 	// Delete answers associated with questions of the retrospective
 	sqlQuery = `DELETE FROM answers WHERE question_id IN (SELECT id FROM questions WHERE retrospective_id = $1)`
-	_, err = tx.Exec(sqlQuery, id)
+	_, err = tx.ExecContext(ctx, sqlQuery, id)
 	if err != nil {
 		return retro, err
 	}
 
 	// Delete questions associated with the retrospective
 	sqlQuery = `DELETE FROM questions WHERE retrospective_id = $1`
-	_, err = tx.Exec(sqlQuery, id)
+	_, err = tx.ExecContext(ctx, sqlQuery, id)
 	if err != nil {
 		return retro, err
 	}
 
 	// Delete the retrospective
 	sqlQuery = `DELETE FROM retrospectives WHERE id = $1`
-	_, err = tx.Exec(sqlQuery, id)
+	_, err = tx.ExecContext(ctx, sqlQuery, id)
 	if err != nil {
 		return retro, err
 	}
@@ -154,12 +527,14 @@ func (s *SQLite) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.
 	return retro, nil
 }
 
+// GetOldRetrospectives returns the retrospectives expiring before date.
 func (s *SQLite) GetOldRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
-	sqlQuery := `SELECT id FROM retrospectives WHERE created_at < $1`
-	rows, err := s.conn.Query(sqlQuery, date)
+	sqlQuery := `SELECT id FROM retrospectives WHERE expire_at < $1`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, date.UTC())
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	IDs := make([]uuid.UUID, 0)
 
@@ -174,12 +549,54 @@ func (s *SQLite) GetOldRetrospectives(ctx context.Context, date time.Time) ([]uu
 	return IDs, nil
 }
 
+// SetRetrospectiveExpiry moves the expiry of a retrospective.
+func (s *SQLite) SetRetrospectiveExpiry(ctx context.Context, id uuid.UUID, expireAt time.Time) error {
+	sqlQuery := `UPDATE retrospectives SET expire_at = $1 WHERE id = $2`
+	res, err := s.conn.ExecContext(ctx, sqlQuery, expireAt, id)
+	if err != nil {
+		return err
+	}
+
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 func (s *SQLite) GetAllRetrospectives(ctx context.Context) ([]uuid.UUID, error) {
 	sqlQuery := `SELECT id FROM retrospectives`
-	rows, err := s.conn.Query(sqlQuery)
+	rows, err := s.conn.QueryContext(ctx, sqlQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	IDs := make([]uuid.UUID, 0)
+
+	for rows.Next() {
+		var ID uuid.UUID
+		err := rows.Scan(&ID)
+		if err != nil {
+			return nil, err
+		}
+		IDs = append(IDs, ID)
+	}
+	return IDs, nil
+}
+
+// GetEmptyRetrospectives returns retrospectives created before date that
+// never had any question.
+func (s *SQLite) GetEmptyRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
+	sqlQuery := `SELECT id FROM retrospectives r WHERE created_at < $1 AND had_content = 0
+								AND NOT EXISTS (SELECT 1 FROM questions q WHERE q.retrospective_id = r.id)`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, date.UTC())
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
 	IDs := make([]uuid.UUID, 0)
 
@@ -195,24 +612,44 @@ func (s *SQLite) GetAllRetrospectives(ctx context.Context) ([]uuid.UUID, error)
 }
 
 func (s *SQLite) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
+	return s.GetRetrospectivePage(ctx, id, types.AnswersQuery{})
+}
+
+// GetRetrospectivePage returns a retrospective with only the questions and
+// answers selected by the query.
+func (s *SQLite) GetRetrospectivePage(ctx context.Context, id uuid.UUID, query types.AnswersQuery) (*types.Retrospective, error) {
+	sessionID := sessionFromContext(ctx)
 	retro := &types.Retrospective{
 		ID:        id,
 		Questions: []types.Question{},
 	}
 
-	sqlQuery := `SELECT name, description, created_at FROM retrospectives WHERE id = $1`
-	err := s.conn.QueryRow(sqlQuery, id).Scan(
+	// The expiry is only missing until it is backfilled on startup
+	var expireAt sql.NullTime
+	sqlQuery := `SELECT name, description, phase, private, created_at, expire_at FROM retrospectives WHERE id = $1`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id).Scan(
 		&retro.Name,
 		&retro.Description,
+		&retro.Phase,
+		&retro.Private,
 		&retro.CreatedAt,
+		&expireAt,
 	)
 	if err != nil {
 		return nil, err
 	}
+	retro.ExpireAt = expireAt.Time
+	onlyMine := config.Get().Features.Phases && types.HidesAnswers(retro.Phase)
 
-	// Query questions for the retrospective
+	// Query questions for the retrospective. They are all read before
+	// querying the answers so no result set is held open meanwhile.
 	sqlQuery = `SELECT id, text FROM questions WHERE retrospective_id = $1`
-	rows, err := s.conn.Query(sqlQuery, id)
+	args := []interface{}{id}
+	if query.QuestionID != uuid.Nil {
+		sqlQuery += ` AND id = $2`
+		args = append(args, query.QuestionID)
+	}
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -230,78 +667,394 @@ func (s *SQLite) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Ret
 			return nil, err
 		}
 
-		// Query answers for the question
-		sqlQuery = `SELECT id, text, position, question_id FROM answers WHERE question_id = $1`
-		answerRows, err := s.conn.Query(sqlQuery, question.ID)
+		// Append the question to the retrospective
+		retro.Questions = append(retro.Questions, question)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for i := range retro.Questions {
+		answers, err := s.questionAnswers(ctx, sessionID, retro.Questions[i].ID, query, onlyMine)
 		if err != nil {
 			return nil, err
 		}
-		defer answerRows.Close()
-
-		// Loop through answers and append to the question
-		for answerRows.Next() {
-			var answer types.Answer
-			err := answerRows.Scan(
-				&answer.ID,
-				&answer.Text,
-				&answer.Position,
-				&answer.QuestionID,
-			)
-			if err != nil {
-				return nil, err
-			}
-			question.Answers = append(question.Answers, answer)
-		}
-
-		// Append the question to the retrospective
-		retro.Questions = append(retro.Questions, question)
+		retro.Questions[i].Answers = answers
 	}
 
 	return retro, nil
 }
 
-func (s *SQLite) CreateQuestion(ctx context.Context, question *types.Question) error {
-	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
-	if !ok {
-		return fmt.Errorf("retrospective id not found")
+// questionAnswers returns the answers of a question selected by the query,
+// only the ones of the session when onlyMine is set, closing its result set
+// before returning.
+func (s *SQLite) questionAnswers(ctx context.Context, sessionID interface{}, questionID uuid.UUID, query types.AnswersQuery, onlyMine bool) ([]types.Answer, error) {
+	sqlQuery := `SELECT id, text, position, version, color, question_id, IFNULL(author_session = $1, 0) FROM answers WHERE question_id = $2`
+	args := []interface{}{sessionID, questionID}
+	if onlyMine {
+		sqlQuery += ` AND author_session = $1`
 	}
-	sql := `INSERT INTO questions (id, text, retrospective_id) VALUES ($1, $2, $3)`
-	_, err := s.conn.Exec(sql,
-		question.ID,
-		question.Text,
-		retrospectiveID,
-	)
-	return err
-}
 
-func (s *SQLite) UpdateQuestion(ctx context.Context, question *types.Question) error {
-	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
-	if !ok {
-		return fmt.Errorf("retrospective id not found")
+	switch query.Sort {
+	case types.ANSWERS_SORT_POSITION:
+		sqlQuery += ` ORDER BY position`
+	case types.ANSWERS_SORT_CREATED_AT:
+		// Rows are never moved, so insertion order is creation order
+		sqlQuery += ` ORDER BY rowid`
 	}
 
-	foundQuestion := &types.Question{
-		ID: question.ID,
+	if query.Limit > 0 || query.Offset > 0 {
+		limit := query.Limit
+		if limit == 0 {
+			limit = -1
+		}
+		sqlQuery += ` LIMIT $3 OFFSET $4`
+		args = append(args, limit, query.Offset)
 	}
 
-	sqlQuery := `SELECT text FROM questions WHERE id = $1 and retrospective_id = $2`
-	err := s.conn.QueryRow(sqlQuery, foundQuestion.ID, retrospectiveID).Scan(
-		&foundQuestion.Text,
-	)
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	if len(question.Text) == 0 {
-		question.Text = foundQuestion.Text
+	answers := []types.Answer{}
+	for rows.Next() {
+		var answer types.Answer
+		err := rows.Scan(
+			&answer.ID,
+			&answer.Text,
+			&answer.Position,
+			&answer.Version,
+			&answer.Color,
+			&answer.QuestionID,
+			&answer.Mine,
+		)
+		if err != nil {
+			return nil, err
+		}
+		answers = append(answers, answer)
 	}
 
-	sqlQuery = `UPDATE questions SET text = $1 WHERE id = $2 and retrospective_id = $3`
-	_, err = s.conn.Exec(sqlQuery,
-		question.Text,
-		question.ID,
-		retrospectiveID,
-	)
+	return answers, rows.Err()
+}
+
+// GetRetrospectivePhase returns the phase of a retrospective.
+func (s *SQLite) GetRetrospectivePhase(ctx context.Context, id uuid.UUID) (string, error) {
+	var phase string
+	sqlQuery := `SELECT phase FROM retrospectives WHERE id = $1`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id).Scan(&phase)
+	return phase, err
+}
+
+// hidesAnswers tells whether the retrospective only shows its answers to the
+// session which wrote them.
+func (s *SQLite) hidesAnswers(ctx context.Context, id uuid.UUID) (bool, error) {
+	if !config.Get().Features.Phases {
+		return false, nil
+	}
+
+	phase, err := s.GetRetrospectivePhase(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	return types.HidesAnswers(phase), nil
+}
+
+func (s *SQLite) GetRetrospectiveSummary(ctx context.Context, id uuid.UUID) (*types.RetrospectiveSummary, error) {
+	retro := &types.RetrospectiveSummary{
+		ID:        id,
+		Questions: []types.QuestionSummary{},
+	}
+
+	// The expiry is only missing until it is backfilled on startup
+	var expireAt sql.NullTime
+	sqlQuery := `SELECT name, description, phase, private, created_at, expire_at FROM retrospectives WHERE id = $1`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id).Scan(
+		&retro.Name,
+		&retro.Description,
+		&retro.Phase,
+		&retro.Private,
+		&retro.CreatedAt,
+		&expireAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	retro.ExpireAt = expireAt.Time
+
+	// Count answers of each question without loading them
+	sqlQuery = `SELECT q.id, q.text, COUNT(a.id) FROM questions q
+								LEFT JOIN answers a ON a.question_id = q.id
+								WHERE q.retrospective_id = $1
+								GROUP BY q.id, q.text
+								ORDER BY q.rowid`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var question types.QuestionSummary
+		err := rows.Scan(
+			&question.ID,
+			&question.Text,
+			&question.AnswerCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		retro.Questions = append(retro.Questions, question)
+	}
+
+	return retro, rows.Err()
+}
+
+// CountContent counts the retrospectives, questions and answers stored.
+func (s *SQLite) CountContent(ctx context.Context) (*types.ContentCount, error) {
+	count := &types.ContentCount{}
+
+	sqlQuery := `SELECT (SELECT COUNT(*) FROM retrospectives),
+								(SELECT COUNT(*) FROM questions),
+								(SELECT COUNT(*) FROM answers)`
+	err := s.conn.QueryRowContext(ctx, sqlQuery).Scan(
+		&count.Retrospectives,
+		&count.Questions,
+		&count.Answers,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return count, nil
+}
+
+// GetRetrospectiveStats counts the questions and answers of a retrospective
+// without loading them.
+func (s *SQLite) GetRetrospectiveStats(ctx context.Context, id uuid.UUID) (*types.RetrospectiveStats, error) {
+	stats := &types.RetrospectiveStats{
+		ID:                 id,
+		AnswersPerQuestion: []types.QuestionSummary{},
+	}
+
+	var exists int
+	sqlQuery := `SELECT 1 FROM retrospectives WHERE id = $1`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery = `SELECT q.id, q.text, COUNT(a.id) FROM questions q
+								LEFT JOIN answers a ON a.question_id = q.id
+								WHERE q.retrospective_id = $1
+								GROUP BY q.id, q.text
+								ORDER BY q.rowid`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var question types.QuestionSummary
+		err := rows.Scan(
+			&question.ID,
+			&question.Text,
+			&question.AnswerCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		stats.QuestionCount++
+		stats.AnswerCount += question.AnswerCount
+		stats.AnswersPerQuestion = append(stats.AnswersPerQuestion, question)
+	}
+
+	return stats, rows.Err()
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern, for an ESCAPE '\'
+// clause.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchRetrospectives lists a page of the retrospectives whose name contains
+// the search, the most recent first, along with how many match in total.
+func (s *SQLite) SearchRetrospectives(ctx context.Context, search types.RetrospectiveSearch) (*types.RetrospectiveList, error) {
+	list := &types.RetrospectiveList{
+		Retrospectives: []types.RetrospectiveListing{},
+		Page:           search.Page,
+		Size:           search.Size,
+	}
+	pattern := "%" + likeEscaper.Replace(search.Search) + "%"
+
+	sqlQuery := `SELECT COUNT(*) FROM retrospectives WHERE name LIKE $1 ESCAPE '\'`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, pattern).Scan(&list.Total)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery = `SELECT r.id, r.name, r.created_at, r.expire_at,
+								(SELECT COUNT(*) FROM questions q WHERE q.retrospective_id = r.id),
+								(SELECT COUNT(*) FROM answers a
+									JOIN questions q ON q.id = a.question_id
+									WHERE q.retrospective_id = r.id)
+								FROM retrospectives r
+								WHERE r.name LIKE $1 ESCAPE '\'
+								ORDER BY r.created_at DESC, r.id DESC
+								LIMIT $2 OFFSET $3`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, pattern, search.Size, (search.Page-1)*search.Size)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var retro types.RetrospectiveListing
+		var expireAt sql.NullTime
+		err := rows.Scan(
+			&retro.ID,
+			&retro.Name,
+			&retro.CreatedAt,
+			&expireAt,
+			&retro.QuestionCount,
+			&retro.AnswerCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		retro.ExpireAt = expireAt.Time
+		list.Retrospectives = append(list.Retrospectives, retro)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *SQLite) GetQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return nil, fmt.Errorf("retrospective id not found")
+	}
+
+	question := &types.Question{
+		ID:      id,
+		Answers: []types.Answer{},
+	}
+
+	sqlQuery := `SELECT text FROM questions WHERE id = $1 and retrospective_id = $2`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id, retrospectiveID).Scan(
+		&question.Text,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return question, nil
+}
+
+// CountQuestions returns the number of questions of the retrospective.
+func (s *SQLite) CountQuestions(ctx context.Context) (int, error) {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return 0, fmt.Errorf("retrospective id not found")
+	}
+
+	var count int
+	sqlQuery := `SELECT COUNT(*) FROM questions WHERE retrospective_id = $1`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, retrospectiveID).Scan(&count)
+	return count, err
+}
+
+func (s *SQLite) CreateQuestion(ctx context.Context, question *types.Question) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+	sql := `INSERT INTO questions (id, text, retrospective_id) VALUES ($1, $2, $3)`
+	_, err := s.conn.ExecContext(ctx, sql,
+		question.ID,
+		question.Text,
+		retrospectiveID,
+	)
+	if err != nil {
+		return wrapConstraintError(err)
+	}
+
+	// Remember the retrospective was used, so it is never purged as empty
+	sql = `UPDATE retrospectives SET had_content = 1 WHERE id = $1`
+	_, err = s.conn.ExecContext(ctx, sql, retrospectiveID)
+	return err
+}
+
+// CreateQuestions inserts all questions or none of them.
+func (s *SQLite) CreateQuestions(ctx context.Context, questions []*types.Question) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlQuery := `INSERT INTO questions (id, text, retrospective_id) VALUES ($1, $2, $3)`
+	for _, question := range questions {
+		_, err = tx.ExecContext(ctx, sqlQuery,
+			question.ID,
+			question.Text,
+			retrospectiveID,
+		)
+		if err != nil {
+			return wrapConstraintError(err)
+		}
+	}
+
+	sqlQuery = `UPDATE retrospectives SET had_content = 1 WHERE id = $1`
+	_, err = tx.ExecContext(ctx, sqlQuery, retrospectiveID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateQuestion follows the same rules as UpdateRetrospective for the text.
+func (s *SQLite) UpdateQuestion(ctx context.Context, question *types.Question) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
+	foundQuestion := &types.Question{
+		ID: question.ID,
+	}
+
+	sqlQuery := `SELECT text FROM questions WHERE id = $1 and retrospective_id = $2`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, foundQuestion.ID, retrospectiveID).Scan(
+		&foundQuestion.Text,
+	)
+	if err != nil {
+		return err
+	}
+
+	question.Text = strings.TrimSpace(question.Text)
+	if len(question.Text) == 0 {
+		question.Text = foundQuestion.Text
+	}
+
+	if question.Text == foundQuestion.Text {
+		return nil
+	}
+
+	sqlQuery = `UPDATE questions SET text = $1 WHERE id = $2 and retrospective_id = $3`
+	_, err = s.conn.ExecContext(ctx, sqlQuery,
+		question.Text,
+		question.ID,
+		retrospectiveID,
+	)
 
 	return err
 }
@@ -317,14 +1070,14 @@ func (s *SQLite) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Quest
 	}
 
 	sqlQuery := `SELECT text FROM questions WHERE id = $1 and retrospective_id = $2`
-	err := s.conn.QueryRow(sqlQuery, id, retrospectiveID).Scan(
+	err := s.conn.QueryRowContext(ctx, sqlQuery, id, retrospectiveID).Scan(
 		&question.Text,
 	)
 	if err != nil {
 		return nil, err
 	}
 
-	tx, err := s.conn.Begin()
+	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return question, err
 	}
@@ -338,76 +1091,366 @@ func (s *SQLite) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Quest
 
 	// Delete answers associated with questions of the retrospective
 	sqlQuery = `DELETE FROM answers WHERE question_id = $1`
-	_, err = tx.Exec(sqlQuery, id)
+	_, err = tx.ExecContext(ctx, sqlQuery, id)
 	if err != nil {
 		return question, err
 	}
 
 	// Delete questions associated with the retrospective
 	sqlQuery = `DELETE FROM questions WHERE id = $1`
-	_, err = tx.Exec(sqlQuery, id)
+	_, err = tx.ExecContext(ctx, sqlQuery, id)
 
 	return question, nil
 }
 
+// MoveAnswersAndDeleteQuestion moves the answers of the question after the
+// ones of the target question, keeping their order, then deletes the now
+// empty question. question.Answers holds the moved answers as stored.
+func (s *SQLite) MoveAnswersAndDeleteQuestion(ctx context.Context, question *types.Question, targetID uuid.UUID) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
+	id := question.ID
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlQuery := `SELECT text FROM questions WHERE id = $1 and retrospective_id = $2`
+	err = tx.QueryRowContext(ctx, sqlQuery, id, retrospectiveID).Scan(&question.Text)
+	if err != nil {
+		return err
+	}
+
+	if targetID == id {
+		return ErrInvalidMoveTarget
+	}
+
+	var last int
+	sqlQuery = `SELECT IFNULL((SELECT MAX(position) FROM answers WHERE question_id = q.id), 0) FROM questions q
+								WHERE q.id = $1 and q.retrospective_id = $2`
+	err = tx.QueryRowContext(ctx, sqlQuery, targetID, retrospectiveID).Scan(&last)
+	if err == sql.ErrNoRows {
+		return ErrInvalidMoveTarget
+	}
+	if err != nil {
+		return err
+	}
+
+	sqlQuery = `SELECT id, text, position, version, color, IFNULL(author_session = $1, 0) FROM answers
+								WHERE question_id = $2 ORDER BY position`
+	rows, err := tx.QueryContext(ctx, sqlQuery, sessionFromContext(ctx), id)
+	if err != nil {
+		return err
+	}
+
+	answers := []types.Answer{}
+	for rows.Next() {
+		var answer types.Answer
+		err := rows.Scan(
+			&answer.ID,
+			&answer.Text,
+			&answer.Position,
+			&answer.Version,
+			&answer.Color,
+			&answer.Mine,
+		)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		answers = append(answers, answer)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Moving an answer is a change other clients may be editing against
+	sqlQuery = `UPDATE answers SET question_id = $1, position = $2, version = version + 1 WHERE id = $3 returning version`
+	for i := range answers {
+		answers[i].QuestionID = targetID
+		answers[i].Position = last + i + 1
+		err = tx.QueryRowContext(ctx, sqlQuery, targetID, answers[i].Position, answers[i].ID).Scan(&answers[i].Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	sqlQuery = `DELETE FROM questions WHERE id = $1`
+	_, err = tx.ExecContext(ctx, sqlQuery, id)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	question.Answers = answers
+	return nil
+}
+
+// GetAnswer returns an answer of the retrospective in the context.
+func (s *SQLite) GetAnswer(ctx context.Context, id uuid.UUID) (*types.Answer, error) {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return nil, fmt.Errorf("retrospective id not found")
+	}
+
+	answer := &types.Answer{
+		ID: id,
+	}
+
+	onlyMine, err := s.hidesAnswers(ctx, retrospectiveID)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlQuery := `SELECT a.text, a.position, a.version, a.color, a.question_id, IFNULL(a.author_session = $1, 0) FROM answers a
+								JOIN questions q ON q.id = a.question_id
+								WHERE a.id = $2 and q.retrospective_id = $3`
+	if onlyMine {
+		sqlQuery += ` AND a.author_session = $1`
+	}
+	err = s.conn.QueryRowContext(ctx, sqlQuery, sessionFromContext(ctx), id, retrospectiveID).Scan(
+		&answer.Text,
+		&answer.Position,
+		&answer.Version,
+		&answer.Color,
+		&answer.QuestionID,
+		&answer.Mine,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return answer, nil
+}
+
+func (s *SQLite) GetAnswers(ctx context.Context, questionID uuid.UUID) ([]types.Answer, error) {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return nil, fmt.Errorf("retrospective id not found")
+	}
+
+	var found int
+	sqlQuery := `SELECT 1 FROM questions WHERE id = $1 and retrospective_id = $2`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, questionID, retrospectiveID).Scan(&found)
+	if err != nil {
+		return nil, err
+	}
+
+	onlyMine, err := s.hidesAnswers(ctx, retrospectiveID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.questionAnswers(ctx, sessionFromContext(ctx), questionID, types.AnswersQuery{Sort: types.ANSWERS_SORT_POSITION}, onlyMine)
+}
+
+// CountAnswers returns the number of answers of a question of the
+// retrospective.
+func (s *SQLite) CountAnswers(ctx context.Context, questionID uuid.UUID) (int, error) {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return 0, fmt.Errorf("retrospective id not found")
+	}
+
+	var count int
+	sqlQuery := `SELECT COUNT(*) FROM answers a
+								JOIN questions q ON q.id = a.question_id
+								WHERE a.question_id = $1 and q.retrospective_id = $2`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, questionID, retrospectiveID).Scan(&count)
+	return count, err
+}
+
+// CreateAnswer only accepts questions of the retrospective in the context. A
+// question of another retrospective is reported as not found.
 func (s *SQLite) CreateAnswer(ctx context.Context, answer *types.Answer) error {
-	sqlQuery := `INSERT INTO answers 
-								(id, text, question_id, position) 
-								VALUES ($1, $2, $3, (SELECT IFNULL(MAX(position),0) + 1 FROM answers WHERE question_id = $3)) returning position`
-	err := s.conn.QueryRow(sqlQuery,
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
+	var questionRetrospectiveID uuid.UUID
+	sqlQuery := `SELECT retrospective_id FROM questions WHERE id = $1`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, answer.QuestionID).Scan(&questionRetrospectiveID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: question %s", ErrForeignKey, answer.QuestionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if questionRetrospectiveID != retrospectiveID {
+		return sql.ErrNoRows
+	}
+
+	sqlQuery = `INSERT INTO answers 
+								(id, text, question_id, author_session, position, color) 
+								VALUES ($1, $2, $3, $4, (SELECT IFNULL(MAX(position),0) + 1 FROM answers WHERE question_id = $3), $5) returning position, version`
+	err = s.conn.QueryRowContext(ctx, sqlQuery,
 		answer.ID,
 		answer.Text,
 		answer.QuestionID,
+		sessionFromContext(ctx),
+		answer.Color,
 	).Scan(
 		&answer.Position,
+		&answer.Version,
 	)
-	return err
+	return wrapConstraintError(err)
+}
+
+// CreateAnswers inserts all answers or none of them, after the last answer of
+// their question, which they all share. The question must belong to the
+// retrospective in the context, as for CreateAnswer.
+func (s *SQLite) CreateAnswers(ctx context.Context, answers []*types.Answer) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+	if len(answers) == 0 {
+		return nil
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	questionID := answers[0].QuestionID
+	var questionRetrospectiveID uuid.UUID
+	sqlQuery := `SELECT retrospective_id FROM questions WHERE id = $1`
+	err = tx.QueryRowContext(ctx, sqlQuery, questionID).Scan(&questionRetrospectiveID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: question %s", ErrForeignKey, questionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	if questionRetrospectiveID != retrospectiveID {
+		return sql.ErrNoRows
+	}
+
+	sqlQuery = `INSERT INTO answers 
+								(id, text, question_id, author_session, position, color) 
+								VALUES ($1, $2, $3, $4, (SELECT IFNULL(MAX(position),0) + 1 FROM answers WHERE question_id = $3), $5) returning position, version`
+	for _, answer := range answers {
+		err = tx.QueryRowContext(ctx, sqlQuery,
+			answer.ID,
+			answer.Text,
+			questionID,
+			sessionFromContext(ctx),
+			answer.Color,
+		).Scan(
+			&answer.Position,
+			&answer.Version,
+		)
+		if err != nil {
+			return wrapConstraintError(err)
+		}
+	}
+
+	return tx.Commit()
 }
 
+// UpdateAnswer follows the same rules as UpdateRetrospective for the text.
+// When answer.Version is set, the answer is only updated if it is still at
+// that version, ErrConflict is returned otherwise. On success answer.Version
+// holds the stored version.
 func (s *SQLite) UpdateAnswer(ctx context.Context, answer *types.Answer) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
 	foundAnswer := &types.Answer{
 		ID:         answer.ID,
 		QuestionID: answer.QuestionID,
 	}
 
-	sqlQuery := `SELECT text, position FROM answers WHERE id = $1 and question_id = $2`
-	err := s.conn.QueryRow(sqlQuery,
+	sqlQuery := `SELECT a.text, a.position, a.version, a.color FROM answers a JOIN questions q ON q.id = a.question_id
+								WHERE a.id = $1 and a.question_id = $2 and q.retrospective_id = $3`
+	err := s.conn.QueryRowContext(ctx, sqlQuery,
 		foundAnswer.ID,
 		foundAnswer.QuestionID,
+		retrospectiveID,
 	).Scan(
 		&foundAnswer.Text,
 		&foundAnswer.Position,
+		&foundAnswer.Version,
+		&foundAnswer.Color,
 	)
 	if err != nil {
 		return err
 	}
 
+	if answer.Version != 0 && answer.Version != foundAnswer.Version {
+		return ErrConflict
+	}
+
+	answer.Text = strings.TrimSpace(answer.Text)
 	if len(answer.Text) == 0 {
 		answer.Text = foundAnswer.Text
 	}
 
-	sqlQuery = `UPDATE answers SET text = $1 WHERE id = $2 and question_id = $3`
-	_, err = s.conn.Exec(sqlQuery,
+	if len(answer.Color) == 0 {
+		answer.Color = foundAnswer.Color
+	}
+
+	if answer.Text == foundAnswer.Text && answer.Color == foundAnswer.Color {
+		answer.Version = foundAnswer.Version
+		return nil
+	}
+
+	// The version is checked again in the update itself, in case the answer
+	// changed since it was read
+	sqlQuery = `UPDATE answers SET text = $1, color = $2, version = version + 1
+								WHERE id = $3 and question_id = $4 and version = $5 returning version`
+	err = s.conn.QueryRowContext(ctx, sqlQuery,
 		answer.Text,
+		answer.Color,
 		answer.ID,
 		answer.QuestionID,
+		foundAnswer.Version,
+	).Scan(
+		&answer.Version,
 	)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
 
 	return err
 }
 
 func (s *SQLite) DeleteAnswer(ctx context.Context, answer *types.Answer) error {
-	sqlQuery := `SELECT text, position, question_id FROM answers WHERE id = $1`
-	err := s.conn.QueryRow(sqlQuery, answer.ID).Scan(
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
+	sqlQuery := `SELECT a.text, a.position, a.version, a.color, a.question_id FROM answers a JOIN questions q ON q.id = a.question_id
+								WHERE a.id = $1 and q.retrospective_id = $2`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, answer.ID, retrospectiveID).Scan(
 		&answer.Text,
 		&answer.Position,
+		&answer.Version,
+		&answer.Color,
 		&answer.QuestionID,
 	)
 	if err != nil {
 		return err
 	}
 
-	tx, err := s.conn.Begin()
+	tx, err := s.conn.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
@@ -420,10 +1463,291 @@ func (s *SQLite) DeleteAnswer(ctx context.Context, answer *types.Answer) error {
 	}()
 
 	sqlQuery = `DELETE FROM answers WHERE id = $1`
-	_, err = tx.Exec(sqlQuery, answer.ID)
+	_, err = tx.ExecContext(ctx, sqlQuery, answer.ID)
 	if err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// MergeAnswers appends the text of source to target, deletes source and
+// closes the gap it leaves in the positions of its question. Both answers
+// must belong to the same question of the retrospective in the context. On
+// success they hold the deleted and the merged answers.
+func (s *SQLite) MergeAnswers(ctx context.Context, source *types.Answer, target *types.Answer) error {
+	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
+	if !ok {
+		return fmt.Errorf("retrospective id not found")
+	}
+
+	// Answers hidden from the session can't be merged, they aren't found
+	onlyMine, err := s.hidesAnswers(ctx, retrospectiveID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlQuery := `SELECT a.text, a.position, a.version, a.color, a.question_id, IFNULL(a.author_session = $1, 0) FROM answers a
+								JOIN questions q ON q.id = a.question_id
+								WHERE a.id = $2 and q.retrospective_id = $3`
+	if onlyMine {
+		sqlQuery += ` AND a.author_session = $1`
+	}
+	for _, answer := range []*types.Answer{source, target} {
+		err = tx.QueryRowContext(ctx, sqlQuery, sessionFromContext(ctx), answer.ID, retrospectiveID).Scan(
+			&answer.Text,
+			&answer.Position,
+			&answer.Version,
+			&answer.Color,
+			&answer.QuestionID,
+			&answer.Mine,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	if source.QuestionID != target.QuestionID {
+		return ErrDifferentQuestions
+	}
+
+	text, err := types.MergeAnswerText(target.Text, source.Text)
+	if err != nil {
+		return err
+	}
+
+	sqlQuery = `UPDATE answers SET text = $1, version = version + 1 WHERE id = $2 returning version`
+	err = tx.QueryRowContext(ctx, sqlQuery, text, target.ID).Scan(&target.Version)
+	if err != nil {
+		return err
+	}
+	target.Text = text
+
+	sqlQuery = `DELETE FROM answers WHERE id = $1`
+	_, err = tx.ExecContext(ctx, sqlQuery, source.ID)
+	if err != nil {
+		return err
+	}
+
+	sqlQuery = `UPDATE answers SET position = position - 1 WHERE question_id = $1 and position > $2`
+	_, err = tx.ExecContext(ctx, sqlQuery, source.QuestionID, source.Position)
+	if err != nil {
+		return err
+	}
+
+	if target.Position > source.Position {
+		target.Position--
+	}
+
+	return tx.Commit()
+}
+
+// DeleteAnswersByRetrospective deletes every answer of the retrospective,
+// keeping its questions. The deleted answers are added to clear.
+func (s *SQLite) DeleteAnswersByRetrospective(ctx context.Context, clear *types.RetrospectiveClear) error {
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	sqlQuery := `DELETE FROM answers WHERE question_id IN (SELECT id FROM questions WHERE retrospective_id = $1)
+								RETURNING id, question_id`
+	rows, err := tx.QueryContext(ctx, sqlQuery, clear.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	clear.Answers = []types.Answer{}
+	for rows.Next() {
+		var answer types.Answer
+		if err := rows.Scan(&answer.ID, &answer.QuestionID); err != nil {
+			return err
+		}
+		clear.Answers = append(clear.Answers, answer)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	return tx.Commit()
+}
+
+// GetIdempotentResponse returns the response stored for the key by the
+// session in the context since the given date.
+func (s *SQLite) GetIdempotentResponse(ctx context.Context, key string, since time.Time) (*types.IdempotentResponse, error) {
+	response := &types.IdempotentResponse{}
+
+	sqlQuery := `SELECT route, status, location, body FROM idempotency_keys WHERE key = $1 and session = $2 and created_at >= $3`
+	err := s.conn.QueryRowContext(ctx, sqlQuery, key, sessionFromContext(ctx), since).Scan(
+		&response.Route,
+		&response.Status,
+		&response.Location,
+		&response.Body,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// ReserveIdempotencyKey claims the key for a request of the session in the
+// context, replacing a reservation made before the given date. It returns
+// false when the key is already taken, the unique key of the table making
+// sure only one of concurrent requests gets it. A reserved key has no
+// status until its response is saved.
+func (s *SQLite) ReserveIdempotencyKey(ctx context.Context, key string, route string, since time.Time) (bool, error) {
+	sqlQuery := `INSERT INTO idempotency_keys (key, session, route, status, location, body, created_at) VALUES ($1, $2, $3, 0, '', NULL, $4)
+				ON CONFLICT(key, session) DO UPDATE SET route = excluded.route, status = 0, location = '', body = NULL, created_at = excluded.created_at
+				WHERE idempotency_keys.created_at < $5`
+	res, err := s.conn.ExecContext(ctx, sqlQuery, key, sessionFromContext(ctx), route, time.Now().UTC(), since)
+	if err != nil {
+		return false, err
+	}
+
+	reserved, err := res.RowsAffected()
+	return reserved == 1, err
+}
+
+// ReleaseIdempotencyKey deletes the reservation of the key by the session in
+// the context, so the request can be retried.
+func (s *SQLite) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	sqlQuery := `DELETE FROM idempotency_keys WHERE key = $1 and session = $2 and status = 0`
+	_, err := s.conn.ExecContext(ctx, sqlQuery, key, sessionFromContext(ctx))
+	return err
+}
+
+// SaveIdempotentResponse stores the response for the key reserved by the
+// session in the context.
+func (s *SQLite) SaveIdempotentResponse(ctx context.Context, key string, response *types.IdempotentResponse) error {
+	sqlQuery := `UPDATE idempotency_keys SET route = $1, status = $2, location = $3, body = $4 WHERE key = $5 and session = $6`
+	_, err := s.conn.ExecContext(ctx, sqlQuery,
+		response.Route,
+		response.Status,
+		response.Location,
+		response.Body,
+		key,
+		sessionFromContext(ctx),
+	)
+	return err
+}
+
+// DeleteIdempotentResponses deletes the responses stored before the date.
+func (s *SQLite) DeleteIdempotentResponses(ctx context.Context, before time.Time) (int, error) {
+	sqlQuery := `DELETE FROM idempotency_keys WHERE created_at < $1`
+	res, err := s.conn.ExecContext(ctx, sqlQuery, before)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
+
+// SaveVisit records that the session in the context opened the
+// retrospective now. Requests without a session aren't recorded.
+func (s *SQLite) SaveVisit(ctx context.Context, retroID uuid.UUID) error {
+	session := sessionFromContext(ctx)
+	if session == nil {
+		return nil
+	}
+
+	sqlQuery := `INSERT INTO session_visits (session, retrospective_id, visited_at) VALUES ($1, $2, $3)
+								ON CONFLICT(session, retrospective_id) DO UPDATE SET visited_at = excluded.visited_at`
+	_, err := s.conn.ExecContext(ctx, sqlQuery, session, retroID, time.Now().UTC())
+	return err
+}
+
+// GetVisits returns up to limit retrospectives the session in the context
+// opened, most recent first.
+func (s *SQLite) GetVisits(ctx context.Context, limit int) ([]types.RetrospectiveVisit, error) {
+	sqlQuery := `SELECT r.id, r.name, v.visited_at FROM session_visits v
+								JOIN retrospectives r ON r.id = v.retrospective_id
+								WHERE v.session = $1 ORDER BY v.visited_at DESC LIMIT $2`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, sessionFromContext(ctx), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visits := []types.RetrospectiveVisit{}
+	for rows.Next() {
+		var visit types.RetrospectiveVisit
+		err := rows.Scan(&visit.ID, &visit.Name, &visit.LastVisited)
+		if err != nil {
+			return nil, err
+		}
+		visits = append(visits, visit)
+	}
+
+	return visits, rows.Err()
+}
+
+// AppendEvent logs a broadcast message of the retrospective, setting its
+// sequence number.
+func (s *SQLite) AppendEvent(ctx context.Context, retroID uuid.UUID, message *types.WebSocketMessage) error {
+	payload, err := json.Marshal(message.Value)
+	if err != nil {
+		return err
+	}
+
+	var author interface{}
+	if message.Author != "" {
+		author = message.Author
+	}
+
+	sqlQuery := `INSERT INTO events (retrospective_id, action, type, payload, author_session, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	res, err := s.conn.ExecContext(ctx, sqlQuery, retroID.String(), message.Action, message.Type, string(payload), author, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	message.Seq, err = res.LastInsertId()
+	return err
+}
+
+// GetEventsSince returns up to limit messages of the retrospective logged
+// after the sequence number, oldest first.
+func (s *SQLite) GetEventsSince(ctx context.Context, retroID uuid.UUID, seq int64, limit int) ([]types.WebSocketMessage, error) {
+	sqlQuery := `SELECT seq, action, type, payload, IFNULL(author_session, '') FROM events WHERE retrospective_id = $1 AND seq > $2 ORDER BY seq LIMIT $3`
+	rows, err := s.conn.QueryContext(ctx, sqlQuery, retroID.String(), seq, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []types.WebSocketMessage{}
+	for rows.Next() {
+		var message types.WebSocketMessage
+		var payload string
+		err := rows.Scan(&message.Seq, &message.Action, &message.Type, &payload, &message.Author)
+		if err != nil {
+			return nil, err
+		}
+		message.Value = json.RawMessage(payload)
+		events = append(events, message)
+	}
+
+	return events, rows.Err()
+}
+
+// DeleteEvents deletes the messages logged before the date.
+func (s *SQLite) DeleteEvents(ctx context.Context, before time.Time) (int, error) {
+	sqlQuery := `DELETE FROM events WHERE created_at < $1`
+	res, err := s.conn.ExecContext(ctx, sqlQuery, before)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, err := res.RowsAffected()
+	return int(deleted), err
+}
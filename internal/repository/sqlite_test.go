@@ -2,10 +2,16 @@ package repository
 
 import (
 	"api/config"
+	"api/database"
 	"api/types"
 	"context"
 	"database/sql"
+	"encoding/json"
+	"io/fs"
+	"path/filepath"
+	"sync"
 	"testing"
+	"testing/fstest"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +19,28 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// newTestRepo returns a migrated repository on a memory database of its own,
+// so tests don't see each other's rows.
+func newTestRepo(t *testing.T) *SQLite {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	// The name keeps the database apart from the other tests, the shared cache
+	// lets every connection of the pool see it
+	conf.Database.Address = "test-" + uuid.NewString()
+	conf.Database.Mode = "memory"
+	conf.Database.Cache = "shared"
+
+	db, err := NewSQLite()
+	if !assert.Nilf(t, err, "error connecting to database") {
+		t.FailNow()
+	}
+	// The database is dropped once its last connection is closed
+	t.Cleanup(func() { db.conn.Close() })
+
+	return db
+}
+
 func createGenericRetrospective(db *SQLite) (*types.Retrospective, error) {
 	id, err := uuid.NewV7()
 	if err != nil {
@@ -54,12 +82,32 @@ func createGenericQuestion(db *SQLite, retro *types.Retrospective) (*types.Quest
 	return question, err
 }
 
-func TestCreateRetrospective(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
+func createGenericAnswer(db *SQLite, question *types.Question) (*types.Answer, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+	answer := &types.Answer{
+		ID:         id,
+		QuestionID: question.ID,
+		Text:       "Yes, with green tea",
+		Position:   1,
+		Version:    1,
+	}
 
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	sqlQuery := `INSERT INTO answers (id, text, question_id, position) VALUES ($1, $2, $3, $4)`
+	_, err = db.conn.Exec(
+		sqlQuery,
+		&answer.ID,
+		&answer.Text,
+		&answer.QuestionID,
+		&answer.Position,
+	)
+	return answer, err
+}
+
+func TestCreateRetrospective(t *testing.T) {
+	db := newTestRepo(t)
 
 	id, err := uuid.NewV7()
 	assert.Nilf(t, err, "error generating UUID")
@@ -86,11 +134,7 @@ func TestCreateRetrospective(t *testing.T) {
 }
 
 func TestUpdateRetrospective(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
-
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	db := newTestRepo(t)
 
 	retro, err := createGenericRetrospective(db)
 	assert.Nilf(t, err, "error creating retrospective")
@@ -114,12 +158,34 @@ func TestUpdateRetrospective(t *testing.T) {
 	assert.Equal(t, retro, res)
 }
 
-func TestDeleteRetrospective(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
+func TestUpdateRetrospectivePhase(t *testing.T) {
+	db := newTestRepo(t)
 
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	retro.Phase = types.PHASE_VOTING
+
+	ctx := context.Background()
+	err = db.UpdateRetrospectivePhase(ctx, retro)
+	assert.Nilf(t, err, "error updating retrospective phase")
+
+	var phase string
+	sqlQuery := `SELECT phase FROM retrospectives WHERE id = $1`
+	err = db.conn.QueryRow(sqlQuery, retro.ID).Scan(&phase)
+
+	assert.Nilf(t, err, "error getting updated retrospective")
+	assert.Equal(t, types.PHASE_VOTING, phase)
+
+	unknownID, err := uuid.NewV7()
+	assert.Nilf(t, err, "error generating UUID")
+
+	err = db.UpdateRetrospectivePhase(ctx, &types.Retrospective{ID: unknownID, Phase: types.PHASE_VOTING})
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestDeleteRetrospective(t *testing.T) {
+	db := newTestRepo(t)
 
 	retro, err := createGenericRetrospective(db)
 	retro.Questions = []types.Question{}
@@ -142,11 +208,7 @@ func TestDeleteRetrospective(t *testing.T) {
 }
 
 func TestGetRetrospective(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
-
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	db := newTestRepo(t)
 
 	id, err := uuid.NewV7()
 	assert.Nilf(t, err, "error generating UUID")
@@ -161,7 +223,9 @@ func TestGetRetrospective(t *testing.T) {
 		ID:          id,
 		Name:        "mtg",
 		Description: "df/dx = 0",
+		Phase:       types.PHASE_DISCUSSION,
 		CreatedAt:   time.Now().UTC(),
+		ExpireAt:    time.Now().Add(24 * time.Hour).UTC(),
 		Questions: []types.Question{
 			{
 				ID:   questionID,
@@ -172,19 +236,22 @@ func TestGetRetrospective(t *testing.T) {
 						QuestionID: questionID,
 						Text:       "Any of d(respect)/dx = 0 playlist 😎",
 						Position:   1,
+						Version:    1,
 					},
 				},
 			},
 		},
 	}
 
-	sqlQuery := `INSERT INTO retrospectives (id, name, description, created_at) VALUES ($1, $2, $3, $4)`
+	sqlQuery := `INSERT INTO retrospectives (id, name, description, phase, created_at, expire_at) VALUES ($1, $2, $3, $4, $5, $6)`
 	_, err = db.conn.Exec(
 		sqlQuery,
 		&retro.ID,
 		&retro.Name,
 		&retro.Description,
+		&retro.Phase,
 		&retro.CreatedAt,
+		&retro.ExpireAt,
 	)
 	assert.Nilf(t, err, "error creating retrospective")
 
@@ -214,11 +281,7 @@ func TestGetRetrospective(t *testing.T) {
 }
 
 func TestGetAllRetrospective(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
-
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	db := newTestRepo(t)
 
 	id, err := uuid.NewV7()
 	assert.Nilf(t, err, "error generating UUID")
@@ -240,20 +303,7 @@ func TestGetAllRetrospective(t *testing.T) {
 		},
 	}
 
-	// Clear all database to avoid problems with previous tests
-	sqlQuery := `DELETE FROM answers`
-	_, err = db.conn.Exec(sqlQuery)
-	assert.Nilf(t, err, "error deleting all answers")
-
-	sqlQuery = `DELETE FROM questions`
-	_, err = db.conn.Exec(sqlQuery)
-	assert.Nilf(t, err, "error deleting all questions")
-
-	sqlQuery = `DELETE FROM retrospectives`
-	_, err = db.conn.Exec(sqlQuery)
-	assert.Nilf(t, err, "error deleting all retrospectives")
-
-	sqlQuery = `INSERT INTO retrospectives (id, name, description) VALUES ($1, $2, $3), ($4, $5, $6)`
+	sqlQuery := `INSERT INTO retrospectives (id, name, description) VALUES ($1, $2, $3), ($4, $5, $6)`
 	_, err = db.conn.Exec(
 		sqlQuery,
 		&retros[0].ID,
@@ -273,11 +323,7 @@ func TestGetAllRetrospective(t *testing.T) {
 }
 
 func TestCreateQuestion(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
-
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	db := newTestRepo(t)
 
 	retro, err := createGenericRetrospective(db)
 	assert.Nilf(t, err, "error creating retrospective")
@@ -305,11 +351,7 @@ func TestCreateQuestion(t *testing.T) {
 }
 
 func TestUpdateQuestion(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
-
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	db := newTestRepo(t)
 
 	retro, err := createGenericRetrospective(db)
 	assert.Nilf(t, err, "error creating retrospective")
@@ -338,11 +380,7 @@ func TestUpdateQuestion(t *testing.T) {
 }
 
 func TestDeleteQuestion(t *testing.T) {
-	_, err := config.Load("../../config/config_test.yaml")
-	assert.Nilf(t, err, "error loading config")
-
-	db, err := NewSQLite()
-	assert.Nilf(t, err, "error connecting to database")
+	db := newTestRepo(t)
 
 	retro, err := createGenericRetrospective(db)
 	assert.Nilf(t, err, "error creating retrospective")
@@ -366,3 +404,878 @@ func TestDeleteQuestion(t *testing.T) {
 
 	assert.Equal(t, sql.ErrNoRows, err)
 }
+
+func TestMoveAnswersAndDeleteQuestion(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+	other, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+	// Past brainstorm, answers without an author are shown
+	err = db.UpdateRetrospectivePhase(context.Background(), &types.Retrospective{ID: retro.ID, Phase: types.PHASE_VOTING})
+	assert.Nilf(t, err, "error updating phase")
+
+	question, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+	target, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+	elsewhere, err := createGenericQuestion(db, other)
+	assert.Nilf(t, err, "error creating question")
+
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	for _, answer := range []*types.Answer{
+		{QuestionID: target.ID, Text: "kept"},
+		{QuestionID: question.ID, Text: "first"},
+		{QuestionID: question.ID, Text: "second"},
+	} {
+		answer.ID = uuid.New()
+		err = db.CreateAnswer(ctx, answer)
+		assert.Nilf(t, err, "error creating answer")
+	}
+
+	for _, targetID := range []uuid.UUID{question.ID, elsewhere.ID, uuid.New()} {
+		err = db.MoveAnswersAndDeleteQuestion(ctx, &types.Question{ID: question.ID}, targetID)
+		assert.Equal(t, ErrInvalidMoveTarget, err)
+	}
+
+	moved := &types.Question{ID: question.ID}
+	err = db.MoveAnswersAndDeleteQuestion(ctx, moved, target.ID)
+	assert.Nilf(t, err, "error moving answers")
+	assert.Equal(t, question.Text, moved.Text)
+	assert.Len(t, moved.Answers, 2)
+
+	answers, err := db.GetAnswers(ctx, target.ID)
+	assert.Nilf(t, err, "error getting answers")
+	if assert.Len(t, answers, 3) {
+		for i, text := range []string{"kept", "first", "second"} {
+			assert.Equal(t, text, answers[i].Text, "moved answers should follow the target ones in order")
+			assert.Equal(t, i+1, answers[i].Position)
+		}
+		assert.Equal(t, moved.Answers, answers[1:])
+		assert.Equal(t, 2, answers[1].Version, "moving an answer should bump its version")
+	}
+
+	_, err = db.GetAnswers(ctx, question.ID)
+	assert.Equal(t, sql.ErrNoRows, err, "the question should be deleted")
+
+	err = db.MoveAnswersAndDeleteQuestion(ctx, &types.Question{ID: question.ID}, target.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestGetRetrospectiveSummary(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	question, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+
+	emptyQuestion, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+
+	sqlQuery := `INSERT INTO answers (id, text, question_id, position) VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)`
+	_, err = db.conn.Exec(
+		sqlQuery,
+		uuid.New(), "first", question.ID, 1,
+		uuid.New(), "second", question.ID, 2,
+	)
+	assert.Nilf(t, err, "error creating answers")
+
+	// Questions come in creation order, whatever their ids
+	lastQuestion := &types.Question{ID: uuid.MustParse("00000000-0000-4000-8000-000000000001"), Text: "Added last"}
+	sqlQuery = `INSERT INTO questions (id, text, retrospective_id) VALUES ($1, $2, $3)`
+	_, err = db.conn.Exec(sqlQuery, lastQuestion.ID, lastQuestion.Text, retro.ID)
+	assert.Nilf(t, err, "error creating question")
+
+	ctx := context.Background()
+	expireAt := time.Now().Add(24 * time.Hour).UTC()
+	err = db.SetRetrospectiveExpiry(ctx, retro.ID, expireAt)
+	assert.Nilf(t, err, "error setting expiry")
+
+	res, err := db.GetRetrospectiveSummary(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective summary")
+	assert.Equal(t, expireAt, res.ExpireAt)
+
+	expected := []types.QuestionSummary{
+		{ID: question.ID, Text: question.Text, AnswerCount: 2},
+		{ID: emptyQuestion.ID, Text: emptyQuestion.Text, AnswerCount: 0},
+		{ID: lastQuestion.ID, Text: lastQuestion.Text, AnswerCount: 0},
+	}
+	assert.Equal(t, expected, res.Questions)
+
+	body, err := json.Marshal(res)
+	assert.Nilf(t, err, "error encoding retrospective summary")
+	assert.NotContains(t, string(body), `"answers"`)
+	assert.Contains(t, string(body), `"answer_count":2`)
+}
+
+func TestGetAnswers(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+	// Past brainstorm, answers without an author are shown
+	err = db.UpdateRetrospectivePhase(context.Background(), &types.Retrospective{ID: retro.ID, Phase: types.PHASE_VOTING})
+	assert.Nilf(t, err, "error updating phase")
+
+	question, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+
+	answers := []types.Answer{
+		{ID: uuid.New(), QuestionID: question.ID, Text: "first", Position: 1, Version: 1},
+		{ID: uuid.New(), QuestionID: question.ID, Text: "second", Position: 2, Version: 1},
+	}
+
+	sqlQuery := `INSERT INTO answers (id, text, question_id, position) VALUES ($1, $2, $3, $4), ($5, $6, $7, $8)`
+	_, err = db.conn.Exec(
+		sqlQuery,
+		answers[1].ID, answers[1].Text, answers[1].QuestionID, answers[1].Position,
+		answers[0].ID, answers[0].Text, answers[0].QuestionID, answers[0].Position,
+	)
+	assert.Nilf(t, err, "error creating answers")
+
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	res, err := db.GetAnswers(ctx, question.ID)
+	assert.Nilf(t, err, "error getting answers")
+	assert.Equal(t, answers, res)
+
+	otherRetro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	ctx = context.WithValue(context.Background(), "retrospective_id", otherRetro.ID)
+	_, err = db.GetAnswers(ctx, question.ID)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestAnswerAuthorship(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	question, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	aliceCtx := context.WithValue(ctx, "session_id", "alice")
+	bobCtx := context.WithValue(ctx, "session_id", "bob")
+
+	aliceAnswer := &types.Answer{ID: uuid.New(), QuestionID: question.ID, Text: "from alice"}
+	err = db.CreateAnswer(aliceCtx, aliceAnswer)
+	assert.Nilf(t, err, "error creating answer")
+
+	bobAnswer := &types.Answer{ID: uuid.New(), QuestionID: question.ID, Text: "from bob"}
+	err = db.CreateAnswer(bobCtx, bobAnswer)
+	assert.Nilf(t, err, "error creating answer")
+
+	mine := func(ctx context.Context) map[uuid.UUID]bool {
+		res, err := db.GetRetrospective(ctx, retro.ID)
+		assert.Nilf(t, err, "error getting retrospective")
+
+		flags := make(map[uuid.UUID]bool)
+		for _, answer := range res.Questions[0].Answers {
+			flags[answer.ID] = answer.Mine
+		}
+		return flags
+	}
+
+	// During brainstorm each session only sees its own answers
+	assert.Equal(t, map[uuid.UUID]bool{aliceAnswer.ID: true}, mine(aliceCtx))
+	assert.Equal(t, map[uuid.UUID]bool{bobAnswer.ID: true}, mine(bobCtx))
+	assert.Empty(t, mine(ctx))
+
+	// So do the reads of a single question or answer
+	answers, err := db.GetAnswers(bobCtx, question.ID)
+	assert.Nilf(t, err, "error getting answers")
+	if assert.Len(t, answers, 1) {
+		assert.Equal(t, bobAnswer.ID, answers[0].ID)
+	}
+	_, err = db.GetAnswer(bobCtx, aliceAnswer.ID)
+	assert.Equal(t, sql.ErrNoRows, err, "another session's answer should be hidden")
+	answer, err := db.GetAnswer(aliceCtx, aliceAnswer.ID)
+	assert.Nilf(t, err, "error getting answer")
+	assert.True(t, answer.Mine)
+
+	err = db.UpdateRetrospectivePhase(ctx, &types.Retrospective{ID: retro.ID, Phase: types.PHASE_VOTING})
+	assert.Nilf(t, err, "error updating phase")
+
+	assert.Equal(t, map[uuid.UUID]bool{aliceAnswer.ID: true, bobAnswer.ID: false}, mine(aliceCtx))
+	assert.Equal(t, map[uuid.UUID]bool{aliceAnswer.ID: false, bobAnswer.ID: true}, mine(bobCtx))
+	assert.Equal(t, map[uuid.UUID]bool{aliceAnswer.ID: false, bobAnswer.ID: false}, mine(ctx))
+	answers, err = db.GetAnswers(bobCtx, question.ID)
+	assert.Nilf(t, err, "error getting answers")
+	assert.Len(t, answers, 2)
+	_, err = db.GetAnswer(bobCtx, aliceAnswer.ID)
+	assert.Nilf(t, err, "error getting answer")
+
+	// Without the phases feature nothing is hidden
+	err = db.UpdateRetrospectivePhase(ctx, &types.Retrospective{ID: retro.ID, Phase: types.PHASE_BRAINSTORM})
+	assert.Nilf(t, err, "error updating phase")
+	config.Get().Features.Phases = false
+	assert.Len(t, mine(aliceCtx), 2)
+}
+
+func TestGetRetrospectiveConcurrentWrites(t *testing.T) {
+	db := newTestRepo(t)
+
+	// With a single connection a result set left open while running another
+	// query blocks forever, and reads and writes can't hit each other's locks
+	db.conn.SetMaxOpenConns(1)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	questions := make([]*types.Question, 3)
+	for i := range questions {
+		questions[i], err = createGenericQuestion(db, retro)
+		assert.Nilf(t, err, "error creating question")
+		_, err = createGenericAnswer(db, questions[i])
+		assert.Nilf(t, err, "error creating answer")
+	}
+
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	const iterations = 50
+
+	done := make(chan struct{})
+	readErrs := make(chan error, iterations)
+	go func() {
+		defer close(done)
+		for i := 0; i < iterations; i++ {
+			if _, err := db.GetRetrospective(ctx, retro.ID); err != nil {
+				readErrs <- err
+			}
+		}
+	}()
+
+	for i := 0; i < iterations; i++ {
+		answer := &types.Answer{ID: uuid.New(), QuestionID: questions[i%len(questions)].ID, Text: "concurrent"}
+		err := db.CreateAnswer(ctx, answer)
+		assert.Nilf(t, err, "error creating answer while reading")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("getting the retrospective is stuck on its own result sets")
+	}
+
+	close(readErrs)
+	for err := range readErrs {
+		assert.Nilf(t, err, "error getting retrospective while writing")
+	}
+
+	res, err := db.GetRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Len(t, res.Questions, len(questions))
+}
+
+func TestConcurrentWritesWAL(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	// WAL needs an on-disk database, a memory one ignores the journal mode.
+	// With the shared cache writers fail right away on table locks instead
+	// of waiting for the busy timeout.
+	conf.Database.Address = filepath.Join(t.TempDir(), "wal.db")
+	conf.Database.Cache = "private"
+	conf.Database.JournalMode = "WAL"
+	conf.Database.BusyTimeoutMs = 5000
+
+	db, err := NewSQLite()
+	assert.Nilf(t, err, "error connecting to database")
+	t.Cleanup(func() { db.conn.Close() })
+
+	var journalMode string
+	err = db.conn.QueryRow(`PRAGMA journal_mode`).Scan(&journalMode)
+	assert.Nilf(t, err, "error reading journal mode")
+	assert.Equal(t, "wal", journalMode)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+
+	const workers, iterations = 8, 20
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*iterations*2)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				question := &types.Question{ID: uuid.New(), Text: "concurrent"}
+				if err := db.CreateQuestion(ctx, question); err != nil {
+					errs <- err
+				}
+				if _, err := db.GetRetrospective(ctx, retro.ID); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.Nilf(t, err, "error creating or reading concurrently")
+	}
+
+	res, err := db.GetRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Len(t, res.Questions, workers*iterations)
+}
+
+func TestCancelledContext(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), "retrospective_id", retro.ID))
+	cancel()
+
+	start := time.Now()
+	_, err = db.GetRetrospective(ctx, retro.ID)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	err = db.CreateQuestion(ctx, &types.Question{ID: uuid.New(), Text: "cancelled"})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = db.DeleteRetrospective(ctx, retro.ID)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Nothing was written with the cancelled context
+	res, err := db.GetRetrospective(context.Background(), retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Empty(t, res.Questions)
+}
+
+func TestIdempotentResponses(t *testing.T) {
+	db := newTestRepo(t)
+
+	ctx := context.WithValue(context.Background(), "session_id", uuid.NewString())
+	key := uuid.NewString()
+	response := &types.IdempotentResponse{Route: "POST /api/answer", Status: 200, Body: []byte(`{"id": 1}`)}
+
+	start := time.Now().UTC()
+	reserved, err := db.ReserveIdempotencyKey(ctx, key, response.Route, start.Add(-time.Minute))
+	assert.Nilf(t, err, "error reserving key")
+	assert.True(t, reserved)
+
+	reserved, err = db.ReserveIdempotencyKey(ctx, key, response.Route, start.Add(-time.Minute))
+	assert.Nilf(t, err, "error reserving key")
+	assert.False(t, reserved, "a key can only be reserved once")
+
+	pending, err := db.GetIdempotentResponse(ctx, key, start.Add(-time.Minute))
+	assert.Nilf(t, err, "error getting pending response")
+	assert.Equal(t, 0, pending.Status, "a reserved key has no response yet")
+
+	err = db.ReleaseIdempotencyKey(ctx, key)
+	assert.Nilf(t, err, "error releasing key")
+	reserved, err = db.ReserveIdempotencyKey(ctx, key, response.Route, start.Add(-time.Minute))
+	assert.Nilf(t, err, "error reserving key")
+	assert.True(t, reserved, "a released key can be reserved again")
+
+	err = db.SaveIdempotentResponse(ctx, key, response)
+	assert.Nilf(t, err, "error saving response")
+
+	err = db.ReleaseIdempotencyKey(ctx, key)
+	assert.Nilf(t, err, "error releasing key")
+
+	stored, err := db.GetIdempotentResponse(ctx, key, start.Add(-time.Minute))
+	assert.Nilf(t, err, "error getting response")
+	assert.Equal(t, response, stored)
+
+	_, err = db.GetIdempotentResponse(ctx, key, time.Now().UTC().Add(time.Minute))
+	assert.Equal(t, sql.ErrNoRows, err, "expired responses are ignored")
+
+	reserved, err = db.ReserveIdempotencyKey(ctx, key, response.Route, start.Add(-time.Minute))
+	assert.Nilf(t, err, "error reserving key")
+	assert.False(t, reserved, "a saved response keeps its key")
+
+	otherSession := context.WithValue(context.Background(), "session_id", uuid.NewString())
+	_, err = db.GetIdempotentResponse(otherSession, key, start.Add(-time.Minute))
+	assert.Equal(t, sql.ErrNoRows, err, "responses are scoped to the session")
+
+	deleted, err := db.DeleteIdempotentResponses(ctx, time.Now().UTC().Add(time.Minute))
+	assert.Nilf(t, err, "error deleting responses")
+	assert.GreaterOrEqual(t, deleted, 1)
+
+	_, err = db.GetIdempotentResponse(ctx, key, start.Add(-time.Minute))
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestGetEmptyRetrospectives(t *testing.T) {
+	db := newTestRepo(t)
+
+	emptyRetro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	usedRetro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	formerRetro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	ctx := context.WithValue(context.Background(), "retrospective_id", usedRetro.ID)
+	err = db.CreateQuestion(ctx, &types.Question{ID: uuid.New(), Text: "still here"})
+	assert.Nilf(t, err, "error creating question")
+
+	// A retrospective which had content must survive even after it is emptied
+	question := &types.Question{ID: uuid.New(), Text: "removed later"}
+	ctx = context.WithValue(context.Background(), "retrospective_id", formerRetro.ID)
+	err = db.CreateQuestion(ctx, question)
+	assert.Nilf(t, err, "error creating question")
+	_, err = db.DeleteQuestion(ctx, question.ID)
+	assert.Nilf(t, err, "error deleting question")
+
+	res, err := db.GetEmptyRetrospectives(context.Background(), time.Now().Add(time.Minute))
+	assert.Nilf(t, err, "error getting empty retrospectives")
+	assert.Contains(t, res, emptyRetro.ID)
+	assert.NotContains(t, res, usedRetro.ID)
+	assert.NotContains(t, res, formerRetro.ID)
+
+	res, err = db.GetEmptyRetrospectives(context.Background(), time.Now().Add(-time.Hour))
+	assert.Nilf(t, err, "error getting empty retrospectives")
+	assert.NotContains(t, res, emptyRetro.ID)
+
+	// Dates are stored in UTC, a local date ahead of it must not match them
+	local := time.Now().Add(-time.Hour).In(time.FixedZone("UTC+5", 5*60*60))
+	res, err = db.GetEmptyRetrospectives(context.Background(), local)
+	assert.Nilf(t, err, "error getting empty retrospectives")
+	assert.NotContains(t, res, emptyRetro.ID)
+}
+
+func TestGetOldRetrospectives(t *testing.T) {
+	db := newTestRepo(t)
+	ctx := context.Background()
+
+	now := time.Now().UTC()
+	expired := &types.Retrospective{ID: uuid.New(), Name: "expired", CreatedAt: now, ExpireAt: now.Add(-time.Hour)}
+	kept := &types.Retrospective{ID: uuid.New(), Name: "kept", CreatedAt: now, ExpireAt: now.Add(time.Hour)}
+	for _, retro := range []*types.Retrospective{expired, kept} {
+		err := db.CreateRetrospective(ctx, retro)
+		assert.Nilf(t, err, "error creating retrospective")
+	}
+
+	res, err := db.GetRetrospective(ctx, kept.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Equal(t, kept.ExpireAt, res.ExpireAt, "the expiry should be stored on creation")
+
+	ids, err := db.GetOldRetrospectives(ctx, now)
+	assert.Nilf(t, err, "error getting old retrospectives")
+	assert.Equal(t, []uuid.UUID{expired.ID}, ids)
+
+	err = db.SetRetrospectiveExpiry(ctx, expired.ID, now.Add(2*time.Hour))
+	assert.Nilf(t, err, "error setting expiry")
+	ids, err = db.GetOldRetrospectives(ctx, now)
+	assert.Nilf(t, err, "error getting old retrospectives")
+	assert.Empty(t, ids)
+
+	ids, err = db.GetOldRetrospectives(ctx, now.Add(90*time.Minute))
+	assert.Nilf(t, err, "error getting old retrospectives")
+	assert.Equal(t, []uuid.UUID{kept.ID}, ids)
+
+	err = db.SetRetrospectiveExpiry(ctx, uuid.New(), now)
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestBackfillExpiry(t *testing.T) {
+	db := newTestRepo(t)
+	ctx := context.Background()
+
+	createdAt := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	legacy := uuid.New()
+	sqlQuery := `INSERT INTO retrospectives (id, name, description, created_at) VALUES ($1, $2, $3, $4)`
+	_, err := db.conn.Exec(sqlQuery, legacy, "legacy", "", createdAt)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	expireAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	stored := &types.Retrospective{ID: uuid.New(), Name: "stored", CreatedAt: createdAt, ExpireAt: expireAt}
+	err = db.CreateRetrospective(ctx, stored)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	err = db.backfillExpiry(ctx, 30*24*time.Hour)
+	assert.Nilf(t, err, "error backfilling expiry")
+
+	res, err := db.GetRetrospective(ctx, legacy)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Equal(t, createdAt.Add(30*24*time.Hour), res.ExpireAt)
+
+	res, err = db.GetRetrospective(ctx, stored.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Equal(t, expireAt, res.ExpireAt, "a stored expiry should be kept")
+}
+
+func TestUpdateTextRules(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	question, err := createGenericQuestion(db, retro)
+	assert.Nilf(t, err, "error creating question")
+
+	answer, err := createGenericAnswer(db, question)
+	assert.Nilf(t, err, "error creating answer")
+
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+
+	storedRetro := func() (string, string) {
+		var name, description string
+		err := db.conn.QueryRow(`SELECT name, description FROM retrospectives WHERE id = $1`, retro.ID).Scan(&name, &description)
+		assert.Nilf(t, err, "error getting retrospective")
+		return name, description
+	}
+	storedText := func(table string, id uuid.UUID) string {
+		var text string
+		err := db.conn.QueryRow(`SELECT text FROM `+table+` WHERE id = $1`, id).Scan(&text)
+		assert.Nilf(t, err, "error getting "+table)
+		return text
+	}
+
+	t.Run("whitespace only preserves", func(t *testing.T) {
+		err := db.UpdateRetrospective(ctx, &types.Retrospective{ID: retro.ID, Name: "  ", Description: "\n\t"})
+		assert.Nil(t, err)
+		name, description := storedRetro()
+		assert.Equal(t, retro.Name, name)
+		assert.Equal(t, retro.Description, description)
+
+		err = db.UpdateQuestion(ctx, &types.Question{ID: question.ID, Text: "   "})
+		assert.Nil(t, err)
+		assert.Equal(t, question.Text, storedText("questions", question.ID))
+
+		err = db.UpdateAnswer(ctx, &types.Answer{ID: answer.ID, QuestionID: question.ID, Text: " \n "})
+		assert.Nil(t, err)
+		assert.Equal(t, answer.Text, storedText("answers", answer.ID))
+	})
+
+	t.Run("non empty replaces trimmed", func(t *testing.T) {
+		err := db.UpdateRetrospective(ctx, &types.Retrospective{ID: retro.ID, Name: " New name ", Description: " New description\n"})
+		assert.Nil(t, err)
+		name, description := storedRetro()
+		assert.Equal(t, "New name", name)
+		assert.Equal(t, "New description", description)
+
+		err = db.UpdateQuestion(ctx, &types.Question{ID: question.ID, Text: " New question "})
+		assert.Nil(t, err)
+		assert.Equal(t, "New question", storedText("questions", question.ID))
+
+		err = db.UpdateAnswer(ctx, &types.Answer{ID: answer.ID, QuestionID: question.ID, Text: "New answer  "})
+		assert.Nil(t, err)
+		assert.Equal(t, "New answer", storedText("answers", answer.ID))
+	})
+
+	t.Run("identical text is a no-op", func(t *testing.T) {
+		updated := &types.Retrospective{ID: retro.ID, Name: "New name", Description: "New description"}
+		err := db.UpdateRetrospective(ctx, updated)
+		assert.Nil(t, err)
+		assert.Equal(t, "New name", updated.Name)
+
+		updatedQuestion := &types.Question{ID: question.ID, Text: "New question"}
+		err = db.UpdateQuestion(ctx, updatedQuestion)
+		assert.Nil(t, err)
+		assert.Equal(t, "New question", updatedQuestion.Text)
+
+		updatedAnswer := &types.Answer{ID: answer.ID, QuestionID: question.ID, Text: " New answer"}
+		err = db.UpdateAnswer(ctx, updatedAnswer)
+		assert.Nil(t, err)
+		assert.Equal(t, "New answer", updatedAnswer.Text)
+	})
+}
+
+// newMemorySQLite returns a repository on a fresh, empty memory database.
+func newMemorySQLite(t *testing.T) *SQLite {
+	// Each connection to a private memory database gets a new one
+	conn, err := sql.Open("sqlite3", ":memory:")
+	assert.Nilf(t, err, "error opening database")
+	conn.SetMaxOpenConns(1)
+	t.Cleanup(func() { conn.Close() })
+
+	return &SQLite{conn: conn}
+}
+
+func TestMigrate(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	db := newMemorySQLite(t)
+	ctx := context.Background()
+
+	err = db.Migrate(ctx)
+	assert.Nilf(t, err, "error applying migrations")
+	assert.Nil(t, db.Ping(ctx), "the migrations should create every table")
+
+	all, err := fs.Glob(database.Migrations, "migrations/*.sql")
+	assert.Nilf(t, err, "error listing migrations")
+
+	var applied int
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	assert.Nilf(t, err, "error counting applied migrations")
+	assert.Equal(t, len(all), applied)
+
+	err = db.Migrate(ctx)
+	assert.Nilf(t, err, "migrating again should be a no-op")
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied)
+	assert.Nilf(t, err, "error counting applied migrations")
+	assert.Equal(t, len(all), applied)
+}
+
+// baselineSchema is the schema.sql databases were created from before the
+// migrations, without a schema_migrations table.
+const baselineSchema = `
+CREATE TABLE IF NOT EXISTS retrospectives (
+    id          TEXT PRIMARY KEY,
+    name        TEXT,
+    description TEXT,
+    created_at  DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS questions (
+    id      TEXT PRIMARY KEY,
+    text    TEXT,
+    retrospective_id TEXT,
+    FOREIGN KEY(retrospective_id) REFERENCES retrospectives(id)
+);
+
+CREATE TABLE IF NOT EXISTS answers (
+    id       TEXT PRIMARY KEY,
+    text     TEXT,
+    position INTEGER,
+    question_id TEXT,
+    FOREIGN KEY(question_id) REFERENCES questions(id)
+);`
+
+func TestMigrateBaselineDatabase(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	db := newMemorySQLite(t)
+	ctx := context.Background()
+
+	_, err = db.conn.Exec(baselineSchema)
+	assert.Nilf(t, err, "error creating baseline schema")
+
+	legacy := uuid.New()
+	legacyQuestion := uuid.New()
+	_, err = db.conn.Exec(`INSERT INTO retrospectives (id, name, description) VALUES ($1, 'legacy', '')`, legacy)
+	assert.Nilf(t, err, "error creating retrospective")
+	_, err = db.conn.Exec(`INSERT INTO questions (id, text, retrospective_id) VALUES ($1, 'kept?', $2)`, legacyQuestion, legacy)
+	assert.Nilf(t, err, "error creating question")
+	_, err = db.conn.Exec(`INSERT INTO answers (id, text, position, question_id) VALUES ($1, 'yes', 1, $2)`, uuid.New(), legacyQuestion)
+	assert.Nilf(t, err, "error creating answer")
+
+	err = db.Migrate(ctx)
+	if !assert.Nilf(t, err, "error migrating baseline database") {
+		t.FailNow()
+	}
+
+	res, err := db.GetRetrospective(ctx, legacy)
+	assert.Nilf(t, err, "error getting legacy retrospective")
+	assert.Equal(t, types.PHASE_DISCUSSION, res.Phase, "existing answers should stay visible")
+	if assert.Len(t, res.Questions, 1) && assert.Len(t, res.Questions[0].Answers, 1) {
+		answer := res.Questions[0].Answers[0]
+		assert.Equal(t, 1, answer.Version)
+		assert.Equal(t, "", answer.Color)
+	}
+	empty, err := db.GetEmptyRetrospectives(ctx, time.Now().Add(time.Hour))
+	assert.Nilf(t, err, "error getting empty retrospectives")
+	assert.NotContains(t, empty, legacy, "a retrospective with questions had content")
+
+	retro := &types.Retrospective{ID: uuid.New(), Name: "new", Phase: types.PHASE_BRAINSTORM, Private: true, CreatedAt: time.Now().UTC(), ExpireAt: time.Now().Add(time.Hour).UTC()}
+	err = db.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	ctx = context.WithValue(ctx, "retrospective_id", retro.ID)
+	ctx = context.WithValue(ctx, "session_id", uuid.NewString())
+	question := &types.Question{ID: uuid.New(), Text: "how was it?"}
+	err = db.CreateQuestion(ctx, question)
+	assert.Nilf(t, err, "error creating question")
+	answer := &types.Answer{ID: uuid.New(), QuestionID: question.ID, Text: "fine", Color: "green"}
+	err = db.CreateAnswer(ctx, answer)
+	assert.Nilf(t, err, "error creating answer")
+
+	res, err = db.GetRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.True(t, res.Private)
+	assert.Equal(t, retro.ExpireAt, res.ExpireAt)
+	if assert.Len(t, res.Questions, 1) && assert.Len(t, res.Questions[0].Answers, 1) {
+		got := res.Questions[0].Answers[0]
+		assert.Equal(t, "fine", got.Text)
+		assert.Equal(t, "green", got.Color)
+		assert.True(t, got.Mine, "the author should be recorded")
+	}
+}
+
+func TestApplyMigrations(t *testing.T) {
+	db := newMemorySQLite(t)
+	ctx := context.Background()
+
+	// Without IF NOT EXISTS, running a migration twice fails
+	migrations := fstest.MapFS{
+		"0001_notes.sql": {Data: []byte(`CREATE TABLE notes (id TEXT PRIMARY KEY);`)},
+	}
+	err := db.applyMigrations(ctx, migrations)
+	assert.Nilf(t, err, "error applying first migration")
+
+	migrations["0010_note_text.sql"] = &fstest.MapFile{Data: []byte(`ALTER TABLE notes ADD COLUMN text TEXT;`)}
+	migrations["0002_tags.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE tags (id TEXT PRIMARY KEY);`)}
+	err = db.applyMigrations(ctx, migrations)
+	assert.Nilf(t, err, "only the new migrations should be applied")
+
+	var versions []int
+	rows, err := db.conn.Query(`SELECT version FROM schema_migrations ORDER BY applied_at, version`)
+	assert.Nilf(t, err, "error listing applied migrations")
+	for rows.Next() {
+		var version int
+		assert.Nil(t, rows.Scan(&version))
+		versions = append(versions, version)
+	}
+	rows.Close()
+	assert.Equal(t, []int{1, 2, 10}, versions)
+
+	// A failing migration isn't recorded, nor are its first statements kept
+	migrations["0011_broken.sql"] = &fstest.MapFile{Data: []byte(`CREATE TABLE broken (id TEXT); INSERT INTO missing VALUES (1);`)}
+	err = db.applyMigrations(ctx, migrations)
+	assert.ErrorContains(t, err, "0011_broken.sql")
+
+	var tables int
+	err = db.conn.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'broken'`).Scan(&tables)
+	assert.Nilf(t, err, "error looking for the table")
+	assert.Zero(t, tables)
+
+	migrations["0011_other.sql"] = &fstest.MapFile{Data: []byte(``)}
+	err = db.applyMigrations(ctx, migrations)
+	assert.ErrorContains(t, err, "have the same version")
+}
+
+func TestGetRetrospectiveStats(t *testing.T) {
+	db := newTestRepo(t)
+
+	retro, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+	other, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	expected := &types.RetrospectiveStats{ID: retro.ID, QuestionCount: 3, AnswerCount: 4}
+	for _, answers := range []int{3, 0, 1} {
+		question, err := createGenericQuestion(db, retro)
+		assert.Nilf(t, err, "error creating question")
+		for i := 0; i < answers; i++ {
+			_, err := createGenericAnswer(db, question)
+			assert.Nilf(t, err, "error creating answer")
+		}
+		expected.AnswersPerQuestion = append(expected.AnswersPerQuestion, types.QuestionSummary{
+			ID:          question.ID,
+			Text:        question.Text,
+			AnswerCount: answers,
+		})
+	}
+
+	question, err := createGenericQuestion(db, other)
+	assert.Nilf(t, err, "error creating question")
+	_, err = createGenericAnswer(db, question)
+	assert.Nilf(t, err, "error creating answer")
+
+	ctx := context.Background()
+	stats, err := db.GetRetrospectiveStats(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting stats")
+	assert.Equal(t, expected, stats)
+
+	empty, err := createGenericRetrospective(db)
+	assert.Nilf(t, err, "error creating retrospective")
+	stats, err = db.GetRetrospectiveStats(ctx, empty.ID)
+	assert.Nilf(t, err, "error getting stats")
+	assert.Equal(t, &types.RetrospectiveStats{ID: empty.ID, AnswersPerQuestion: []types.QuestionSummary{}}, stats)
+
+	_, err = db.GetRetrospectiveStats(ctx, uuid.New())
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestSearchRetrospectives(t *testing.T) {
+	db := newTestRepo(t)
+	ctx := context.Background()
+
+	// Created a day apart, the last one the most recent
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	names := []string{"Sprint 1", "100% done", "under_score", "sprint 2", "Planning"}
+	retros := make([]*types.Retrospective, len(names))
+	for i, name := range names {
+		createdAt := start.Add(time.Duration(i) * 24 * time.Hour)
+		retros[i] = &types.Retrospective{ID: uuid.New(), Name: name, CreatedAt: createdAt, ExpireAt: createdAt.Add(time.Hour)}
+		err := db.CreateRetrospective(ctx, retros[i])
+		assert.Nilf(t, err, "error creating retrospective")
+	}
+
+	question, err := createGenericQuestion(db, retros[0])
+	assert.Nilf(t, err, "error creating question")
+	for i := 0; i < 2; i++ {
+		_, err := createGenericAnswer(db, question)
+		assert.Nilf(t, err, "error creating answer")
+	}
+
+	listed := func(search types.RetrospectiveSearch) []string {
+		list, err := db.SearchRetrospectives(ctx, search)
+		if !assert.Nilf(t, err, "error searching retrospectives") {
+			return nil
+		}
+		res := []string{}
+		for _, retro := range list.Retrospectives {
+			res = append(res, retro.Name)
+		}
+		return res
+	}
+
+	list, err := db.SearchRetrospectives(ctx, types.RetrospectiveSearch{Search: "SPRINT", Page: 1, Size: 10})
+	assert.Nilf(t, err, "error searching retrospectives")
+	assert.Equal(t, 2, list.Total)
+	if assert.Len(t, list.Retrospectives, 2) {
+		assert.Equal(t, "sprint 2", list.Retrospectives[0].Name, "the most recent should come first")
+		assert.Equal(t, types.RetrospectiveListing{
+			ID:            retros[0].ID,
+			Name:          "Sprint 1",
+			CreatedAt:     retros[0].CreatedAt,
+			ExpireAt:      retros[0].ExpireAt,
+			QuestionCount: 1,
+			AnswerCount:   2,
+		}, list.Retrospectives[1])
+	}
+
+	// Wildcards are matched literally
+	assert.Equal(t, []string{"100% done"}, listed(types.RetrospectiveSearch{Search: "%", Page: 1, Size: 10}))
+	assert.Equal(t, []string{"under_score"}, listed(types.RetrospectiveSearch{Search: "_", Page: 1, Size: 10}))
+	assert.Empty(t, listed(types.RetrospectiveSearch{Search: `\`, Page: 1, Size: 10}))
+
+	assert.Equal(t, []string{"Planning", "sprint 2"}, listed(types.RetrospectiveSearch{Page: 1, Size: 2}))
+	assert.Equal(t, []string{"under_score", "100% done"}, listed(types.RetrospectiveSearch{Page: 2, Size: 2}))
+	assert.Equal(t, []string{"Sprint 1"}, listed(types.RetrospectiveSearch{Page: 3, Size: 2}))
+
+	list, err = db.SearchRetrospectives(ctx, types.RetrospectiveSearch{Page: 4, Size: 2})
+	assert.Nilf(t, err, "error searching retrospectives")
+	assert.Equal(t, 5, list.Total, "the total should not depend on the page")
+	assert.Empty(t, list.Retrospectives)
+}
+
+func TestDeleteEvents(t *testing.T) {
+	db := newTestRepo(t)
+	ctx := context.Background()
+
+	retroID := uuid.New()
+	message := &types.WebSocketMessage{Action: "create", Type: "question", Value: types.Object{ID: uuid.New()}}
+	err := db.AppendEvent(ctx, retroID, message)
+	assert.Nilf(t, err, "error appending event")
+
+	deleted, err := db.DeleteEvents(ctx, time.Now().UTC().Add(-time.Minute))
+	assert.Nilf(t, err, "error deleting events")
+	assert.Equal(t, 0, deleted, "recent events should be kept")
+
+	deleted, err = db.DeleteEvents(ctx, time.Now().UTC().Add(time.Minute))
+	assert.Nilf(t, err, "error deleting events")
+	assert.Equal(t, 1, deleted)
+
+	events, err := db.GetEventsSince(ctx, retroID, 0, 10)
+	assert.Nilf(t, err, "error getting events")
+	assert.Empty(t, events)
+}
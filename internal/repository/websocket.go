@@ -1,22 +1,40 @@
 package repository
 
 import (
+	"api/config"
+	"api/internal/metrics"
 	"api/types"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
 )
 
+var ErrTooManyConnections = errors.New("too many connections")
+
+// ErrInvalidCursor is returned when the since query parameter isn't a
+// sequence number.
+var ErrInvalidCursor = errors.New("invalid since cursor")
+
 type WebSocket struct {
-	connections map[uuid.UUID][]*websocket.Conn
+	mu          sync.Mutex
+	connections map[uuid.UUID][]*client
+	total       int
+	logger      *zap.Logger
+	// events logs the broadcast messages for reconnecting clients, publish
+	// keeps the log and the broadcasts in the same order
+	events  EventLog
+	publish sync.Mutex
 }
 
 var upgrader = websocket.Upgrader{
@@ -25,31 +43,118 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true
 	},
+	Subprotocols: []string{protocolV2, protocolV1},
 }
 
-// AddConnection implements WebSocketRepository.
+// AddConnection implements Broadcaster.
 func (ws *WebSocket) AddConnection(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	retrospectiveID, ok := ctx.Value("retrospective_id").(uuid.UUID)
 	if !ok {
 		return fmt.Errorf("retrospective id not found")
 	}
 
+	// Reserve a slot before upgrading, so the client can still be told why
+	// it was refused
+	ws.mu.Lock()
+	if _, ok := ws.connections[retrospectiveID]; !ok {
+		ws.mu.Unlock()
+		return fmt.Errorf("retrospective doesn't exist")
+	}
+
+	maxConnections := config.Get().Server.MaxConnections
+	if maxConnections > 0 && ws.total >= maxConnections {
+		ws.mu.Unlock()
+		metrics.WebSocketRejected.Inc()
+		return ErrTooManyConnections
+	}
+	ws.total++
+	ws.mu.Unlock()
+
+	defer func() {
+		ws.mu.Lock()
+		ws.total--
+		ws.mu.Unlock()
+	}()
+
+	// Clients rendering their own changes right away can ask not to get
+	// them back
+	session, _ := ctx.Value("session_id").(string)
+	suppressEcho, _ := strconv.ParseBool(r.URL.Query().Get("suppress_echo"))
+
+	// Reconnecting clients send the seq of the last message they got
+	var since int64
+	replay := ws.events != nil && r.URL.Query().Has("since")
+	if replay {
+		var err error
+		since, err = strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+		if err != nil || since < 0 {
+			return ErrInvalidCursor
+		}
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return err
 	}
+	client := newClient(conn, session, suppressEcho)
 
-	if _, ok := ws.connections[retrospectiveID]; !ok {
-		return fmt.Errorf("retrospective doesn't exist")
+	// Holding publish, no message is broadcast between the replay and the
+	// registration of the client
+	ws.publish.Lock()
+	if replay {
+		missed, err := ws.replay(ctx, retrospectiveID, since)
+		if err != nil {
+			ws.logger.Error("error replaying events", zap.Stringer("retrospective_id", retrospectiveID), zap.Error(err))
+			missed = []types.WebSocketMessage{{Action: "reload", Type: "retrospective"}}
+		}
+		for _, message := range missed {
+			if !client.receives(message) {
+				continue
+			}
+			messages, err := client.messagesFor(message)
+			if err != nil {
+				ws.logger.Error("error downgrading message", zap.Stringer("retrospective_id", retrospectiveID), zap.Error(err))
+				continue
+			}
+			for _, message := range messages {
+				client.enqueue(message)
+			}
+		}
 	}
 
+	ws.mu.Lock()
 	i := len(ws.connections[retrospectiveID])
-	ws.connections[retrospectiveID] = append(ws.connections[retrospectiveID], conn)
+	ws.connections[retrospectiveID] = append(ws.connections[retrospectiveID], client)
+	ws.mu.Unlock()
+	ws.publish.Unlock()
+
+	metrics.WebSocketConnections.Inc()
+	defer metrics.WebSocketConnections.Dec()
+
+	// Any message or pong from the client counts as activity
+	conf := config.Get().WebSocket
+	idleTimeout := time.Duration(conf.IdleTimeoutSeconds) * time.Second
+	readDeadline := func() time.Time {
+		if idleTimeout <= 0 {
+			return time.Time{}
+		}
+		return time.Now().Add(idleTimeout)
+	}
+	conn.SetPongHandler(func(string) error {
+		client.seen()
+		return conn.SetReadDeadline(readDeadline())
+	})
+
+	// Clients only send pings and typing notices, larger messages end the
+	// connection with a close frame
+	conn.SetReadLimit(conf.MaxMessageBytes)
+
+	go client.write(ws.logger, retrospectiveID, time.Duration(conf.PingIntervalSeconds)*time.Second, idleTimeout)
 
 	for {
-		err := conn.SetReadDeadline(time.Now().Add(30 * time.Second))
+		err := conn.SetReadDeadline(readDeadline())
 		if err != nil {
-			fmt.Println(err)
+			ws.logger.Error("error setting read deadline", zap.Stringer("retrospective_id", retrospectiveID), zap.Error(err))
 			break
 		}
 
@@ -57,40 +162,88 @@ func (ws *WebSocket) AddConnection(ctx context.Context, w http.ResponseWriter, r
 		err = conn.ReadJSON(&message)
 
 		if err == nil {
-			if message.Type == "ping" {
-				errWrite := conn.WriteJSON(types.WebSocketMessage{Type: "pong"})
-				if errWrite != nil {
-					fmt.Println(errWrite)
+			client.seen()
+			switch message.Type {
+			case "ping":
+				if !client.enqueue(types.WebSocketMessage{Type: "pong"}) {
+					ws.logger.Warn("error sending pong, send buffer full", zap.Stringer("retrospective_id", retrospectiveID))
 				}
+			case "typing":
+				ws.relayTyping(retrospectiveID, client, message)
+			default:
+				// Unknown types are ignored, they may come from newer clients
 			}
 			continue
 		}
 
-		if netErr, ok := err.(net.Error); (ok && netErr.Timeout()) || websocket.IsUnexpectedCloseError(err) ||
-			errors.Is(err, io.EOF) {
+		// A malformed message doesn't break the connection
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) {
+			ws.logger.Warn("error reading message", zap.Stringer("retrospective_id", retrospectiveID), zap.Error(err))
+			continue
+		}
+
+		if errors.Is(err, websocket.ErrReadLimit) {
+			ws.logger.Debug("message too large, closing connection", zap.Stringer("retrospective_id", retrospectiveID))
 			break
 		}
 
-		fmt.Println(err)
+		if netErr, ok := err.(net.Error); !(ok && netErr.Timeout()) && !websocket.IsCloseError(err) &&
+			!websocket.IsUnexpectedCloseError(err) && !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+			ws.logger.Warn("error reading message", zap.Stringer("retrospective_id", retrospectiveID), zap.Error(err))
+		}
+		break
 	}
-	conn.Close()
-	ws.connections[retrospectiveID][i] = nil
+	client.close()
+
+	ws.mu.Lock()
+	// The retrospective may have been deleted meanwhile
+	if connections := ws.connections[retrospectiveID]; i < len(connections) && connections[i] == client {
+		connections[i] = nil
+	}
+	ws.mu.Unlock()
 
 	return nil
 }
 
-// GetRetrospective implements WebSocketRepository.
-func (*WebSocket) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
-	panic("unimplemented")
+// ConnectionCount implements Broadcaster.
+func (ws *WebSocket) ConnectionCount() int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.total
 }
 
-func NewWebSocket() (*WebSocket, error) {
-	connections := make(map[uuid.UUID][]*websocket.Conn)
+// NewWebSocket creates a Broadcaster logging the messages to events, which
+// may be nil to disable replaying them.
+func NewWebSocket(logger *zap.Logger, events EventLog) (*WebSocket, error) {
+	connections := make(map[uuid.UUID][]*client)
 	return &WebSocket{
 		connections: connections,
+		logger:      logger,
+		events:      events,
 	}, nil
 }
 
+// relayTyping forwards a typing message to the other subscribers of the
+// retrospective. It isn't stored, and malformed ones are dropped.
+func (w *WebSocket) relayTyping(retrospectiveID uuid.UUID, sender *client, message types.WebSocketMessage) {
+	value, _ := message.Value.(map[string]interface{})
+	answerID, _ := value["answer_id"].(string)
+	id, err := uuid.Parse(answerID)
+	if err != nil {
+		w.logger.Warn("invalid typing message", zap.Stringer("retrospective_id", retrospectiveID), zap.Error(err))
+		return
+	}
+
+	typing := types.WebSocketMessage{
+		Type:  "typing",
+		Value: types.Typing{AnswerID: id},
+	}
+	w.broadcast(context.Background(), typing, retrospectiveID, sender)
+}
+
 func (w *WebSocket) sendMessageToRetro(ctx context.Context, message types.WebSocketMessage, retrospectiveID *uuid.UUID) error {
 	if retrospectiveID == nil {
 		id, ok := ctx.Value("retrospective_id").(uuid.UUID)
@@ -100,25 +253,106 @@ func (w *WebSocket) sendMessageToRetro(ctx context.Context, message types.WebSoc
 		retrospectiveID = &id
 	}
 
-	connections := w.connections[*retrospectiveID]
-	if connections == nil {
-		return nil
+	// Only the author gets the answers hidden during brainstorm
+	if author, ok := ctx.Value("author_only").(string); ok {
+		if author == "" {
+			return nil
+		}
+		message.Author = author
 	}
 
-	for _, conn := range connections {
-		if conn == nil {
+	w.publish.Lock()
+	defer w.publish.Unlock()
+
+	// A message missing from the log is still sent to the connected clients
+	if w.events != nil {
+		err := w.events.AppendEvent(ctx, *retrospectiveID, &message)
+		if err != nil {
+			w.logger.Error("error logging event",
+				zap.Any("request_id", ctx.Value("request_id")),
+				zap.Stringer("retrospective_id", *retrospectiveID),
+				zap.Error(err),
+			)
+		}
+	}
+
+	w.broadcast(ctx, message, *retrospectiveID, nil)
+	return nil
+}
+
+// replay returns the messages of the retrospective logged after the
+// sequence number. When there are more than the send buffer can hold, it
+// returns a single message asking the client to reload the retrospective.
+func (w *WebSocket) replay(ctx context.Context, retrospectiveID uuid.UUID, since int64) ([]types.WebSocketMessage, error) {
+	limit := sendBufferSize / 2
+	events, err := w.events.GetEventsSince(ctx, retrospectiveID, since, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(events) > limit {
+		return []types.WebSocketMessage{{Action: "reload", Type: "retrospective"}}, nil
+	}
+	return events, nil
+}
+
+// broadcast queues the message for every subscriber of the retrospective,
+// except the given one when set, the ones suppressing the echo of the
+// session in the context and the ones of other sessions than its author.
+// Clients whose version predates the message get its equivalents.
+func (w *WebSocket) broadcast(ctx context.Context, message types.WebSocketMessage, retrospectiveID uuid.UUID, except *client) {
+	origin, _ := ctx.Value("session_id").(string)
+
+	w.mu.Lock()
+	clients := append([]*client(nil), w.connections[retrospectiveID]...)
+	w.mu.Unlock()
+
+	for _, client := range clients {
+		if client == nil || client == except || client.echoOf(origin) || !client.receives(message) {
 			continue
 		}
-		err := conn.WriteJSON(message)
+		messages, err := client.messagesFor(message)
 		if err != nil {
-			log.Printf("Error sending message %+v to connection: %v", message, err)
+			w.logger.Error("error downgrading message",
+				zap.Any("request_id", ctx.Value("request_id")),
+				zap.Stringer("retrospective_id", retrospectiveID),
+				zap.Error(err),
+			)
+			continue
+		}
+		if !client.enqueueAll(messages) {
+			w.logger.Warn("send buffer of connection full, dropping it",
+				zap.Any("request_id", ctx.Value("request_id")),
+				zap.Stringer("retrospective_id", retrospectiveID),
+				zap.String("action", message.Action),
+				zap.String("type", message.Type),
+			)
+			// The client can't keep up, closing it ends its read loop
+			client.close()
 		}
 	}
+}
 
-	return nil
+// writeMessage sends a message bounded by the configured write timeout, so a
+// client that stopped reading can't block the caller forever.
+func writeMessage(conn *websocket.Conn, message types.WebSocketMessage) error {
+	if err := conn.SetWriteDeadline(writeDeadline()); err != nil {
+		return err
+	}
+	return conn.WriteJSON(message)
 }
 
-// CreateAnswer implements Repository.
+// writeDeadline returns the deadline for a write starting now, or the zero
+// time when no write timeout is configured.
+func writeDeadline() time.Time {
+	timeout := time.Duration(config.Get().WebSocket.WriteTimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(timeout)
+}
+
+// CreateAnswer implements Writer.
 func (w *WebSocket) CreateAnswer(ctx context.Context, answer *types.Answer) error {
 	message := types.WebSocketMessage{
 		Action: "create",
@@ -129,7 +363,18 @@ func (w *WebSocket) CreateAnswer(ctx context.Context, answer *types.Answer) erro
 	return w.sendMessageToRetro(ctx, message, nil)
 }
 
-// CreateQuestion implements Repository.
+// CreateAnswers implements Writer. The answers are sent in a single message.
+func (w *WebSocket) CreateAnswers(ctx context.Context, answers []*types.Answer) error {
+	message := types.WebSocketMessage{
+		Action: "create_many",
+		Type:   "answer",
+		Value:  answers,
+	}
+
+	return w.sendMessageToRetro(ctx, message, nil)
+}
+
+// CreateQuestion implements Writer.
 func (w *WebSocket) CreateQuestion(ctx context.Context, question *types.Question) error {
 	message := types.WebSocketMessage{
 		Action: "create",
@@ -140,7 +385,18 @@ func (w *WebSocket) CreateQuestion(ctx context.Context, question *types.Question
 	return w.sendMessageToRetro(ctx, message, nil)
 }
 
-// DeleteAnswer implements Repository.
+// CreateQuestions implements Writer.
+func (w *WebSocket) CreateQuestions(ctx context.Context, questions []*types.Question) error {
+	message := types.WebSocketMessage{
+		Action: "create_many",
+		Type:   "question",
+		Value:  questions,
+	}
+
+	return w.sendMessageToRetro(ctx, message, nil)
+}
+
+// DeleteAnswer implements Writer.
 func (w *WebSocket) DeleteAnswer(ctx context.Context, answer *types.Answer) error {
 	message := types.WebSocketMessage{
 		Action: "delete",
@@ -151,7 +407,37 @@ func (w *WebSocket) DeleteAnswer(ctx context.Context, answer *types.Answer) erro
 	return w.sendMessageToRetro(ctx, message, nil)
 }
 
-// DeleteQuestion implements Repository.
+// MergeAnswers implements Writer.
+func (w *WebSocket) MergeAnswers(ctx context.Context, source *types.Answer, target *types.Answer) error {
+	// Mine is relative to whoever merged the answers
+	answer := *target
+	answer.Mine = false
+
+	message := types.WebSocketMessage{
+		Action: "merge",
+		Type:   "answer",
+		Value: types.AnswerMerge{
+			SourceID: source.ID,
+			Answer:   answer,
+		},
+	}
+
+	return w.sendMessageToRetro(ctx, message, nil)
+}
+
+// DeleteAnswersByRetrospective implements Writer. Subscribers are told to
+// empty every column of the retrospective.
+func (w *WebSocket) DeleteAnswersByRetrospective(ctx context.Context, clear *types.RetrospectiveClear) error {
+	message := types.WebSocketMessage{
+		Action: "clear",
+		Type:   "answers",
+		Value:  clear,
+	}
+
+	return w.sendMessageToRetro(ctx, message, &clear.ID)
+}
+
+// DeleteQuestion implements Writer.
 func (w *WebSocket) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
 	message := types.WebSocketMessage{
 		Action: "delete",
@@ -162,34 +448,84 @@ func (w *WebSocket) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Qu
 	return nil, w.sendMessageToRetro(ctx, message, nil)
 }
 
-func (s *WebSocket) GetOldRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
-	panic("unimplemented")
-}
+// MoveAnswersAndDeleteQuestion implements Writer. Subscribers get every
+// moved answer before the deletion of the question.
+func (w *WebSocket) MoveAnswersAndDeleteQuestion(ctx context.Context, question *types.Question, targetID uuid.UUID) error {
+	for _, answer := range question.Answers {
+		// Mine is relative to whoever moved the answers
+		answer.Mine = false
+
+		message := types.WebSocketMessage{
+			Action: "update",
+			Type:   "answer",
+			Value:  answer,
+		}
+		err := w.sendMessageToRetro(ctx, message, nil)
+		if err != nil {
+			return err
+		}
+	}
 
-func (s *WebSocket) GetAllRetrospectives(ctx context.Context) ([]uuid.UUID, error) {
-	panic("unimplemented")
+	_, err := w.DeleteQuestion(ctx, question.ID)
+	return err
 }
 
-// CreateRetrospective implements Repository.
+// CreateRetrospective implements Writer.
 func (w *WebSocket) CreateRetrospective(ctx context.Context, retro *types.Retrospective) error {
-	w.connections[retro.ID] = make([]*websocket.Conn, 0)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.connections[retro.ID] = make([]*client, 0)
 	return nil
 }
 
-// DeleteRetrospective implements Repository.
+// DeleteRetrospective implements Writer. Subscribers are told about the
+// deletion before their connections are closed and forgotten.
 func (w *WebSocket) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
-	delete(w.connections, id)
-
 	message := types.WebSocketMessage{
 		Action: "delete",
 		Type:   "retrospective",
 		Value:  types.Object{ID: id},
 	}
+	err := w.sendMessageToRetro(ctx, message, &id)
+
+	w.mu.Lock()
+	clients := w.connections[id]
+	delete(w.connections, id)
+	w.mu.Unlock()
+
+	for _, client := range clients {
+		if client != nil {
+			client.shutdown()
+		}
+	}
 
-	return nil, w.sendMessageToRetro(ctx, message, &id)
+	return nil, err
+}
+
+// NotifyPendingDeletion implements Broadcaster.
+func (w *WebSocket) NotifyPendingDeletion(ctx context.Context, retro *types.Retrospective) error {
+	message := types.WebSocketMessage{
+		Action: "pending_deletion",
+		Type:   "retrospective",
+		Value:  types.PendingDeletion{ID: retro.ID, PendingDeletionAt: retro.ExpireAt},
+	}
+
+	return w.sendMessageToRetro(ctx, message, &retro.ID)
+}
+
+// UpdateRetrospectivePhase implements Writer.
+func (w *WebSocket) UpdateRetrospectivePhase(ctx context.Context, retro *types.Retrospective) error {
+	message := types.WebSocketMessage{
+		Action: "update",
+		Type:   "phase",
+		Value:  types.PhaseChange{ID: retro.ID, Phase: retro.Phase},
+	}
+
+	return w.sendMessageToRetro(ctx, message, &retro.ID)
 }
 
-// UpdateAnswer implements Repository.
+// UpdateAnswer implements Writer.
 func (w *WebSocket) UpdateAnswer(ctx context.Context, answer *types.Answer) error {
 	message := types.WebSocketMessage{
 		Action: "update",
@@ -200,7 +536,7 @@ func (w *WebSocket) UpdateAnswer(ctx context.Context, answer *types.Answer) erro
 	return w.sendMessageToRetro(ctx, message, nil)
 }
 
-// UpdateQuestion implements Repository.
+// UpdateQuestion implements Writer.
 func (w *WebSocket) UpdateQuestion(ctx context.Context, question *types.Question) error {
 	message := types.WebSocketMessage{
 		Action: "update",
@@ -211,12 +547,18 @@ func (w *WebSocket) UpdateQuestion(ctx context.Context, question *types.Question
 	return w.sendMessageToRetro(ctx, message, nil)
 }
 
-// UpdateRetrospective implements Repository.
+// UpdateRetrospective implements Writer. Only the name and description are
+// sent, in a partial message, whatever questions retro holds.
 func (w *WebSocket) UpdateRetrospective(ctx context.Context, retro *types.Retrospective) error {
 	message := types.WebSocketMessage{
 		Action: "update",
 		Type:   "retrospective",
-		Value:  retro,
+		Value: types.RetrospectiveUpdate{
+			ID:          retro.ID,
+			Name:        retro.Name,
+			Description: retro.Description,
+		},
+		Partial: true,
 	}
 
 	return w.sendMessageToRetro(ctx, message, &retro.ID)
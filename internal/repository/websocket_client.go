@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"api/types"
+	"encoding/json"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// sendBufferSize is how many messages may wait for a slow client before it
+// is disconnected.
+const sendBufferSize = 256
+
+// Versions of the message schema, negotiated with the Sec-WebSocket-Protocol
+// header. Clients not asking for one get v1.
+const (
+	protocolV1 = "simple-retro.v1"
+	protocolV2 = "simple-retro.v2"
+)
+
+var protocolVersions = map[string]int{
+	protocolV1: 1,
+	protocolV2: 2,
+}
+
+// messageVersions is the version introducing a message, keyed by action and
+// type. Messages missing from it are part of v1. Older clients get the
+// equivalent messages of their version, see downgrade.
+var messageVersions = map[string]int{
+	"create_many answer":             2,
+	"create_many question":           2,
+	"merge answer":                   2,
+	"clear answers":                  2,
+	"typing":                         2,
+	"pending_deletion retrospective": 2,
+	"update phase":                   2,
+}
+
+// downgrade returns the v1 messages equivalent to a later one, none when v1
+// has no way to tell it. Values are decoded from their JSON, so logged
+// messages are downgraded like live ones.
+func downgrade(message types.WebSocketMessage) ([]types.WebSocketMessage, error) {
+	payload, err := json.Marshal(message.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every equivalent keeps the sequence number, the author and the
+	// partial flag of the message
+	equivalent := func(action, kind string, value interface{}) types.WebSocketMessage {
+		downgraded := message
+		downgraded.Action = action
+		downgraded.Type = kind
+		downgraded.Value = value
+		return downgraded
+	}
+
+	var messages []types.WebSocketMessage
+	switch message.Action + " " + message.Type {
+	case "create_many answer":
+		var answers []types.Answer
+		if err := json.Unmarshal(payload, &answers); err != nil {
+			return nil, err
+		}
+		for _, answer := range answers {
+			messages = append(messages, equivalent("create", "answer", answer))
+		}
+	case "create_many question":
+		var questions []types.Question
+		if err := json.Unmarshal(payload, &questions); err != nil {
+			return nil, err
+		}
+		for _, question := range questions {
+			messages = append(messages, equivalent("create", "question", question))
+		}
+	case "merge answer":
+		// The deletion of the source is broadcast on its own
+		var merge types.AnswerMerge
+		if err := json.Unmarshal(payload, &merge); err != nil {
+			return nil, err
+		}
+		messages = append(messages, equivalent("update", "answer", merge.Answer))
+	case "clear answers":
+		var clear types.RetrospectiveClear
+		if err := json.Unmarshal(payload, &clear); err != nil {
+			return nil, err
+		}
+		for _, answer := range clear.Answers {
+			messages = append(messages, equivalent("delete", "answer", answer))
+		}
+	}
+	return messages, nil
+}
+
+// client is a subscribed connection. Gorilla connections support a single
+// concurrent writer, so every message goes through the send buffer and is
+// written by the client's own goroutine.
+type client struct {
+	conn      *websocket.Conn
+	send      chan types.WebSocketMessage
+	drain     chan struct{}
+	quit      chan struct{}
+	drainOnce sync.Once
+	quitOnce  sync.Once
+	// lastSeen is the time of the last message or pong, in Unix nanoseconds
+	lastSeen atomic.Int64
+	// session of the subscriber, whose own changes aren't sent back to it
+	// when suppressEcho is set
+	session      string
+	suppressEcho bool
+	// version of the message schema the client understands
+	version int
+}
+
+func newClient(conn *websocket.Conn, session string, suppressEcho bool) *client {
+	c := &client{
+		conn:         conn,
+		send:         make(chan types.WebSocketMessage, sendBufferSize),
+		drain:        make(chan struct{}),
+		quit:         make(chan struct{}),
+		session:      session,
+		suppressEcho: suppressEcho,
+		version:      1,
+	}
+	if version, ok := protocolVersions[conn.Subprotocol()]; ok {
+		c.version = version
+	}
+	c.seen()
+	return c
+}
+
+// echoOf tells whether the change made by the origin session should be
+// skipped for this client.
+func (c *client) echoOf(origin string) bool {
+	return c.suppressEcho && origin != "" && c.session == origin
+}
+
+// supports tells whether the message is part of the version the client
+// negotiated.
+func (c *client) supports(message types.WebSocketMessage) bool {
+	return messageVersions[strings.TrimSpace(message.Action+" "+message.Type)] <= c.version
+}
+
+// messagesFor returns the messages telling the client about the message, in
+// the version it negotiated.
+func (c *client) messagesFor(message types.WebSocketMessage) ([]types.WebSocketMessage, error) {
+	if c.supports(message) {
+		return []types.WebSocketMessage{message}, nil
+	}
+	return downgrade(message)
+}
+
+// receives tells whether the message is meant for the session of the client.
+func (c *client) receives(message types.WebSocketMessage) bool {
+	return message.Author == "" || message.Author == c.session
+}
+
+// seen records activity from the client.
+func (c *client) seen() {
+	c.lastSeen.Store(time.Now().UnixNano())
+}
+
+// LastSeen returns when the client last sent a message or answered a ping.
+func (c *client) LastSeen() time.Time {
+	return time.Unix(0, c.lastSeen.Load())
+}
+
+// enqueue queues a message without blocking. It returns false when the
+// buffer is full.
+func (c *client) enqueue(message types.WebSocketMessage) bool {
+	select {
+	case c.send <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// enqueueAll queues the messages, stopping at the first one which doesn't fit
+// in the send buffer.
+func (c *client) enqueueAll(messages []types.WebSocketMessage) bool {
+	for _, message := range messages {
+		if !c.enqueue(message) {
+			return false
+		}
+	}
+	return true
+}
+
+// close drops the connection right away, discarding queued messages.
+func (c *client) close() {
+	c.quitOnce.Do(func() {
+		close(c.quit)
+		c.conn.Close()
+	})
+}
+
+// shutdown writes the queued messages and a close frame before closing the
+// connection, once its retrospective is deleted.
+func (c *client) shutdown() {
+	c.drainOnce.Do(func() {
+		close(c.drain)
+	})
+}
+
+// write serializes every write to the connection until it is closed. A ping
+// is sent every pingInterval when it is positive, and the connection is
+// dropped once the client has been silent for longer than idleTimeout.
+func (c *client) write(logger *zap.Logger, retrospectiveID uuid.UUID, pingInterval, idleTimeout time.Duration) {
+	defer c.close()
+
+	var ping <-chan time.Time
+	if pingInterval > 0 {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+		ping = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.quit:
+			return
+
+		case message := <-c.send:
+			if err := writeMessage(c.conn, message); err != nil {
+				logger.Warn("error sending message to connection, dropping it",
+					zap.Stringer("retrospective_id", retrospectiveID),
+					zap.String("action", message.Action),
+					zap.String("type", message.Type),
+					zap.Error(err),
+				)
+				return
+			}
+
+		case <-ping:
+			if idleTimeout > 0 && time.Since(c.LastSeen()) > idleTimeout {
+				logger.Info("dropping silent connection",
+					zap.Stringer("retrospective_id", retrospectiveID),
+					zap.Time("last_seen", c.LastSeen()),
+				)
+				return
+			}
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, writeDeadline()); err != nil {
+				return
+			}
+
+		case <-c.drain:
+			if err := c.flush(); err != nil {
+				return
+			}
+			closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "retrospective deleted")
+			_ = c.conn.WriteControl(websocket.CloseMessage, closeMessage, writeDeadline())
+			return
+		}
+	}
+}
+
+// flush writes the messages waiting in the send buffer.
+func (c *client) flush() error {
+	for {
+		select {
+		case message := <-c.send:
+			if err := writeMessage(c.conn, message); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
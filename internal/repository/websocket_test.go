@@ -1 +1,607 @@
 package repository
+
+import (
+	"api/config"
+	"api/types"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// The WebSocket repository only broadcasts changes, it has nothing to read.
+var (
+	_ Repository  = (*SQLite)(nil)
+	_ Broadcaster = (*WebSocket)(nil)
+)
+
+func TestWebSocketIsNotReader(t *testing.T) {
+	var ws interface{} = &WebSocket{}
+
+	_, ok := ws.(Reader)
+	assert.False(t, ok, "the websocket repository shouldn't implement read methods")
+}
+
+// newWebSocketServer starts a server subscribing clients to the given
+// retrospective and returns its WebSocket URL.
+func newWebSocketServer(t *testing.T, ws *WebSocket, retroID uuid.UUID) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "retrospective_id", retroID)
+		err := ws.AddConnection(ctx, w, r)
+		if errors.Is(err, ErrTooManyConnections) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+// latestDialer negotiates the latest version of the message schema.
+var latestDialer = websocket.Dialer{Subprotocols: []string{protocolV2}}
+
+// connectToRetrospective returns a client subscribed to the retrospective,
+// with the latest version of the message schema.
+func connectToRetrospective(t *testing.T, ws *WebSocket, retroID uuid.UUID) *websocket.Conn {
+	client, _, err := latestDialer.Dial(newWebSocketServer(t, ws, retroID), nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+// waitConnections waits until the retrospective has n registered connections.
+func waitConnections(ws *WebSocket, retroID uuid.UUID, n int) {
+	for i := 0; i < 100; i++ {
+		ws.mu.Lock()
+		registered := len(ws.connections[retroID])
+		ws.mu.Unlock()
+		if registered >= n {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// connectionAt returns the i-th connection registered for the retrospective.
+func connectionAt(ws *WebSocket, retroID uuid.UUID, i int) *client {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if i >= len(ws.connections[retroID]) {
+		return nil
+	}
+	return ws.connections[retroID][i]
+}
+
+// waitDropped waits until the i-th connection of the retrospective is gone.
+func waitDropped(ws *WebSocket, retroID uuid.UUID, i int) {
+	for j := 0; j < 500 && connectionAt(ws, retroID, i) != nil; j++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSendMessageWriteTimeout(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.WebSocket.WriteTimeoutSeconds = 1
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.Background()
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	// The client never reads, so socket buffers eventually fill up
+	connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 1)
+
+	message := types.WebSocketMessage{
+		Action: "update",
+		Type:   "answer",
+		Value:  strings.Repeat("x", 1<<20),
+	}
+
+	start := time.Now()
+	for i := 0; i < 2*sendBufferSize && connectionAt(ws, retro.ID, 0) != nil; i++ {
+		err = ws.sendMessageToRetro(ctx, message, &retro.ID)
+		assert.Nilf(t, err, "error sending message")
+	}
+
+	waitDropped(ws, retro.ID, 0)
+	assert.Nil(t, connectionAt(ws, retro.ID, 0), "stuck connection should have been dropped")
+	assert.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestAddConnectionGlobalLimit(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Server.MaxConnections = 3
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	ctx := context.Background()
+	retros := []*types.Retrospective{{ID: uuid.New()}, {ID: uuid.New()}}
+	for _, retro := range retros {
+		err = ws.CreateRetrospective(ctx, retro)
+		assert.Nilf(t, err, "error creating retrospective")
+	}
+
+	connectToRetrospective(t, ws, retros[0].ID)
+	connectToRetrospective(t, ws, retros[0].ID)
+	connectToRetrospective(t, ws, retros[1].ID)
+	waitConnections(ws, retros[0].ID, 2)
+	waitConnections(ws, retros[1].ID, 1)
+
+	_, res, err := websocket.DefaultDialer.Dial(newWebSocketServer(t, ws, retros[1].ID), nil)
+	assert.NotNil(t, err, "connection over the limit should be refused")
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestDeleteRetrospectiveNotifiesAndCloses(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.Background()
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	client := connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 1)
+
+	_, err = ws.DeleteRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error deleting retrospective")
+
+	var message types.WebSocketMessage
+	err = client.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading delete message")
+	assert.Equal(t, "delete", message.Action)
+	assert.Equal(t, "retrospective", message.Type)
+
+	_, _, err = client.ReadMessage()
+	assert.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), "expected a close frame, got %v", err)
+
+	ws.mu.Lock()
+	_, exists := ws.connections[retro.ID]
+	ws.mu.Unlock()
+	assert.False(t, exists, "connections of a deleted retrospective should be forgotten")
+}
+
+func TestAddConnectionIdleTimeout(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.WebSocket.IdleTimeoutSeconds = 2
+	conf.WebSocket.PingIntervalSeconds = 1
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	err = ws.CreateRetrospective(context.Background(), retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	// Pings are only answered while reading, so this client goes idle
+	connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 1)
+
+	active := connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 2)
+	connectedAt := connectionAt(ws, retro.ID, 1).LastSeen()
+	go func() {
+		for {
+			if _, _, err := active.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	time.Sleep(3500 * time.Millisecond)
+
+	assert.Nil(t, connectionAt(ws, retro.ID, 0), "idle connection should have been closed")
+	kept := connectionAt(ws, retro.ID, 1)
+	if assert.NotNil(t, kept, "connection answering pings should be kept") {
+		assert.True(t, kept.LastSeen().After(connectedAt), "pongs should update the last seen time")
+	}
+}
+
+func TestSendMessageConcurrently(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.Background()
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	client := connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 1)
+
+	const senders, messages = 10, 20
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				message := types.WebSocketMessage{Action: "update", Type: "answer", Value: j}
+				err := ws.sendMessageToRetro(ctx, message, &retro.ID)
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	// Pongs are written by the same goroutine as the broadcasts
+	err = client.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	wg.Wait()
+
+	received := 0
+	for received < senders*messages {
+		var message types.WebSocketMessage
+		err := client.ReadJSON(&message)
+		if !assert.Nilf(t, err, "error reading message %d", received) {
+			break
+		}
+		if message.Type == "answer" {
+			received++
+		}
+	}
+	assert.Equal(t, senders*messages, received)
+	assert.NotNil(t, connectionAt(ws, retro.ID, 0))
+}
+
+func TestTypingRelayedToOthers(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	err = ws.CreateRetrospective(context.Background(), retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	sender := connectToRetrospective(t, ws, retro.ID)
+	receiver := connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 2)
+
+	answerID := uuid.New()
+	for _, value := range []interface{}{
+		map[string]string{"answer_id": "not-a-uuid"},
+		"answer",
+		map[string]string{"answer_id": answerID.String()},
+	} {
+		err = sender.WriteJSON(types.WebSocketMessage{Type: "typing", Value: value})
+		assert.Nilf(t, err, "error sending typing")
+	}
+
+	var message struct {
+		Type  string       `json:"type"`
+		Value types.Typing `json:"value"`
+	}
+	err = receiver.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading typing")
+	assert.Equal(t, "typing", message.Type, "malformed typing messages should be dropped")
+	assert.Equal(t, answerID, message.Value.AnswerID)
+
+	// Messages are handled in order, a typing echo would come before the pong
+	err = sender.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = sender.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", message.Type, "the sender shouldn't get its own typing message")
+}
+
+func TestReconnectReplaysMissedEvents(t *testing.T) {
+	db := newTestRepo(t)
+
+	ws, err := NewWebSocket(zap.NewNop(), db)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	url := newWebSocketServer(t, ws, retro.ID)
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	waitConnections(ws, retro.ID, 1)
+
+	question := &types.Question{ID: uuid.New(), Text: "What went well?"}
+	err = ws.CreateQuestion(ctx, question)
+	assert.Nilf(t, err, "error creating question")
+
+	var message types.WebSocketMessage
+	err = conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading question")
+	assert.NotZero(t, message.Seq, "broadcast messages should have a seq")
+	conn.Close()
+
+	since := message.Seq
+	answers := []*types.Answer{
+		{ID: uuid.New(), QuestionID: question.ID, Text: "first"},
+		{ID: uuid.New(), QuestionID: question.ID, Text: "second"},
+	}
+	for _, answer := range answers {
+		err = ws.CreateAnswer(ctx, answer)
+		assert.Nilf(t, err, "error creating answer")
+	}
+
+	conn, _, err = websocket.DefaultDialer.Dial(url+"?since="+strconv.FormatInt(since, 10), nil)
+	assert.Nilf(t, err, "error reconnecting to websocket")
+	defer conn.Close()
+
+	for _, answer := range answers {
+		var replayed struct {
+			Seq    int64        `json:"seq"`
+			Action string       `json:"action"`
+			Value  types.Answer `json:"value"`
+		}
+		err = conn.ReadJSON(&replayed)
+		assert.Nilf(t, err, "error reading replayed answer")
+		assert.Greater(t, replayed.Seq, since, "events should be replayed in order")
+		assert.Equal(t, "create", replayed.Action)
+		assert.Equal(t, answer.Text, replayed.Value.Text)
+		since = replayed.Seq
+	}
+
+	// Nothing else was missed, the next message is the pong
+	err = conn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", message.Type)
+
+	_, _, err = websocket.DefaultDialer.Dial(url+"?since=latest", nil)
+	assert.ErrorIs(t, err, websocket.ErrBadHandshake, "an invalid cursor should be refused")
+}
+
+func TestReconnectTooFarBehindReloads(t *testing.T) {
+	db := newTestRepo(t)
+
+	ws, err := NewWebSocket(zap.NewNop(), db)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	for i := 0; i <= sendBufferSize/2; i++ {
+		err = ws.CreateQuestion(ctx, &types.Question{ID: uuid.New()})
+		assert.Nilf(t, err, "error creating question")
+	}
+
+	conn, _, err := latestDialer.Dial(newWebSocketServer(t, ws, retro.ID)+"?since=0", nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer conn.Close()
+
+	var message types.WebSocketMessage
+	err = conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading message")
+	assert.Equal(t, "reload", message.Action, "a client too far behind should reload the retrospective")
+
+	legacy, _, err := websocket.DefaultDialer.Dial(newWebSocketServer(t, ws, retro.ID)+"?since=0", nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer legacy.Close()
+
+	err = legacy.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading message")
+	assert.Equal(t, "reload", message.Action, "v1 clients should reload too")
+}
+
+func TestSubprotocolNegotiation(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	err = ws.CreateRetrospective(context.Background(), retro)
+	assert.Nilf(t, err, "error creating retrospective")
+	url := newWebSocketServer(t, ws, retro.ID)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"simple-retro.v9", protocolV1}}
+	conn, res, err := dialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer conn.Close()
+	assert.Equal(t, protocolV1, res.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, protocolV1, conn.Subprotocol())
+
+	// Clients not asking for a protocol still connect, as v1
+	legacy, res, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer legacy.Close()
+	assert.Empty(t, res.Header.Get("Sec-WebSocket-Protocol"))
+
+	waitConnections(ws, retro.ID, 2)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, 1, connectionAt(ws, retro.ID, i).version)
+	}
+
+	// The latest version wins when the client supports several
+	dialer = websocket.Dialer{Subprotocols: []string{protocolV1, protocolV2}}
+	current, res, err := dialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer current.Close()
+	assert.Equal(t, protocolV2, res.Header.Get("Sec-WebSocket-Protocol"))
+	waitConnections(ws, retro.ID, 3)
+	assert.Equal(t, 2, connectionAt(ws, retro.ID, 2).version)
+}
+
+func TestBroadcastDowngradesMessages(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	// The v1 client is registered first, so it is sent every message before
+	// the v2 one
+	url := newWebSocketServer(t, ws, retro.ID)
+	legacy, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer legacy.Close()
+	waitConnections(ws, retro.ID, 1)
+	current, _, err := latestDialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer current.Close()
+	typist, _, err := latestDialer.Dial(url, nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer typist.Close()
+	waitConnections(ws, retro.ID, 3)
+
+	var message types.WebSocketMessage
+	err = typist.WriteJSON(types.WebSocketMessage{Type: "typing", Value: types.Typing{AnswerID: uuid.New()}})
+	assert.Nilf(t, err, "error sending typing")
+	err = current.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading typing")
+	assert.Equal(t, "typing", message.Type)
+
+	answer := &types.Answer{ID: uuid.New(), Text: "first"}
+	other := &types.Answer{ID: uuid.New(), Text: "second"}
+	question := &types.Question{ID: uuid.New()}
+	assert.Nil(t, ws.CreateAnswers(ctx, []*types.Answer{answer, other}))
+	assert.Nil(t, ws.CreateQuestions(ctx, []*types.Question{question}))
+	assert.Nil(t, ws.MergeAnswers(ctx, other, answer))
+	assert.Nil(t, ws.DeleteAnswersByRetrospective(ctx, &types.RetrospectiveClear{ID: retro.ID, Answers: []types.Answer{*answer}}))
+	assert.Nil(t, ws.NotifyPendingDeletion(ctx, retro))
+	assert.Nil(t, ws.UpdateRetrospectivePhase(ctx, retro))
+	err = ws.UpdateQuestion(ctx, &types.Question{ID: uuid.New()})
+	assert.Nilf(t, err, "error updating question")
+
+	for _, expected := range []string{"create_many answer", "create_many question", "merge answer", "clear answers", "pending_deletion retrospective", "update phase", "update question"} {
+		err = current.ReadJSON(&message)
+		assert.Nilf(t, err, "error reading message")
+		assert.Equal(t, expected, message.Action+" "+message.Type)
+	}
+
+	// v1 clients get the equivalent messages of their version, and none for
+	// typing, pending deletions and phases
+	var legacyMessage struct {
+		Action string       `json:"action"`
+		Type   string       `json:"type"`
+		Value  types.Answer `json:"value"`
+	}
+	for _, expected := range []struct {
+		message string
+		id      uuid.UUID
+	}{
+		{"create answer", answer.ID},
+		{"create answer", other.ID},
+		{"create question", question.ID},
+		{"update answer", answer.ID},
+		{"delete answer", answer.ID},
+		{"update question", uuid.Nil},
+	} {
+		err = legacy.ReadJSON(&legacyMessage)
+		assert.Nilf(t, err, "error reading message")
+		assert.Equal(t, expected.message, legacyMessage.Action+" "+legacyMessage.Type)
+		if expected.id != uuid.Nil {
+			assert.Equal(t, expected.id, legacyMessage.Value.ID)
+		}
+	}
+}
+
+func TestOversizedMessageClosesConnection(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.WebSocket.MaxMessageBytes = 512
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	err = ws.CreateRetrospective(context.Background(), retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	conn := connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 1)
+
+	// Unknown types are ignored without closing the connection
+	err = conn.WriteJSON(types.WebSocketMessage{Type: "shout", Value: "hello"})
+	assert.Nilf(t, err, "error sending message")
+	err = conn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	var message types.WebSocketMessage
+	err = conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", message.Type)
+
+	err = conn.WriteJSON(types.WebSocketMessage{Type: "typing", Value: strings.Repeat("a", 1024)})
+	assert.Nilf(t, err, "error sending message")
+
+	// The close frame may be lost to a reset, the unread rest of the message
+	// is discarded
+	_, _, err = conn.ReadMessage()
+	assert.NotNil(t, err, "the connection should be closed")
+
+	waitDropped(ws, retro.ID, 0)
+	assert.Nil(t, connectionAt(ws, retro.ID, 0), "the connection should be dropped")
+
+	// The server keeps accepting clients
+	connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 2)
+	assert.NotNil(t, connectionAt(ws, retro.ID, 1))
+}
+
+func TestUpdateRetrospectiveIsPartial(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ws, err := NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	retro := &types.Retrospective{ID: uuid.New()}
+	ctx := context.WithValue(context.Background(), "retrospective_id", retro.ID)
+	err = ws.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	conn := connectToRetrospective(t, ws, retro.ID)
+	waitConnections(ws, retro.ID, 1)
+
+	retro.Name = "Renamed"
+	retro.Questions = []types.Question{{ID: uuid.New(), Text: "What went well?"}}
+	err = ws.UpdateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error updating retrospective")
+
+	var message struct {
+		Action  string                 `json:"action"`
+		Type    string                 `json:"type"`
+		Value   map[string]interface{} `json:"value"`
+		Partial bool                   `json:"partial"`
+	}
+	err = conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading message")
+	assert.Equal(t, "update", message.Action)
+	assert.Equal(t, "retrospective", message.Type)
+	assert.True(t, message.Partial)
+	assert.Equal(t, "Renamed", message.Value["name"])
+	assert.NotContains(t, message.Value, "questions", "questions shouldn't be broadcast with the update")
+}
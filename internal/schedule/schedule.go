@@ -3,39 +3,155 @@ package schedule
 import (
 	"api/config"
 	"api/internal/service"
+	"api/types"
 	"context"
-	"log"
+	"errors"
+	"math/rand"
+	"sync/atomic"
 	"time"
+
+	"go.uber.org/zap"
 )
 
 type schedule struct {
 	service *service.Service
+	logger  *zap.Logger
+	// Run on every tick
+	task func()
+	// Receives the interval to switch to
+	reset chan time.Duration
+	// Current interval, in nanoseconds
+	interval atomic.Int64
 }
 
-func New(s *service.Service) *schedule {
-	return &schedule{
+func New(s *service.Service, logger *zap.Logger) *schedule {
+	schedule := &schedule{
 		service: s,
+		logger:  logger,
+		reset:   make(chan time.Duration),
 	}
+	schedule.task = schedule.cleanUp
+	return schedule
 }
 
 func (s *schedule) Start() {
-	config := config.Get()
+	interval := intervalOf(config.Get().Schedule)
+	if interval <= 0 {
+		interval = intervalOf(config.Default().Schedule)
+		s.logger.Warn("invalid clean up interval, using the default", zap.Duration("interval", interval))
+	}
+	s.interval.Store(int64(interval))
+
+	// A nil channel never fires, leaving only the ticker
+	var startup <-chan time.Time
+	if conf := config.Get().Schedule; conf.RunOnStart {
+		delay := startDelay(conf)
+		s.logger.Info("clean up scheduled on startup", zap.Duration("delay", delay))
+		startup = time.After(delay)
+	}
+
 	go func() {
-		ticker := time.NewTicker(time.Duration(config.Schedule.IntervalMinutes) * time.Minute)
+		ticker := time.NewTicker(interval)
 
 		for {
 			select {
+			case <-startup:
+				startup = nil
+				s.task()
 			case <-ticker.C:
-				s.cleanUp()
+				s.task()
+			case interval := <-s.reset:
+				ticker.Reset(interval)
+				s.interval.Store(int64(interval))
+				s.logger.Info("clean up interval changed", zap.Duration("interval", interval))
 			}
 		}
 	}()
 }
 
+// Reload switches to the interval of conf, counted from now. An interval
+// which isn't positive is ignored as the ticker can't use it. It must be
+// called after Start.
+func (s *schedule) Reload(conf config.Schedule) {
+	interval := intervalOf(conf)
+	if interval <= 0 {
+		s.logger.Warn("invalid clean up interval, keeping the current one", zap.Int("interval_minutes", conf.IntervalMinutes))
+		return
+	}
+	if interval == s.Interval() {
+		return
+	}
+	s.reset <- interval
+}
+
+// Interval returns how often the clean up currently runs.
+func (s *schedule) Interval() time.Duration {
+	return time.Duration(s.interval.Load())
+}
+
+// startDelay returns the configured delay plus a random part of the jitter.
+func startDelay(conf config.Schedule) time.Duration {
+	delay := time.Duration(conf.StartDelaySeconds) * time.Second
+	if conf.StartJitterSeconds > 0 {
+		delay += time.Duration(rand.Int63n(int64(conf.StartJitterSeconds) * int64(time.Second)))
+	}
+	return delay
+}
+
+func intervalOf(conf config.Schedule) time.Duration {
+	return time.Duration(conf.IntervalMinutes) * time.Minute
+}
+
 func (s *schedule) cleanUp() {
-	log.Println("starting clean up routine")
+	s.logger.Info("starting clean up routine")
 	ctx := context.Background()
-	if err := s.service.CleanUpRetros(ctx); err != nil {
-		log.Printf("error running clean up routine: %s", err.Error())
+
+	summary, err := s.service.CleanUpRetros(ctx)
+	s.logSummary("old", summary, err)
+
+	summary, err = s.service.CleanUpEmptyRetros(ctx)
+	s.logSummary("empty", summary, err)
+
+	if err := s.service.NotifyPendingDeletions(ctx); err != nil {
+		s.logger.Warn("error notifying pending deletions", zap.Error(err))
+	}
+
+	deleted, err := s.service.CleanUpIdempotentResponses(ctx)
+	if err != nil {
+		s.logger.Warn("error deleting expired idempotent responses", zap.Error(err))
+	} else {
+		s.logger.Info("expired idempotent responses deleted", zap.Int("deleted", deleted))
+	}
+
+	deleted, err = s.service.CleanUpEvents(ctx)
+	if err != nil {
+		s.logger.Warn("error deleting expired events", zap.Error(err))
+	} else {
+		s.logger.Info("expired events deleted", zap.Int("deleted", deleted))
+	}
+}
+
+func (s *schedule) logSummary(routine string, summary *types.CleanUpSummary, err error) {
+	if errors.Is(err, service.ErrCleanUpRunning) {
+		s.logger.Warn("clean up routine skipped, the previous one is still running", zap.String("routine", routine))
+		return
+	}
+	if summary == nil {
+		s.logger.Error("error running clean up routine", zap.String("routine", routine), zap.Error(err))
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("routine", routine),
+		zap.Int("scanned", summary.Scanned),
+		zap.Int("deleted", summary.Deleted),
+		zap.Int("failed", summary.Failed),
+		zap.Duration("duration", summary.Duration),
+		zap.Bool("dry_run", summary.DryRun),
+	}
+	if err != nil {
+		s.logger.Warn("clean up routine finished with errors", append(fields, zap.Error(err))...)
+		return
 	}
+	s.logger.Info("clean up routine finished", fields...)
 }
@@ -0,0 +1,91 @@
+package schedule
+
+import (
+	"api/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestReloadResetsInterval(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Schedule.IntervalMinutes = 60
+
+	s := New(nil, zap.NewNop())
+	ticks := make(chan struct{}, 10)
+	s.task = func() { ticks <- struct{}{} }
+	s.Start()
+	assert.Equal(t, time.Hour, s.Interval())
+
+	s.Reload(config.Schedule{IntervalMinutes: 5})
+	assert.Eventually(t, func() bool { return s.Interval() == 5*time.Minute }, time.Second, time.Millisecond)
+
+	// A zero interval would make the ticker panic
+	s.Reload(config.Schedule{IntervalMinutes: 0})
+	assert.Equal(t, 5*time.Minute, s.Interval())
+
+	select {
+	case <-ticks:
+		assert.Fail(t, "the clean up should not run before the interval")
+	default:
+	}
+
+	// The ticker follows the new interval
+	s.reset <- 10 * time.Millisecond
+	select {
+	case <-ticks:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the clean up should run at the new interval")
+	}
+	assert.Equal(t, 10*time.Millisecond, s.Interval())
+}
+
+func TestStartWithoutInterval(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Schedule.IntervalMinutes = 0
+
+	s := New(nil, zap.NewNop())
+	s.task = func() {}
+	assert.NotPanics(t, s.Start)
+	assert.Equal(t, time.Duration(config.Default().Schedule.IntervalMinutes)*time.Minute, s.Interval())
+}
+
+func TestRunOnStart(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Schedule.IntervalMinutes = 60
+	conf.Schedule.RunOnStart = true
+
+	s := New(nil, zap.NewNop())
+	ticks := make(chan struct{}, 10)
+	s.task = func() { ticks <- struct{}{} }
+	s.Start()
+
+	select {
+	case <-ticks:
+	case <-time.After(time.Second):
+		assert.Fail(t, "the clean up should run on startup")
+	}
+
+	select {
+	case <-ticks:
+		assert.Fail(t, "the clean up should only run once on startup")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStartDelay(t *testing.T) {
+	conf := config.Schedule{StartDelaySeconds: 10}
+	assert.Equal(t, 10*time.Second, startDelay(conf))
+
+	conf.StartJitterSeconds = 5
+	for i := 0; i < 20; i++ {
+		delay := startDelay(conf)
+		assert.GreaterOrEqual(t, delay, 10*time.Second)
+		assert.Less(t, delay, 15*time.Second)
+	}
+}
@@ -2,19 +2,31 @@ package server
 
 import (
 	"api/config"
+	"api/internal/service"
+	"context"
 	"math"
+	"time"
 
 	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 )
 
+const (
+	DATABASE_OK   = "ok"
+	DATABASE_DOWN = "down"
+
+	pingTimeout = 2 * time.Second
+)
+
 type health struct {
-	Name   string  `json:"name"`
-	CPU    float64 `json:"cpu"`
-	Memory float64 `json:"memory"`
+	Name                 string  `json:"name"`
+	CPU                  float64 `json:"cpu"`
+	Memory               float64 `json:"memory"`
+	Database             string  `json:"database"`
+	WebSocketConnections int     `json:"websocket_connections"`
 }
 
-func getServiceHealth() (health, error) {
+func getServiceHealth(ctx context.Context, s *service.Service) (health, error) {
 	var health health
 
 	config := config.Get()
@@ -32,5 +44,15 @@ func getServiceHealth() (health, error) {
 	}
 	health.Memory = float64(vm.Used) / math.Pow(1024, 2) // convert to MB
 
+	health.WebSocketConnections = s.ConnectionCount()
+
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+
+	health.Database = DATABASE_OK
+	if err := s.Ping(ctx); err != nil {
+		health.Database = DATABASE_DOWN
+	}
+
 	return health, nil
 }
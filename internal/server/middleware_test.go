@@ -0,0 +1,61 @@
+package server
+
+import (
+	"api/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	var seen interface{}
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) {
+		seen = c.Request.Context().Value("request_id")
+		c.Status(http.StatusOK)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Request-ID", "my-request")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	assert.Equal(t, "my-request", res.Header().Get("X-Request-ID"))
+	assert.Equal(t, "my-request", seen)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	generated := res.Header().Get("X-Request-ID")
+	assert.Nil(t, uuid.Validate(generated), "expected a generated UUID")
+	assert.Equal(t, generated, seen)
+}
+
+func TestBodyLimit(t *testing.T) {
+	router := newTestController(t).router()
+	config.Get().Server.MaxBodyBytes = 64
+
+	body := `{"name": "` + strings.Repeat("a", 100) + `"}`
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", body, uuid.Nil, nil)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+
+	// Without a Content-Length the body is cut while being read
+	req := httptest.NewRequest(http.MethodPost, "/api/retrospective", io.NopCloser(strings.NewReader(body)))
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res.Code)
+
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Small"}`, uuid.Nil, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+}
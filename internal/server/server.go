@@ -3,26 +3,103 @@ package server
 import (
 	"api/config"
 	"api/docs"
+	"api/internal/metrics"
+	"api/internal/repository"
 	"api/internal/service"
 	"api/types"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"     // swagger embed files
 	ginSwagger "github.com/swaggo/gin-swagger" // gin-swagger middleware
+	"go.uber.org/zap"
 )
 
 type controller struct {
 	service *service.Service
+	logger  *zap.Logger
 }
 
-func New(s *service.Service) *controller {
+func New(s *service.Service, logger *zap.Logger) *controller {
 	return &controller{
 		service: s,
+		logger:  logger,
+	}
+}
+
+// log returns the controller logger with the fields known for the request.
+func (ct *controller) log(c *gin.Context) *zap.Logger {
+	logger := ct.logger.With(zap.String("request_id", c.GetString("request_id")))
+	if retroID, ok := c.Get("retrospective_id"); ok {
+		logger = logger.With(zap.Any("retrospective_id", retroID))
+	}
+	return logger
+}
+
+// RequestID identifies each request with the X-Request-ID header sent by the
+// client, or a new one when absent, and echoes it back in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = uuid.NewString()
+		}
+
+		c.Set("request_id", requestID)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), "request_id", requestID))
+		c.Header("X-Request-ID", requestID)
+
+		c.Next()
+	}
+}
+
+// Metrics observes the count and latency of every request.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// Use the route template so ids in the path don't explode cardinality
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.RequestsTotal.WithLabelValues(route, c.Request.Method, status).Inc()
+		metrics.RequestDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// Logger logs every request with its outcome and latency.
+func Logger(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		logger.Info("request",
+			zap.String("request_id", c.GetString("request_id")),
+			zap.String("method", c.Request.Method),
+			zap.String("path", c.Request.URL.Path),
+			zap.Int("status", c.Writer.Status()),
+			zap.Duration("latency", time.Since(start)),
+		)
 	}
 }
 
@@ -46,25 +123,343 @@ func CORSMiddleware() gin.HandlerFunc {
 	}
 }
 
-func Authenticate() gin.HandlerFunc {
+// retrospectiveLocation returns the path of the retrospective the request was
+// authenticated for. Questions and answers have no route of their own, so it
+// is the Location of the ones created.
+func retrospectiveLocation(c *gin.Context) string {
+	retroID, _ := c.Get("retrospective_id")
+	return fmt.Sprintf("/api/retrospective/%s", retroID)
+}
+
+// retrospectiveFromCookie returns the retrospective the client joined.
+func retrospectiveFromCookie(c *gin.Context) (uuid.UUID, error) {
+	retroIDcookie, err := c.Cookie("retrospective_id")
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	return uuid.Parse(retroIDcookie)
+}
+
+func Authenticate(logger *zap.Logger) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		retroIDcookie, err := c.Cookie("retrospective_id")
+		retroID, err := retrospectiveFromCookie(c)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "not in any retrospective"})
+			if err != http.ErrNoCookie {
+				logger.Warn("error parsing retrospective_id", zap.Error(err))
+			}
+			respondError(c, http.StatusUnauthorized, "not in any retrospective")
 			c.Abort()
 			return
 		}
 
-		retroID, err := uuid.Parse(retroIDcookie)
+		c.Set("retrospective_id", retroID)
+	}
+}
+
+// AdminAuth only lets through requests carrying the admin token in their
+// X-Admin-Token header.
+func AdminAuth(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Admin-Token")
+		expected := config.Get().Admin.Token
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			logger.Warn("unauthorized admin request", zap.String("path", c.Request.URL.Path))
+			abortWithError(c, http.StatusUnauthorized, "invalid admin token")
+			return
+		}
+	}
+}
+
+// ResolveQuestion loads the question referenced by the question_id of the
+// request body and stores its id in the context. Questions of another
+// retrospective are reported as not found, so handlers behind it only deal
+// with questions of the caller's retrospective.
+func ResolveQuestion(s *service.Service, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			logger.Warn("error reading body content", zap.Error(err))
+			abortWithError(c, http.StatusBadRequest, "invalid body content")
+			return
+		}
+		// The handler binds the body again
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		var input struct {
+			QuestionID uuid.UUID `json:"question_id"`
+		}
+		if err := json.Unmarshal(body, &input); err != nil {
+			logger.Warn("error parsing body content", zap.Error(err))
+			abortWithError(c, http.StatusBadRequest, "invalid body content")
+			return
+		}
+
+		if input.QuestionID == uuid.Nil {
+			abortWithError(c, http.StatusBadRequest, "question id cannot be empty")
+			return
+		}
+
+		question, err := s.GetQuestion(c, input.QuestionID)
+		if err == sql.ErrNoRows {
+			logger.Info("question not found", zap.Stringer("question_id", input.QuestionID))
+			abortWithError(c, http.StatusNotFound, "question not found")
+			return
+		}
+
+		if err != nil {
+			logger.Error("error getting question", zap.Error(err))
+			abortWithError(c, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		c.Set("question_id", question.ID)
+	}
+}
+
+// setCookie sets a cookie with the attributes of the configuration. A zero
+// maxAge makes it last until the browser is closed.
+func setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	conf := config.Get().Cookie
+
+	switch conf.SameSite {
+	case "lax":
+		c.SetSameSite(http.SameSiteLaxMode)
+	case "strict":
+		c.SetSameSite(http.SameSiteStrictMode)
+	default:
+		c.SetSameSite(http.SameSiteNoneMode)
+	}
+	c.SetCookie(name, value, maxAge, conf.Path, conf.Domain, conf.Secure, httpOnly)
+}
+
+// retrospectiveCookieMaxAge returns the Max-Age of the retrospective cookie,
+// in seconds, so it expires with the retrospective or at the configured cap.
+func retrospectiveCookieMaxAge(expireAt time.Time) int {
+	maxAge := time.Until(expireAt)
+	if limit := time.Duration(config.Get().Cookie.MaxAgeHours) * time.Hour; limit > 0 && maxAge > limit {
+		maxAge = limit
+	}
+
+	// An expired retrospective lives until the next clean up, zero or less
+	// would make a session cookie or delete it
+	if maxAge < time.Second {
+		return 1
+	}
+	return int(maxAge.Seconds())
+}
+
+// Session makes sure every client carries an anonymous session id, used to
+// recognize its own answers. The id is never sent to other clients.
+func Session() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		sessionID, err := c.Cookie("simple-retro-session")
+		if err != nil || uuid.Validate(sessionID) != nil {
+			sessionID = uuid.NewString()
+			setCookie(c, "simple-retro-session", sessionID, 0, true)
+		}
+
+		c.Set("session_id", sessionID)
+	}
+}
+
+// BodyLimit rejects request bodies over server.max_body_bytes with a 413,
+// before any handler parses them. WebSocket upgrades carry no body and are
+// left alone.
+func BodyLimit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := config.Get().Server.MaxBodyBytes
+		if limit <= 0 || c.IsWebsocket() || c.Request.Body == nil {
+			c.Next()
+			return
+		}
+
+		if c.Request.ContentLength > limit {
+			abortWithError(c, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+
+		// The length can be unknown, read at most the limit before handlers
+		// do so an oversized body never reaches the JSON decoder
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
 		if err != nil {
-			log.Printf("error parsing retrospective_id: %s", err.Error())
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "not in any retrospective"})
+			abortWithError(c, http.StatusBadRequest, "invalid body content")
+			return
+		}
+
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		c.Next()
+	}
+}
+
+// recordingWriter keeps a copy of the response body.
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *recordingWriter) WriteString(data string) (int, error) {
+	w.body.WriteString(data)
+	return w.ResponseWriter.WriteString(data)
+}
+
+// Idempotent answers a request retried with the same Idempotency-Key header
+// with the response of the first one, instead of running the handler again.
+// The key is reserved before the handler runs, so a retry sent while the
+// first request is pending gets 409. Keys are scoped to the session and only
+// successful responses are kept, with their Location header.
+func Idempotent(s *service.Service, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			return
+		}
+
+		if len(key) > 128 {
+			abortWithError(c, http.StatusBadRequest, "invalid idempotency key")
+			return
+		}
+
+		route := c.Request.Method + " " + c.FullPath()
+		reserved, err := s.ReserveIdempotencyKey(c, key, route)
+		if err != nil {
+			logger.Error("error reserving idempotency key", zap.Error(err))
+			abortWithError(c, http.StatusInternalServerError, "internal server error")
+			return
+		}
+
+		if !reserved {
+			stored, err := s.GetIdempotentResponse(c, key)
+			if err == sql.ErrNoRows {
+				// Released by a failed request since the reservation
+				abortWithError(c, http.StatusConflict, "a request with this idempotency key is in progress")
+				return
+			}
+			if err != nil {
+				logger.Error("error getting idempotent response", zap.Error(err))
+				abortWithError(c, http.StatusInternalServerError, "internal server error")
+				return
+			}
+
+			if stored.Route != route {
+				abortWithError(c, http.StatusUnprocessableEntity, "idempotency key already used for another request")
+				return
+			}
+
+			if stored.Status == 0 {
+				abortWithError(c, http.StatusConflict, "a request with this idempotency key is in progress")
+				return
+			}
+
+			c.Header("Idempotent-Replayed", "true")
+			if stored.Location != "" {
+				c.Header("Location", stored.Location)
+			}
+			c.Data(stored.Status, "application/json; charset=utf-8", stored.Body)
 			c.Abort()
 			return
 		}
 
-		c.Set("retrospective_id", retroID)
+		saved := false
+		defer func() {
+			if saved {
+				return
+			}
+			if err := s.ReleaseIdempotencyKey(c, key); err != nil {
+				logger.Warn("error releasing idempotency key", zap.Error(err))
+			}
+		}()
+
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+
+		if writer.Status() < 200 || writer.Status() >= 300 {
+			return
+		}
+
+		response := &types.IdempotentResponse{
+			Route:    route,
+			Status:   writer.Status(),
+			Location: writer.Header().Get("Location"),
+			Body:     writer.body.Bytes(),
+		}
+		if err := s.SaveIdempotentResponse(c, key, response); err != nil {
+			logger.Warn("error saving idempotent response", zap.Error(err))
+			return
+		}
+		saved = true
+	}
+}
+
+// internalError logs err and answers 500. The detail of the error is only
+// sent in development, otherwise clients get the request id to report.
+func (ct *controller) internalError(c *gin.Context, msg string, err error) {
+	ct.log(c).Error(msg, zap.Error(err))
+
+	body := types.ErrorResponse{
+		Error:     "internal server error",
+		RequestID: c.GetString("request_id"),
+	}
+	if config.Get().Development {
+		body.Detail = err.Error()
+	}
+	c.JSON(http.StatusInternalServerError, body)
+}
+
+// respondError answers with the error envelope shared by every handler.
+func respondError(c *gin.Context, status int, msg string) {
+	c.JSON(status, types.ErrorResponse{Error: msg})
+}
+
+// contentETag returns a weak ETag identifying a response body. Hashing the
+// body covers every change, including the answers flagged as the caller's.
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `W/"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// etagMatches tells whether an If-None-Match header lists the ETag, using
+// the weak comparison.
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
 	}
+	return false
+}
+
+// invalidInput answers 422 with every rule broken by a request failing
+// validation, and 400 for other errors.
+func (ct *controller) invalidInput(c *gin.Context, err error) {
+	ct.log(c).Warn("invalid input", zap.Error(err))
+
+	var validationErr *types.ValidationError
+	if errors.As(err, &validationErr) {
+		c.JSON(http.StatusUnprocessableEntity, types.ErrorResponse{
+			Error:  err.Error(),
+			Errors: validationErr.Errors,
+		})
+		return
+	}
+	respondError(c, http.StatusBadRequest, err.Error())
+}
+
+// abortWithError answers like respondError and stops the handler chain.
+func abortWithError(c *gin.Context, status int, msg string) {
+	c.AbortWithStatusJSON(status, types.ErrorResponse{Error: msg})
 }
 
 // health godoc
@@ -73,19 +468,69 @@ func Authenticate() gin.HandlerFunc {
 //	@Tags Healthcheck
 //	@Produce	json
 //	@Success	200	{object}	health	"API metrics"
-//	@Failure	500	{string}	string	"Internal error"
+//	@Failure	500	{object}	types.ErrorResponse	"Internal error"
+//	@Failure	503	{object}	health	"Database unreachable"
 //	@Router		/health [get]
 func (ct *controller) health(c *gin.Context) {
-	health, err := getServiceHealth()
+	health, err := getServiceHealth(c, ct.service)
 	if err != nil {
-		log.Printf("error getting service health: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "error getting service health"})
+		ct.internalError(c, "error getting service health", err)
+		return
+	}
+
+	if health.Database != DATABASE_OK {
+		ct.log(c).Error("database unreachable")
+		c.JSON(http.StatusServiceUnavailable, health)
 		return
 	}
 
 	c.JSON(http.StatusOK, health)
 }
 
+// metricsHandler serves the Prometheus metrics.
+var metricsHandler = promhttp.Handler()
+
+// metrics serves the Prometheus metrics, with the stored gauges counted for
+// each scrape. Failing to count them leaves the last values.
+func (ct *controller) metrics(c *gin.Context) {
+	if err := ct.service.RefreshStoredMetrics(c); err != nil {
+		ct.log(c).Warn("error counting stored content", zap.Error(err))
+	}
+	metricsHandler.ServeHTTP(c.Writer, c.Request)
+}
+
+// healthz godoc
+//
+//	@Summary	Liveness probe, always succeeds while the process is up
+//	@Tags		Healthcheck
+//	@Produce	json
+//	@Success	200	{object}	map[string]string	"Status"
+//	@Router		/healthz [get]
+func (ct *controller) healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz godoc
+//
+//	@Summary	Readiness probe, checks the database is reachable and migrated
+//	@Tags		Healthcheck
+//	@Produce	json
+//	@Success	200	{object}	map[string]string	"Status"
+//	@Failure	503	{object}	map[string]string	"Status and reason"
+//	@Router		/readyz [get]
+func (ct *controller) readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c, pingTimeout)
+	defer cancel()
+
+	if err := ct.service.Ping(ctx); err != nil {
+		ct.log(c).Warn("database not ready", zap.Error(err))
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "reason": "database not ready"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
 // createRetrospective godoc
 //
 //	@Summary	Create Retrospective
@@ -93,76 +538,308 @@ func (ct *controller) health(c *gin.Context) {
 //	@Accept		json
 //	@Produce	json
 //	@Param		retrospective	body		types.RetrospectiveCreateRequest	true	"Create Retrospective"
-//	@Success	200				{object}	types.Retrospective					"Retrospective Object"
-//	@Failure	400				{string}	string								"Invalid input"
-//	@Failure	500				{string}	string								"Internal error"
+//	@Success	201				{object}	types.Retrospective					"Retrospective Object"
+//	@Header		201				{string}	Location							"Path of the Retrospective"
+//	@Failure	400				{object}	types.ErrorResponse								"Invalid input"
+//	@Failure	422				{object}	types.ErrorResponse								"Invalid fields, with every broken rule"
+//	@Failure	500				{object}	types.ErrorResponse								"Internal error"
 //	@Router		/retrospective [post]
 func (ct *controller) createRetrospective(c *gin.Context) {
 	var input types.RetrospectiveCreateRequest
 	if err := c.BindJSON(&input); err != nil {
-		log.Printf("error parsing body content: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body content"})
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
 		return
 	}
 
 	if err := input.ValidateCreate(); err != nil {
-		log.Printf("invalid input: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ct.invalidInput(c, err)
 		return
 	}
 
 	retrospective := types.Retrospective{
 		Name:        input.Name,
 		Description: input.Description,
+		Private:     input.Private,
 		Questions:   []types.Question{},
 	}
 
 	err := ct.service.CreateRetrospective(c, &retrospective)
 	if err != nil {
-		log.Printf("error creating retrospective: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error creating retrospective", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, retrospective)
+	setCookie(c, "retrospective_id", retrospective.ID.String(), retrospectiveCookieMaxAge(retrospective.ExpireAt), false)
+	c.Header("Location", "/api/retrospective/"+retrospective.ID.String())
+	c.JSON(http.StatusCreated, retrospective)
 }
 
-// getRetrospective godoc
+// createRetrospectiveFromTemplate godoc
 //
-//	@Summary	Get Retrospective by ID
+//	@Summary	Create Retrospective from a Template
 //	@Tags		Retrospective
+//	@Accept		json
 //	@Produce	json
-//	@Param		id	path		string				true	"Retrospective ID"
-//	@Success	200	{object}	types.Retrospective	"Retrospective Object"
-//	@Failure	400	{string}	string				"Invalid input"
-//	@Failure	404	{string}	string				"Not Found"
-//	@Failure	500	{string}	string				"Internal error"
-//	@Router		/retrospective/{id} [get]
+//	@Param		retrospective	body		types.RetrospectiveFromTemplateRequest	true	"Create Retrospective from Template"
+//	@Success	201				{object}	types.Retrospective						"Retrospective Object with its Questions"
+//	@Header		201				{string}	Location								"Path of the Retrospective"
+//	@Failure	400				{object}	types.ErrorResponse									"Invalid input"
+//	@Failure	422				{object}	types.ErrorResponse									"Invalid fields, with every broken rule"
+//	@Failure	500				{object}	types.ErrorResponse									"Internal error"
+//	@Router		/retrospective/from-template [post]
+func (ct *controller) createRetrospectiveFromTemplate(c *gin.Context) {
+	var input types.RetrospectiveFromTemplateRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := input.ValidateCreate(); err != nil {
+		ct.invalidInput(c, err)
+		return
+	}
+
+	template, _ := types.GetTemplate(input.Template)
+	retrospective := types.Retrospective{
+		Name:        input.Name,
+		Description: input.Description,
+		Private:     input.Private,
+	}
+
+	err := ct.service.CreateRetrospectiveFromTemplate(c, &retrospective, template)
+	if err != nil {
+		ct.internalError(c, "error creating retrospective from template", err)
+		return
+	}
+
+	setCookie(c, "retrospective_id", retrospective.ID.String(), retrospectiveCookieMaxAge(retrospective.ExpireAt), false)
+	c.Header("Location", "/api/retrospective/"+retrospective.ID.String())
+	c.JSON(http.StatusCreated, retrospective)
+}
+
+// importRetrospective godoc
+//
+//	@Summary		Import Retrospective
+//	@Description	Recreates an exported retrospective, as returned by GET /retrospective/{id}, with new ids. Ids, versions and dates in the body are ignored
+//	@Tags			Retrospective
+//	@Accept			json
+//	@Produce		json
+//	@Param			retrospective	body		types.RetrospectiveImportRequest	true	"Exported Retrospective"
+//	@Success		201				{object}	types.Retrospective					"Retrospective Object with its Questions and Answers"
+//	@Header			201				{string}	Location							"Path of the Retrospective"
+//	@Failure		400				{object}	types.ErrorResponse					"Invalid input"
+//	@Failure		403				{object}	types.ErrorResponse					"Question or answer limit exceeded"
+//	@Failure		422				{object}	types.ErrorResponse					"Invalid fields, with every broken rule"
+//	@Failure		500				{object}	types.ErrorResponse					"Internal error"
+//	@Router			/retrospective/import [post]
+func (ct *controller) importRetrospective(c *gin.Context) {
+	var input types.RetrospectiveImportRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := input.ValidateCreate(); err != nil {
+		ct.invalidInput(c, err)
+		return
+	}
+
+	retrospective := types.Retrospective{
+		Name:        input.Name,
+		Description: input.Description,
+		Private:     input.Private,
+		Questions:   make([]types.Question, 0, len(input.Questions)),
+	}
+	for _, question := range input.Questions {
+		answers := make([]types.Answer, 0, len(question.Answers))
+		for _, answer := range question.Answers {
+			answers = append(answers, types.Answer{Text: answer.Text, Color: answer.Color})
+		}
+		retrospective.Questions = append(retrospective.Questions, types.Question{
+			Text:    question.Text,
+			Answers: answers,
+		})
+	}
+
+	err := ct.service.ImportRetrospective(c, &retrospective)
+	if err == service.ErrQuestionLimit || err == service.ErrAnswerLimit {
+		ct.log(c).Info("import over the content limits", zap.Error(err))
+		respondError(c, http.StatusForbidden, err.Error())
+		return
+	}
+	if err != nil {
+		ct.internalError(c, "error importing retrospective", err)
+		return
+	}
+
+	setCookie(c, "retrospective_id", retrospective.ID.String(), retrospectiveCookieMaxAge(retrospective.ExpireAt), false)
+	c.Header("Location", "/api/retrospective/"+retrospective.ID.String())
+	c.JSON(http.StatusCreated, retrospective)
+}
+
+// getTemplates godoc
+//
+//	@Summary	Get built-in Retrospective Templates
+//	@Tags		Retrospective
+//	@Produce	json
+//	@Success	200	{array}	types.Template	"Templates"
+//	@Router		/templates [get]
+func (ct *controller) getTemplates(c *gin.Context) {
+	c.JSON(http.StatusOK, ct.service.GetTemplates(c))
+}
+
+// getRetrospective godoc
+//
+//	@Summary		Get Retrospective by ID
+//	@Description	During brainstorm only the answers of the requesting session are returned. Sets the retrospective_id cookie, which joins the retrospective
+//	@Tags			Retrospective
+//	@Produce		json
+//	@Param			id				path		string				true	"Retrospective ID"
+//	@Param			answers			query		bool				false	"Include answers (default true). When false, only answer counts are returned"
+//	@Param			question_id		query		string				false	"Only return this question"
+//	@Param			answers_limit	query		int					false	"Maximum number of answers per question"
+//	@Param			answers_offset	query		int					false	"Number of answers skipped in each question"
+//	@Param			sort			query		string				false	"Answers order"	Enums(position, created_at)
+//	@Param			If-None-Match	header		string				false	"ETag of a previous response"
+//	@Success		200				{object}	types.Retrospective	"Retrospective Object"
+//	@Header			200				{string}	ETag				"Weak ETag of the response"
+//	@Success		304				"Not Modified since the If-None-Match ETag"
+//	@Failure		400				{object}	types.ErrorResponse	"Invalid input"
+//	@Failure		404				{object}	types.ErrorResponse	"Not Found"
+//	@Failure		500				{object}	types.ErrorResponse	"Internal error"
+//	@Router			/retrospective/{id} [get]
 func (ct *controller) getRetrospective(c *gin.Context) {
 	input := c.Param("id")
 	id, err := uuid.Parse(input)
 	if err != nil {
-		log.Printf("error parsing path ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	withAnswers, err := strconv.ParseBool(c.DefaultQuery("answers", "true"))
+	if err != nil {
+		ct.log(c).Warn("error parsing answers query", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid answers parameter")
+		return
+	}
+
+	query, paged, err := answersQuery(c)
+	if err != nil {
+		ct.log(c).Warn("invalid answers query", zap.Error(err))
+		respondError(c, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	retro, err := ct.service.GetRetrospective(c, id)
+	var retro interface{}
+	if withAnswers && paged {
+		retro, err = ct.service.GetRetrospectivePage(c, id, query)
+	} else if withAnswers {
+		retro, err = ct.service.GetRetrospective(c, id)
+	} else {
+		retro, err = ct.service.GetRetrospectiveSummary(c, id)
+	}
+
 	if err == sql.ErrNoRows {
-		log.Printf("retrospective ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "restrospective not found"})
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
 		return
 	}
 
 	if err != nil {
-		log.Printf("error getting retrospective: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error getting retrospective", err)
 		return
 	}
 
-	c.SetSameSite(http.SameSiteNoneMode)
-	c.SetCookie("retrospective_id", id.String(), 0, "/", "", true, false)
-	c.JSON(http.StatusOK, retro)
+	// The history is a convenience, failing to update it doesn't fail the request
+	if err := ct.service.RecordVisit(c, id); err != nil {
+		ct.log(c).Warn("error recording visit", zap.Stringer("retrospective_id", id), zap.Error(err))
+	}
+
+	var expireAt time.Time
+	switch r := retro.(type) {
+	case *types.Retrospective:
+		expireAt = r.ExpireAt
+	case *types.RetrospectiveSummary:
+		expireAt = r.ExpireAt
+	}
+	setCookie(c, "retrospective_id", id.String(), retrospectiveCookieMaxAge(expireAt), false)
+
+	body, err := json.Marshal(retro)
+	if err != nil {
+		ct.internalError(c, "error encoding retrospective", err)
+		return
+	}
+
+	etag := contentETag(body)
+	c.Header("ETag", etag)
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
+
+// getVisitedRetrospectives godoc
+//
+//	@Summary	List the Retrospectives the session visited
+//	@Tags		Retrospective
+//	@Produce	json
+//	@Success	200	{array}		types.RetrospectiveVisit	"Visited Retrospectives, most recent first"
+//	@Failure	500	{object}	types.ErrorResponse			"Internal error"
+//	@Router		/session/retrospectives [get]
+func (ct *controller) getVisitedRetrospectives(c *gin.Context) {
+	visits, err := ct.service.GetVisitedRetrospectives(c)
+	if err != nil {
+		ct.internalError(c, "error getting visited retrospectives", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, visits)
+}
+
+// answersQuery parses the parameters narrowing the answers of a
+// retrospective. It reports whether any of them was given.
+func answersQuery(c *gin.Context) (types.AnswersQuery, bool, error) {
+	var query types.AnswersQuery
+	paged := false
+
+	if value, ok := c.GetQuery("question_id"); ok {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return query, false, fmt.Errorf("invalid question_id parameter")
+		}
+		query.QuestionID = id
+		paged = true
+	}
+
+	if value, ok := c.GetQuery("answers_limit"); ok {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return query, false, fmt.Errorf("invalid answers_limit parameter")
+		}
+		query.Limit = limit
+		paged = true
+	}
+
+	if value, ok := c.GetQuery("answers_offset"); ok {
+		offset, err := strconv.Atoi(value)
+		if err != nil {
+			return query, false, fmt.Errorf("invalid answers_offset parameter")
+		}
+		query.Offset = offset
+		paged = true
+	}
+
+	if value, ok := c.GetQuery("sort"); ok {
+		query.Sort = value
+		paged = true
+	}
+
+	return query, paged, query.Validate()
 }
 
 // UpdateRetrospective godoc
@@ -173,29 +850,29 @@ func (ct *controller) getRetrospective(c *gin.Context) {
 //	@Param		id				path		string								true	"Retrospective ID"
 //	@Param		retrospective	body		types.RetrospectiveCreateRequest	true	"Update Retrospective"
 //	@Success	200				{object}	types.Retrospective					"Retrospective Object"
-//	@Failure	400				{string}	string								"Invalid input"
-//	@Failure	404				{string}	string								"Not Found"
-//	@Failure	500				{string}	string								"Internal error"
+//	@Failure	400				{object}	types.ErrorResponse								"Invalid input"
+//	@Failure	404				{object}	types.ErrorResponse								"Not Found"
+//	@Failure	422				{object}	types.ErrorResponse								"Invalid fields, with every broken rule"
+//	@Failure	500				{object}	types.ErrorResponse								"Internal error"
 //	@Router		/retrospective/{id} [patch]
 func (ct *controller) updateRetrospective(c *gin.Context) {
 	input := c.Param("id")
 	id, err := uuid.Parse(input)
 	if err != nil {
-		log.Printf("error parsing path ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
 		return
 	}
 
 	var inputRetro types.RetrospectiveCreateRequest
 	if err := c.BindJSON(&inputRetro); err != nil {
-		log.Printf("error parsing body content: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body content"})
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
 		return
 	}
 
 	if err := inputRetro.ValidateUpdate(); err != nil {
-		log.Printf("invalid input: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ct.invalidInput(c, err)
 		return
 	}
 
@@ -209,14 +886,69 @@ func (ct *controller) updateRetrospective(c *gin.Context) {
 	err = ct.service.UpdateRetrospective(c, retro)
 
 	if err == sql.ErrNoRows {
-		log.Printf("retrospective ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "restrospective not found"})
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
 		return
 	}
 
 	if err != nil {
-		log.Printf("error updating retrospective: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error updating retrospective", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, retro)
+}
+
+// updateRetrospectivePhase godoc
+//
+//	@Summary	Move Retrospective to another phase
+//	@Tags		Retrospective
+//	@Accept		json
+//	@Produce	json
+//	@Param		id		path		string						true	"Retrospective ID"
+//	@Param		phase	body		types.PhaseUpdateRequest	true	"New phase"
+//	@Success	200		{object}	types.Retrospective			"Retrospective Object"
+//	@Failure	400		{object}	types.ErrorResponse						"Invalid input"
+//	@Failure	404		{object}	types.ErrorResponse						"Not Found"
+//	@Failure	500		{object}	types.ErrorResponse						"Internal error"
+//	@Router		/retrospective/{id}/phase [patch]
+func (ct *controller) updateRetrospectivePhase(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var inputPhase types.PhaseUpdateRequest
+	if err := c.BindJSON(&inputPhase); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := inputPhase.Validate(); err != nil {
+		ct.log(c).Warn("invalid input", zap.Error(err))
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	retro, err := ct.service.UpdateRetrospectivePhase(c, id, inputPhase.Phase)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	if errors.Is(err, types.ErrInvalidPhaseTransition) {
+		ct.log(c).Warn("invalid input", zap.Error(err))
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error updating retrospective phase", err)
 		return
 	}
 
@@ -228,79 +960,310 @@ func (ct *controller) updateRetrospective(c *gin.Context) {
 //	@Summary	Delete Retrospective by ID
 //	@Tags		Retrospective
 //	@Produce	json
-//	@Param		id	path		string				true	"Retrospective ID"
-//	@Success	200	{object}	types.Retrospective	"Retrospective Object"
-//	@Failure	400	{string}	string				"Invalid input"
-//	@Failure	404	{string}	string				"Not Found"
-//	@Failure	500	{string}	string				"Internal error"
-//	@Router		/retrospective/{id} [delete]
-func (ct *controller) deleteRetrospective(c *gin.Context) {
-	input := c.Param("id")
-	id, err := uuid.Parse(input)
-	if err != nil {
-		log.Printf("error parsing path ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+//	@Param		id	path		string				true	"Retrospective ID"
+//	@Success	200	{object}	types.Retrospective	"Retrospective Object"
+//	@Failure	400	{object}	types.ErrorResponse				"Invalid input"
+//	@Failure	404	{object}	types.ErrorResponse				"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse				"Internal error"
+//	@Router		/retrospective/{id} [delete]
+func (ct *controller) deleteRetrospective(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	retro, err := ct.service.DeleteRetrospective(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	if err != nil {
+		ct.log(c).Error("error deleting retrospective", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	c.JSON(http.StatusOK, retro)
+}
+
+// duplicateRetrospective godoc
+//
+//	@Summary	Duplicate the Retrospective
+//	@Tags		Retrospective
+//	@Produce	json
+//	@Param		id	path		string				true	"Retrospective ID"
+//	@Success	201	{object}	types.Retrospective	"New Retrospective Object, with the questions but no answers"
+//	@Header		201	{string}	Location			"Path of the new Retrospective"
+//	@Failure	400	{object}	types.ErrorResponse	"Invalid input"
+//	@Failure	404	{object}	types.ErrorResponse	"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse	"Internal error"
+//	@Router		/retrospective/{id}/duplicate [post]
+func (ct *controller) duplicateRetrospective(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	// Only the retrospective of the session can be copied
+	if retroID, _ := c.Get("retrospective_id"); retroID != id {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	retro, err := ct.service.DuplicateRetrospective(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error duplicating retrospective", err)
+		return
+	}
+
+	setCookie(c, "retrospective_id", retro.ID.String(), retrospectiveCookieMaxAge(retro.ExpireAt), false)
+	c.Header("Location", "/api/retrospective/"+retro.ID.String())
+	c.JSON(http.StatusCreated, retro)
+}
+
+// getRetrospectiveStats godoc
+//
+//	@Summary	Count the questions and answers of the Retrospective
+//	@Tags		Retrospective
+//	@Produce	json
+//	@Param		id	path		string						true	"Retrospective ID"
+//	@Success	200	{object}	types.RetrospectiveStats	"Retrospective stats"
+//	@Failure	400	{object}	types.ErrorResponse			"Invalid input"
+//	@Failure	404	{object}	types.ErrorResponse			"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse			"Internal error"
+//	@Router		/retrospective/{id}/stats [get]
+func (ct *controller) getRetrospectiveStats(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	// Only the retrospective of the session can be read
+	if retroID, _ := c.Get("retrospective_id"); retroID != id {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	stats, err := ct.service.GetRetrospectiveStats(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error getting retrospective stats", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// clearAnswers godoc
+//
+//	@Summary	Delete every answer of the Retrospective, keeping its questions
+//	@Tags		Retrospective
+//	@Produce	json
+//	@Param		id	path		string					true	"Retrospective ID"
+//	@Success	200	{object}	types.AnswersCleared	"Number of deleted answers"
+//	@Failure	400	{object}	types.ErrorResponse		"Invalid input"
+//	@Failure	404	{object}	types.ErrorResponse		"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse		"Internal error"
+//	@Router		/retrospective/{id}/answers [delete]
+func (ct *controller) clearAnswers(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	// Only the retrospective of the session can be cleared
+	if retroID, _ := c.Get("retrospective_id"); retroID != id {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	deleted, err := ct.service.ClearAnswers(c, id)
+	if err != nil {
+		ct.internalError(c, "error clearing answers", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, types.AnswersCleared{Deleted: deleted})
+}
+
+// createQuestion godoc
+//
+//	@Summary	Create Question
+//	@Tags		Question
+//	@Accept		json
+//	@Produce	json
+//	@Param		question	body		types.QuestionCreateRequest	true	"Create Question"
+//	@Param		Idempotency-Key	header	string	false	"Retrying with the same key returns the first response"
+//	@Success	201			{object}	types.Question				"Retrospective Object"
+//	@Header		201			{string}	Location					"Path of the Retrospective of the Question"
+//	@Failure	403			{object}	types.ErrorResponse						"Question limit reached"
+//	@Failure	409			{object}	types.ErrorResponse						"A request with the same Idempotency-Key is in progress"
+//	@Failure	422			{object}	types.ErrorResponse						"Invalid fields, with every broken rule"
+//	@Failure	500			{object}	types.ErrorResponse						"Internal error"
+//	@Router		/question [post]
+func (ct *controller) createQuestion(c *gin.Context) {
+	var input types.QuestionCreateRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := input.ValidateCreate(); err != nil {
+		ct.invalidInput(c, err)
+		return
+	}
+
+	question := &types.Question{
+		Text:    input.Text,
+		Answers: []types.Answer{},
+	}
+
+	err := ct.service.CreateQuestion(c, question)
+	if err != nil {
+		if errors.Is(err, repository.ErrForeignKey) {
+			ct.log(c).Warn("error creating question", zap.Error(err))
+			respondError(c, http.StatusBadRequest, "retrospective doesn't exist")
+			return
+		}
+		if err == service.ErrQuestionLimit {
+			ct.log(c).Info("question limit reached", zap.Error(err))
+			respondError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		ct.internalError(c, "error creating question", err)
+		return
+	}
+
+	c.Header("Location", retrospectiveLocation(c))
+	c.JSON(http.StatusCreated, question)
+}
+
+// createQuestions godoc
+//
+//	@Summary	Create several Questions at once
+//	@Tags		Question
+//	@Accept		json
+//	@Produce	json
+//	@Param		questions	body		types.QuestionsBulkCreateRequest	true	"Create Questions"
+//	@Param		Idempotency-Key	header	string	false	"Retrying with the same key returns the first response"
+//	@Success	201			{array}		types.Question						"Created Questions"
+//	@Failure	400			{object}	types.ErrorResponse								"Invalid input"
+//	@Failure	403			{object}	types.ErrorResponse								"Question limit reached"
+//	@Failure	409			{object}	types.ErrorResponse								"A request with the same Idempotency-Key is in progress"
+//	@Failure	422			{object}	types.ErrorResponse								"Invalid fields, with every broken rule"
+//	@Failure	500			{object}	types.ErrorResponse								"Internal error"
+//	@Router		/questions/bulk [post]
+func (ct *controller) createQuestions(c *gin.Context) {
+	var input types.QuestionsBulkCreateRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
 		return
 	}
 
-	retro, err := ct.service.DeleteRetrospective(c, id)
-	if err == sql.ErrNoRows {
-		log.Printf("retrospective ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "restrospective not found"})
+	if err := input.ValidateCreate(); err != nil {
+		ct.invalidInput(c, err)
 		return
 	}
 
+	questions := make([]*types.Question, 0, len(input.Questions))
+	for _, question := range input.Questions {
+		questions = append(questions, &types.Question{
+			Text:    question.Text,
+			Answers: []types.Answer{},
+		})
+	}
+
+	err := ct.service.CreateQuestions(c, questions)
 	if err != nil {
-		log.Printf("error deleting retrospective: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		if errors.Is(err, repository.ErrForeignKey) {
+			ct.log(c).Warn("error creating questions", zap.Error(err))
+			respondError(c, http.StatusBadRequest, "retrospective doesn't exist")
+			return
+		}
+		if err == service.ErrQuestionLimit {
+			ct.log(c).Info("question limit reached", zap.Error(err))
+			respondError(c, http.StatusForbidden, err.Error())
+			return
+		}
+		ct.internalError(c, "error creating questions", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, retro)
+	c.JSON(http.StatusCreated, questions)
 }
 
-// createQuestion godoc
+// duplicateQuestion godoc
 //
-//	@Summary	Create Question
+//	@Summary	Duplicate Question by ID
 //	@Tags		Question
-//	@Accept		json
 //	@Produce	json
-//	@Param		question	body		types.QuestionCreateRequest	true	"Create Question"
-//	@Success	200			{object}	types.Question				"Retrospective Object"
-//	@Failure	500			{string}	string						"Internal error"
-//	@Router		/question [post]
-func (ct *controller) createQuestion(c *gin.Context) {
-	var input types.QuestionCreateRequest
-	if err := c.BindJSON(&input); err != nil {
-		log.Printf("error parsing body content: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body content"})
+//	@Param		id	path		string			true	"Question ID"
+//	@Success	201	{object}	types.Question	"New Question Object, without answers"
+//	@Header		201	{string}	Location		"Path of the Retrospective of the Question"
+//	@Failure	400	{object}	types.ErrorResponse			"Invalid input"
+//	@Failure	403	{object}	types.ErrorResponse			"Question limit reached"
+//	@Failure	404	{object}	types.ErrorResponse			"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse			"Internal error"
+//	@Router		/question/{id}/duplicate [post]
+func (ct *controller) duplicateQuestion(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
 		return
 	}
 
-	if err := input.ValidateCreate(); err != nil {
-		log.Printf("invalid input: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	question, err := ct.service.DuplicateQuestion(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("question not found", zap.Stringer("question_id", id))
+		respondError(c, http.StatusNotFound, "question not found")
 		return
 	}
 
-	question := &types.Question{
-		Text:    input.Text,
-		Answers: []types.Answer{},
+	if err == service.ErrQuestionLimit {
+		ct.log(c).Info("question limit reached", zap.Error(err))
+		respondError(c, http.StatusForbidden, err.Error())
+		return
 	}
 
-	err := ct.service.CreateQuestion(c, question)
 	if err != nil {
-		if err.Error() == "FOREIGN KEY constraint failed" {
-			log.Printf("error creating question: %s", err.Error())
-			c.JSON(http.StatusBadRequest, gin.H{"error": "retrospective doesn't exist"})
-			return
-		}
-		log.Printf("error creating question: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error duplicating question", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, question)
+	c.Header("Location", retrospectiveLocation(c))
+	c.JSON(http.StatusCreated, question)
 }
 
 // updateQuestion godoc
@@ -311,29 +1274,29 @@ func (ct *controller) createQuestion(c *gin.Context) {
 //	@Param		id				path		string						true	"Question ID"
 //	@Param		retrospective	body		types.QuestionCreateRequest	true	"Update Question"
 //	@Success	200				{object}	types.Retrospective			"Question Object"
-//	@Failure	400				{string}	string						"Invalid input"
-//	@Failure	404				{string}	string						"Not Found"
-//	@Failure	500				{string}	string						"Internal error"
+//	@Failure	400				{object}	types.ErrorResponse						"Invalid input"
+//	@Failure	404				{object}	types.ErrorResponse						"Not Found"
+//	@Failure	422				{object}	types.ErrorResponse						"Invalid fields, with every broken rule"
+//	@Failure	500				{object}	types.ErrorResponse						"Internal error"
 //	@Router		/question/{id} [patch]
 func (ct *controller) updateQuestion(c *gin.Context) {
 	input := c.Param("id")
 	id, err := uuid.Parse(input)
 	if err != nil {
-		log.Printf("error parsing path ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
 		return
 	}
 
 	var inputQuestion types.QuestionCreateRequest
 	if err := c.BindJSON(&inputQuestion); err != nil {
-		log.Printf("error parsing body content: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body content"})
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
 		return
 	}
 
 	if err := inputQuestion.ValidateCreate(); err != nil {
-		log.Printf("invalid input: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ct.invalidInput(c, err)
 		return
 	}
 
@@ -346,14 +1309,13 @@ func (ct *controller) updateQuestion(c *gin.Context) {
 	err = ct.service.UpdateQuestion(c, question)
 
 	if err == sql.ErrNoRows {
-		log.Printf("question ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "question not found"})
+		ct.log(c).Info("question not found", zap.Stringer("question_id", id))
+		respondError(c, http.StatusNotFound, "question not found")
 		return
 	}
 
 	if err != nil {
-		log.Printf("error updating question: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error updating question", err)
 		return
 	}
 
@@ -365,31 +1327,65 @@ func (ct *controller) updateQuestion(c *gin.Context) {
 //	@Summary	Delete Question by ID
 //	@Tags		Question
 //	@Produce	json
-//	@Param		id	path		string			true	"Question ID"
-//	@Success	200	{object}	types.Question	"Question Object"
-//	@Failure	400	{string}	string			"Invalid input"
-//	@Failure	404	{string}	string			"Not Found"
-//	@Failure	500	{string}	string			"Internal error"
+//	@Param		id				path		string			true	"Question ID"
+//	@Param		move_answers_to	query		string			false	"Question of the same Retrospective receiving the answers instead of deleting them"
+//	@Success	200				{object}	types.Question	"Question Object, with the moved answers"
+//	@Failure	400				{object}	types.ErrorResponse			"Invalid input"
+//	@Failure	403	{object}	types.ErrorResponse			"Answer limit of the target question reached"
+//	@Failure	404	{object}	types.ErrorResponse			"Not Found"
+//	@Failure	409	{object}	types.ErrorResponse			"Answers can't be moved during brainstorm"
+//	@Failure	500	{object}	types.ErrorResponse			"Internal error"
 //	@Router		/question/{id} [delete]
 func (ct *controller) deleteQuestion(c *gin.Context) {
 	input := c.Param("id")
 	id, err := uuid.Parse(input)
 	if err != nil {
-		log.Printf("error parsing path ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var question *types.Question
+	if moveTo, ok := c.GetQuery("move_answers_to"); ok {
+		targetID, parseErr := uuid.Parse(moveTo)
+		if parseErr != nil {
+			ct.log(c).Warn("error parsing move_answers_to", zap.Error(parseErr))
+			respondError(c, http.StatusBadRequest, "invalid move_answers_to")
+			return
+		}
+
+		question, err = ct.service.MoveAnswersAndDeleteQuestion(c, id, targetID)
+	} else {
+		question, err = ct.service.DeleteQuestion(c, id)
+	}
+
+	if err == repository.ErrInvalidMoveTarget {
+		ct.log(c).Info("invalid target question", zap.Stringer("question_id", id))
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err == service.ErrAnswersHidden {
+		ct.log(c).Info("answers hidden", zap.Stringer("question_id", id))
+		respondError(c, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err == service.ErrAnswerLimit {
+		ct.log(c).Info("answer limit reached", zap.Stringer("question_id", id))
+		respondError(c, http.StatusForbidden, err.Error())
 		return
 	}
 
-	question, err := ct.service.DeleteQuestion(c, id)
 	if err == sql.ErrNoRows {
-		log.Printf("question ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "question not found"})
+		ct.log(c).Info("question not found", zap.Stringer("question_id", id))
+		respondError(c, http.StatusNotFound, "question not found")
 		return
 	}
 
 	if err != nil {
-		log.Printf("error deleting question: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		ct.log(c).Error("error deleting question", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
 		return
 	}
 
@@ -402,34 +1398,129 @@ func (ct *controller) deleteQuestion(c *gin.Context) {
 //	@Tags		Websocket
 //	@Accept		json
 //	@Produce	json
-//	@Param		id	path		string	true	"Repository ID"
-//	@Failure	500	{string}	string	"Internal error"
+//	@Param		id				path		string	true	"Repository ID"
+//	@Param		suppress_echo	query		bool	false	"Don't send back the changes made by the session"
+//	@Param		since			query		int		false	"Replay the changes after this seq, sent with each change"
+//	@Param		Sec-WebSocket-Protocol	header	string	false	"Version of the message schema, simple-retro.v1 or simple-retro.v2, simple-retro.v1 when missing"
+//	@Failure	401	{object}	types.ErrorResponse	"Private retrospective the client didn't join"
+//	@Failure	500	{object}	types.ErrorResponse	"Internal error"
 //	@Router		/hello [get]
 func (ct *controller) subscribeChanges(c *gin.Context) {
 	var err error
 	retroIDparam := c.Param("id")
 	if retroIDparam == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not in any retrospective"})
+		respondError(c, http.StatusUnauthorized, "not in any retrospective")
 		return
 	}
 
 	retroID, err := uuid.Parse(retroIDparam)
 	if err != nil {
-		log.Printf("error parsing retrospective_id: %s", err.Error())
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "not in any retrospective"})
+		ct.log(c).Warn("error parsing retrospective_id", zap.Error(err))
+		respondError(c, http.StatusUnauthorized, "not in any retrospective")
 		return
 	}
 	c.Set("retrospective_id", retroID)
 
+	// Private retrospectives only stream to clients that joined them
+	retro, err := ct.service.GetRetrospectiveSummary(c, retroID)
+	if err != nil && err != sql.ErrNoRows {
+		ct.internalError(c, "error getting retrospective", err)
+		return
+	}
+
+	if retro != nil && retro.Private {
+		cookieID, err := retrospectiveFromCookie(c)
+		if err != nil || cookieID != retroID {
+			ct.log(c).Info("refused subscription to private retrospective")
+			respondError(c, http.StatusUnauthorized, "not in this retrospective")
+			return
+		}
+	}
+
 	err = ct.service.SubscribeChanges(c, c.Writer, c.Request)
+	if errors.Is(err, repository.ErrTooManyConnections) {
+		ct.log(c).Warn("error subscribing", zap.Error(err))
+		respondError(c, http.StatusServiceUnavailable, "too many connections")
+		return
+	}
+
+	if err != nil {
+		ct.log(c).Warn("error subscribing", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "error subscribing: "+err.Error())
+		return
+	}
+
+	c.JSON(http.StatusOK, types.APIResponse{Message: "ok"})
+}
+
+// getAnswers godoc
+//
+//	@Summary	Get answers of a Question
+//	@Tags		Question
+//	@Produce	json
+//	@Param		id	path		string			true	"Question ID"
+//	@Success	200	{array}		types.Answer	"Answers ordered by position"
+//	@Failure	400	{object}	types.ErrorResponse			"Invalid input"
+//	@Failure	404	{object}	types.ErrorResponse			"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse			"Internal error"
+//	@Router		/question/{id}/answers [get]
+func (ct *controller) getAnswers(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	answers, err := ct.service.GetAnswers(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("question not found", zap.Stringer("question_id", id))
+		respondError(c, http.StatusNotFound, "question not found")
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error getting answers", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, answers)
+}
+
+// getAnswerContext godoc
+//
+//	@Summary	Get an Answer with its Question and sibling Answers
+//	@Tags		Answer
+//	@Produce	json
+//	@Param		id	path		string				true	"Answer ID"
+//	@Success	200	{object}	types.AnswerContext	"Answer, Question and the other Answers ordered by position"
+//	@Failure	400	{object}	types.ErrorResponse				"Invalid input"
+//	@Failure	404	{object}	types.ErrorResponse				"Not Found"
+//	@Failure	500	{object}	types.ErrorResponse				"Internal error"
+//	@Router		/answer/{id}/context [get]
+func (ct *controller) getAnswerContext(c *gin.Context) {
+	input := c.Param("id")
+	id, err := uuid.Parse(input)
 	if err != nil {
-		errMessage := fmt.Errorf("error subscribing: %s", err.Error())
-		log.Println(errMessage)
-		c.JSON(http.StatusBadRequest, gin.H{"error": errMessage})
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
 		return
 	}
 
-	c.JSON(http.StatusOK, "ok")
+	answerContext, err := ct.service.GetAnswerContext(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("answer not found", zap.Stringer("answer_id", id))
+		respondError(c, http.StatusNotFound, "answer not found")
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error getting answer context", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, answerContext)
 }
 
 // createAnswer godoc
@@ -439,37 +1530,129 @@ func (ct *controller) subscribeChanges(c *gin.Context) {
 //	@Accept		json
 //	@Produce	json
 //	@Param		question	body		types.AnswerCreateRequest	true	"Create Answer"
-//	@Success	200			{object}	types.Answer				"Retrospective Object"
-//	@Failure	400			{string}	string						"Invalid input"
-//	@Failure	500			{string}	string						"Internal error"
+//	@Param		Idempotency-Key	header	string	false	"Retrying with the same key returns the first response"
+//	@Success	201			{object}	types.Answer				"Retrospective Object"
+//	@Header		201			{string}	Location					"Path of the Retrospective of the Answer"
+//	@Failure	400			{object}	types.ErrorResponse						"Invalid input"
+//	@Failure	403			{object}	types.ErrorResponse						"Answer limit reached"
+//	@Failure	404			{object}	types.ErrorResponse						"Question not found in the retrospective"
+//	@Failure	409			{object}	types.ErrorResponse						"A request with the same Idempotency-Key is in progress"
+//	@Failure	422			{object}	types.ErrorResponse						"Invalid fields, with every broken rule"
+//	@Failure	500			{object}	types.ErrorResponse						"Internal error"
 //	@Router		/answer [post]
 func (ct *controller) createAnswer(c *gin.Context) {
 	var input *types.AnswerCreateRequest
 	if err := c.BindJSON(&input); err != nil {
-		log.Printf("error parsing body content: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body content"})
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
 		return
 	}
 
 	if err := input.ValidateCreate(); err != nil {
-		log.Printf("invalid input: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ct.invalidInput(c, err)
 		return
 	}
 
 	answer := &types.Answer{
-		QuestionID: input.QuestionID,
+		QuestionID: c.MustGet("question_id").(uuid.UUID),
 		Text:       input.Text,
+		Color:      input.Color,
 	}
 
+	// ResolveQuestion already checked the question, it can only be missing
+	// here if it was deleted meanwhile
 	err := ct.service.CreateAnswer(c, answer)
+	if err == sql.ErrNoRows || errors.Is(err, repository.ErrForeignKey) {
+		ct.log(c).Info("question not found", zap.Stringer("question_id", answer.QuestionID))
+		respondError(c, http.StatusNotFound, "question not found")
+		return
+	}
+
+	if err == service.ErrAnswerLimit {
+		ct.log(c).Info("answer limit reached", zap.Stringer("question_id", answer.QuestionID))
+		respondError(c, http.StatusForbidden, err.Error())
+		return
+	}
+
 	if err != nil {
-		log.Printf("error creating answer: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error creating answer", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, answer)
+	// Only the author gets the answer flagged as its own, the broadcast
+	// above is sent to everyone else with mine set to false.
+	answer.Mine = true
+
+	c.Header("Location", retrospectiveLocation(c))
+	c.JSON(http.StatusCreated, answer)
+}
+
+// createAnswers godoc
+//
+//	@Summary	Create several Answers of a Question at once
+//	@Tags		Answer
+//	@Accept		json
+//	@Produce	json
+//	@Param		answers	body		types.AnswersBulkCreateRequest	true	"Create Answers"
+//	@Param		Idempotency-Key	header	string	false	"Retrying with the same key returns the first response"
+//	@Success	201		{array}		types.Answer					"Created Answers, in order"
+//	@Failure	400		{object}	types.ErrorResponse							"Invalid input"
+//	@Failure	403		{object}	types.ErrorResponse							"Answer limit reached"
+//	@Failure	404		{object}	types.ErrorResponse							"Question not found in the retrospective"
+//	@Failure	409		{object}	types.ErrorResponse							"A request with the same Idempotency-Key is in progress"
+//	@Failure	422		{object}	types.ErrorResponse							"Invalid fields, with every broken rule"
+//	@Failure	500		{object}	types.ErrorResponse							"Internal error"
+//	@Router		/answer/bulk [post]
+func (ct *controller) createAnswers(c *gin.Context) {
+	var input types.AnswersBulkCreateRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := input.ValidateCreate(); err != nil {
+		ct.invalidInput(c, err)
+		return
+	}
+
+	questionID := c.MustGet("question_id").(uuid.UUID)
+	answers := make([]*types.Answer, 0, len(input.Texts))
+	for _, text := range input.Texts {
+		answers = append(answers, &types.Answer{
+			QuestionID: questionID,
+			Text:       text,
+		})
+	}
+
+	err := ct.service.CreateAnswers(c, answers)
+	if err == sql.ErrNoRows || errors.Is(err, repository.ErrForeignKey) {
+		ct.log(c).Info("question not found", zap.Stringer("question_id", questionID))
+		respondError(c, http.StatusNotFound, "question not found")
+		return
+	}
+
+	if err == service.ErrAnswerLimit {
+		ct.log(c).Info("answer limit reached", zap.Stringer("question_id", questionID))
+		respondError(c, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error creating answers", err)
+		return
+	}
+
+	// The broadcast may still hold the answers, only copies are flagged as
+	// the author's own
+	created := make([]types.Answer, 0, len(answers))
+	for _, answer := range answers {
+		mine := *answer
+		mine.Mine = true
+		created = append(created, mine)
+	}
+
+	c.JSON(http.StatusCreated, created)
 }
 
 // updateAnswer godoc
@@ -481,47 +1664,55 @@ func (ct *controller) createAnswer(c *gin.Context) {
 //	@Param		id		path		string						true	"Answer ID"
 //	@Param		answer	body		types.AnswerCreateRequest	true	"Update Answer"
 //	@Success	200		{object}	types.Answer				"Answer Object"
-//	@Failure	400		{string}	string						"Invalid input"
-//	@Failure	500		{string}	string						"Internal error"
+//	@Failure	400		{object}	types.ErrorResponse						"Invalid input"
+//	@Failure	409		{object}	types.ErrorResponse						"Answer was modified since the given version"
+//	@Failure	422		{object}	types.ErrorResponse						"Invalid fields, with every broken rule"
+//	@Failure	500		{object}	types.ErrorResponse						"Internal error"
 //	@Router		/answer/{id} [patch]
 func (ct *controller) updateAnswer(c *gin.Context) {
 	input := c.Param("id")
 	id, err := uuid.Parse(input)
 	if err != nil {
-		log.Printf("error parsing path question ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid question id"})
+		ct.log(c).Warn("error parsing path question ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid question id")
 		return
 	}
 
 	var inputAnswer *types.AnswerCreateRequest
 	if err := c.BindJSON(&inputAnswer); err != nil {
-		log.Printf("error parsing body content: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid body content"})
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
 		return
 	}
 
 	if err := inputAnswer.ValidateCreate(); err != nil {
-		log.Printf("invalid input: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		ct.invalidInput(c, err)
 		return
 	}
 
 	answer := &types.Answer{
 		ID:         id,
-		QuestionID: inputAnswer.QuestionID,
+		QuestionID: c.MustGet("question_id").(uuid.UUID),
 		Text:       inputAnswer.Text,
+		Color:      inputAnswer.Color,
+		Version:    inputAnswer.Version,
 	}
 
 	err = ct.service.UpdateAnswer(c, answer)
 	if err == sql.ErrNoRows {
-		log.Printf("answer ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "answer not found"})
+		ct.log(c).Info("answer not found", zap.Stringer("answer_id", id))
+		respondError(c, http.StatusNotFound, "answer not found")
+		return
+	}
+
+	if err == repository.ErrConflict {
+		ct.log(c).Info("answer was modified", zap.Stringer("answer_id", id), zap.Int("version", inputAnswer.Version))
+		respondError(c, http.StatusConflict, "answer was modified")
 		return
 	}
 
 	if err != nil {
-		log.Printf("error updating answer: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error updating answer", err)
 		return
 	}
 
@@ -536,15 +1727,15 @@ func (ct *controller) updateAnswer(c *gin.Context) {
 //	@Produce	json
 //	@Param		id	path		string			true	"Answer ID"
 //	@Success	200	{object}	types.Answer	"Answer Object"
-//	@Failure	400	{string}	string			"Invalid input"
-//	@Failure	500	{string}	string			"Internal error"
+//	@Failure	400	{object}	types.ErrorResponse			"Invalid input"
+//	@Failure	500	{object}	types.ErrorResponse			"Internal error"
 //	@Router		/answer/{id} [delete]
 func (ct *controller) deleteAnswer(c *gin.Context) {
 	input := c.Param("id")
 	id, err := uuid.Parse(input)
 	if err != nil {
-		log.Printf("error parsing path question ID: %s", err.Error())
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid question id"})
+		ct.log(c).Warn("error parsing path question ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid question id")
 		return
 	}
 
@@ -553,33 +1744,253 @@ func (ct *controller) deleteAnswer(c *gin.Context) {
 	}
 	err = ct.service.DeleteAnswer(c, answer)
 	if err == sql.ErrNoRows {
-		log.Printf("answer ID %s not found", id.String())
-		c.JSON(http.StatusNotFound, gin.H{"error": "answer not found"})
+		ct.log(c).Info("answer not found", zap.Stringer("answer_id", id))
+		respondError(c, http.StatusNotFound, "answer not found")
 		return
 	}
 
 	if err != nil {
-		log.Printf("error deleting answer: %s", err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal server error"})
+		ct.internalError(c, "error deleting answer", err)
 		return
 	}
 
 	c.JSON(http.StatusOK, answer)
 }
 
+// mergeAnswers godoc
+//
+//	@Summary		Merge two Answers
+//	@Description	Appends the text of the source answer to the target and deletes the source. During brainstorm only the answers of the session can be merged
+//	@Tags			Answer
+//	@Accept			json
+//	@Produce		json
+//	@Param			merge	body		types.AnswerMergeRequest	true	"Answers to merge"
+//	@Success		200		{object}	types.Answer				"Merged Answer"
+//	@Failure		400		{object}	types.ErrorResponse			"Invalid input"
+//	@Failure		404		{object}	types.ErrorResponse			"Not Found, or written by another session during brainstorm"
+//	@Failure		500		{object}	types.ErrorResponse			"Internal error"
+//	@Router			/answer/merge [post]
+func (ct *controller) mergeAnswers(c *gin.Context) {
+	var input types.AnswerMergeRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := input.Validate(); err != nil {
+		ct.log(c).Warn("invalid input", zap.Error(err))
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	source := &types.Answer{ID: input.SourceID}
+	target := &types.Answer{ID: input.TargetID}
+	err := ct.service.MergeAnswers(c, source, target)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("answer not found", zap.Stringer("source_id", input.SourceID), zap.Stringer("target_id", input.TargetID))
+		respondError(c, http.StatusNotFound, "answer not found")
+		return
+	}
+
+	if err == repository.ErrDifferentQuestions || err == types.ErrMergeTooBig {
+		ct.log(c).Info("answers can't be merged", zap.Error(err))
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error merging answers", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, target)
+}
+
+// previewCleanUp godoc
+//
+//	@Summary		Preview the clean up
+//	@Description	Lists the retrospectives the clean up would delete now, without deleting them
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string					true	"Admin token"
+//	@Success		200				{object}	types.CleanUpPreview	"Retrospectives to be deleted"
+//	@Failure		401				{object}	types.ErrorResponse		"Invalid admin token"
+//	@Failure		500				{object}	types.ErrorResponse		"Internal error"
+//	@Router			/admin/cleanup/preview [get]
+func (ct *controller) previewCleanUp(c *gin.Context) {
+	preview, err := ct.service.PreviewCleanUp(c)
+	if err != nil {
+		ct.internalError(c, "error previewing clean up", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// listRetrospectives godoc
+//
+//	@Summary		List Retrospectives
+//	@Description	Lists the retrospectives whose name contains search, the most recent first, a page at a time
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string					true	"Admin token"
+//	@Param			search			query		string					false	"Part of the name, case insensitive"
+//	@Param			page			query		int						false	"Page, starting at 1"
+//	@Param			size			query		int						false	"Retrospectives per page, 20 by default and at most 100"
+//	@Success		200				{object}	types.RetrospectiveList	"Page of retrospectives"
+//	@Failure		400				{object}	types.ErrorResponse		"Invalid input"
+//	@Failure		401				{object}	types.ErrorResponse		"Invalid admin token"
+//	@Failure		500				{object}	types.ErrorResponse		"Internal error"
+//	@Router			/admin/retrospectives [get]
+func (ct *controller) listRetrospectives(c *gin.Context) {
+	search := types.RetrospectiveSearch{Search: c.Query("search")}
+
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil {
+		ct.invalidInput(c, fmt.Errorf("invalid page parameter"))
+		return
+	}
+	search.Page = page
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(types.SEARCH_PAGE_SIZE)))
+	if err != nil {
+		ct.invalidInput(c, fmt.Errorf("invalid size parameter"))
+		return
+	}
+	search.Size = size
+
+	if err := search.Validate(); err != nil {
+		ct.invalidInput(c, err)
+		return
+	}
+
+	list, err := ct.service.SearchRetrospectives(c, search)
+	if err != nil {
+		ct.internalError(c, "error listing retrospectives", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// setRetrospectiveExpiry godoc
+//
+//	@Summary		Set when a Retrospective expires
+//	@Description	Sets the expiry to expire_at, or extend_days after the current one. The clean up then follows it instead of the retention
+//	@Tags			Admin
+//	@Accept			json
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string							true	"Admin token"
+//	@Param			id				path		string							true	"Retrospective ID"
+//	@Param			expiry			body		types.RetrospectiveExpiryRequest	true	"New expiry"
+//	@Success		200				{object}	types.RetrospectiveSummary		"Retrospective with its new expiry"
+//	@Failure		400				{object}	types.ErrorResponse				"Invalid input"
+//	@Failure		401				{object}	types.ErrorResponse				"Invalid admin token"
+//	@Failure		404				{object}	types.ErrorResponse				"Not Found"
+//	@Failure		500				{object}	types.ErrorResponse				"Internal error"
+//	@Router			/admin/retrospective/{id}/ttl [patch]
+func (ct *controller) setRetrospectiveExpiry(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	var input types.RetrospectiveExpiryRequest
+	if err := c.BindJSON(&input); err != nil {
+		ct.log(c).Warn("error parsing body content", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid body content")
+		return
+	}
+
+	if err := input.Validate(time.Now()); err != nil {
+		ct.log(c).Warn("invalid input", zap.Error(err))
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	retro, err := ct.service.SetRetrospectiveExpiry(c, id, input)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error setting retrospective expiry", err)
+		return
+	}
+
+	ct.log(c).Info("retrospective expiry set", zap.Stringer("retrospective_id", id), zap.Time("expire_at", retro.ExpireAt))
+	c.JSON(http.StatusOK, retro)
+}
+
+// purgeRetrospective godoc
+//
+//	@Summary		Delete a Retrospective right away
+//	@Description	Deletes any retrospective, whatever the cookie of the caller, and disconnects its subscribers
+//	@Tags			Admin
+//	@Produce		json
+//	@Param			X-Admin-Token	header		string				true	"Admin token"
+//	@Param			id				path		string				true	"Retrospective ID"
+//	@Success		200				{object}	types.Retrospective	"Deleted Retrospective"
+//	@Failure		400				{object}	types.ErrorResponse	"Invalid input"
+//	@Failure		401				{object}	types.ErrorResponse	"Invalid admin token"
+//	@Failure		404				{object}	types.ErrorResponse	"Not Found"
+//	@Failure		500				{object}	types.ErrorResponse	"Internal error"
+//	@Router			/admin/retrospective/{id} [delete]
+func (ct *controller) purgeRetrospective(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		ct.log(c).Warn("error parsing path ID", zap.Error(err))
+		respondError(c, http.StatusBadRequest, "invalid id")
+		return
+	}
+
+	retro, err := ct.service.DeleteRetrospective(c, id)
+	if err == sql.ErrNoRows {
+		ct.log(c).Info("retrospective not found", zap.Stringer("retrospective_id", id))
+		respondError(c, http.StatusNotFound, "restrospective not found")
+		return
+	}
+
+	if err != nil {
+		ct.internalError(c, "error purging retrospective", err)
+		return
+	}
+
+	ct.log(c).Info("retrospective purged", zap.Stringer("retrospective_id", id))
+	c.JSON(http.StatusOK, retro)
+}
+
 // getLimits godoc
 //
-//	@Summary	Get API limits
-//	@Produce	json
-//	@Success	200	{object}	types.ApiLimits	"API limits"
-//	@Failure	500	{string}	string	"Internal error"
-//	@Router		/limits [get]
+//	@Summary		Get API limits
+//	@Description	Maximum length of each field, counted in characters rather than bytes
+//	@Produce		json
+//	@Success		200	{object}	types.ApiLimits	"API limits"
+//	@Failure		500	{object}	types.ErrorResponse	"Internal error"
+//	@Router			/limits [get]
 func (ct *controller) getLimits(c *gin.Context) {
 	limits := ct.service.GetLimits(c)
 
 	c.JSON(http.StatusOK, limits)
 }
 
+// getFeatures godoc
+//
+//	@Summary	Get optional features enabled on this deployment
+//	@Produce	json
+//	@Success	200	{object}	map[string]bool	"Feature name to enabled"
+//	@Router		/features [get]
+func (ct *controller) getFeatures(c *gin.Context) {
+	features := ct.service.GetFeatures(c)
+
+	c.JSON(http.StatusOK, features)
+}
+
 // @license.name	MIT
 // @license.url	https://github.com/simple-retro/api/blob/master/LICENSE
 func (c *controller) Start() {
@@ -593,7 +2004,58 @@ func (c *controller) Start() {
 	docs.SwaggerInfo.BasePath = "/api"
 	docs.SwaggerInfo.Schemes = []string{"http", "https"}
 
-	router := gin.Default()
+	router := c.router()
+	router.Run(fmt.Sprintf(":%d", config.Server.Port))
+}
+
+// allowedMethods lists the methods routed for a path, sorted, for the Allow
+// header of 405 answers.
+func allowedMethods(routes gin.RoutesInfo, path string) []string {
+	methods := []string{}
+	for _, route := range routes {
+		if routeMatches(route.Path, path) && !slices.Contains(methods, route.Method) {
+			methods = append(methods, route.Method)
+		}
+	}
+	slices.Sort(methods)
+	return methods
+}
+
+// routeMatches reports whether a path matches a route template, where a
+// :param matches one segment and a *param the rest of the path.
+func routeMatches(template, path string) bool {
+	templateParts := strings.Split(strings.Trim(template, "/"), "/")
+	pathParts := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i, part := range templateParts {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(pathParts) {
+			return false
+		}
+		if !strings.HasPrefix(part, ":") && part != pathParts[i] {
+			return false
+		}
+	}
+	return len(templateParts) == len(pathParts)
+}
+
+func (c *controller) router() *gin.Engine {
+	config := config.Get()
+
+	router := gin.New()
+	router.Use(RequestID(), Logger(c.logger), Metrics(), gin.Recovery())
+	router.HandleMethodNotAllowed = true
+	router.NoMethod(func(ctx *gin.Context) {
+		ctx.Header("Allow", strings.Join(allowedMethods(router.Routes(), ctx.Request.URL.Path), ", "))
+		respondError(ctx, http.StatusMethodNotAllowed, "method not allowed")
+	})
+
+	// Kept out of /api so CORS and authentication never apply to them
+	router.GET("/metrics", c.metrics)
+	router.GET("/healthz", c.healthz)
+	router.GET("/readyz", c.readyz)
 
 	if config.Server.WithCors {
 		router.Use(CORSMiddleware())
@@ -604,23 +2066,50 @@ func (c *controller) Start() {
 	}
 
 	api := router.Group("/api")
+	api.Use(Session(), BodyLimit())
 	api.GET("/health", c.health)
 	api.POST("/retrospective", c.createRetrospective)
+	api.POST("/retrospective/from-template", c.createRetrospectiveFromTemplate)
+	api.POST("/retrospective/import", c.importRetrospective)
+	api.GET("/templates", c.getTemplates)
 	api.GET("/retrospective/:id", c.getRetrospective)
+	api.GET("/session/retrospectives", c.getVisitedRetrospectives)
 	api.PATCH("/retrospective/:id", c.updateRetrospective)
 	api.DELETE("/retrospective/:id", c.deleteRetrospective)
+	api.GET("/features", c.getFeatures)
+	if config.Features.Phases {
+		api.PATCH("/retrospective/:id/phase", c.updateRetrospectivePhase)
+	}
 	api.GET("/hello/:id", c.subscribeChanges)
 	api.GET("/limits", c.getLimits)
 
+	if config.Admin.Token != "" {
+		admin := api.Group("/admin")
+		admin.Use(AdminAuth(c.logger))
+		admin.GET("/cleanup/preview", c.previewCleanUp)
+		admin.GET("/retrospectives", c.listRetrospectives)
+		admin.PATCH("/retrospective/:id/ttl", c.setRetrospectiveExpiry)
+		admin.DELETE("/retrospective/:id", c.purgeRetrospective)
+	}
+
 	authorized := api.Group("/")
-	authorized.Use(Authenticate())
-	authorized.POST("/question", c.createQuestion)
+	authorized.Use(Authenticate(c.logger))
+	authorized.GET("/retrospective/:id/stats", c.getRetrospectiveStats)
+	authorized.POST("/retrospective/:id/duplicate", c.duplicateRetrospective)
+	authorized.DELETE("/retrospective/:id/answers", c.clearAnswers)
+	authorized.POST("/question", Idempotent(c.service, c.logger), c.createQuestion)
+	authorized.POST("/questions/bulk", Idempotent(c.service, c.logger), c.createQuestions)
+	authorized.POST("/question/:id/duplicate", c.duplicateQuestion)
 	authorized.PATCH("/question/:id", c.updateQuestion)
 	authorized.DELETE("/question/:id", c.deleteQuestion)
+	authorized.GET("/question/:id/answers", c.getAnswers)
 
-	authorized.POST("/answer", c.createAnswer)
-	authorized.PATCH("/answer/:id", c.updateAnswer)
+	authorized.GET("/answer/:id/context", c.getAnswerContext)
+	authorized.POST("/answer", Idempotent(c.service, c.logger), ResolveQuestion(c.service, c.logger), c.createAnswer)
+	authorized.POST("/answer/bulk", Idempotent(c.service, c.logger), ResolveQuestion(c.service, c.logger), c.createAnswers)
+	authorized.PATCH("/answer/:id", ResolveQuestion(c.service, c.logger), c.updateAnswer)
 	authorized.DELETE("/answer/:id", c.deleteAnswer)
+	authorized.POST("/answer/merge", c.mergeAnswers)
 
-	router.Run(fmt.Sprintf(":%d", config.Server.Port))
+	return router
 }
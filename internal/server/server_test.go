@@ -0,0 +1,2020 @@
+package server
+
+import (
+	"api/config"
+	"api/internal/repository"
+	"api/internal/service"
+	"api/types"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// newTestController builds a controller backed by the test database.
+func newTestController(t *testing.T) *controller {
+	gin.SetMode(gin.TestMode)
+
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	repo, err := repository.NewSQLite()
+	assert.Nilf(t, err, "error connecting to database")
+
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	logger := zap.NewNop()
+	return New(service.New(repo, wsrepo, logger), logger)
+}
+
+// unreachableRepository fails every database ping.
+type unreachableRepository struct {
+	repository.Repository
+}
+
+func (unreachableRepository) Ping(ctx context.Context) error {
+	return errors.New("database is locked")
+}
+
+func (unreachableRepository) GetRetrospectiveSummary(ctx context.Context, id uuid.UUID) (*types.RetrospectiveSummary, error) {
+	return nil, errors.New("database is locked")
+}
+
+// doRequest sends a JSON request as a participant of the given retrospective
+// and decodes the response into out, when set.
+func doRequest(t *testing.T, router http.Handler, method, path, body string, retroID uuid.UUID, out interface{}) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if retroID != uuid.Nil {
+		req.AddCookie(&http.Cookie{Name: "retrospective_id", Value: retroID.String()})
+	}
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	if out != nil && res.Code >= 200 && res.Code < 300 {
+		err := json.Unmarshal(res.Body.Bytes(), out)
+		assert.Nilf(t, err, "error decoding response")
+	}
+	return res
+}
+
+// latestDialer negotiates the latest version of the message schema.
+var latestDialer = websocket.Dialer{Subprotocols: []string{"simple-retro.v2"}}
+
+// showAnswers moves the retrospective out of brainstorm, so every session sees
+// all the answers.
+func showAnswers(t *testing.T, router http.Handler, retroID uuid.UUID) {
+	res := doRequest(t, router, http.MethodPatch, "/api/retrospective/"+retroID.String()+"/phase", `{"phase": "voting"}`, retroID, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestMetrics(t *testing.T) {
+	router := newTestController(t).router()
+
+	scrape := func() string {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		assert.Equal(t, http.StatusOK, res.Code)
+		return res.Body.String()
+	}
+	stored := func(body, kind string) int {
+		match := regexp.MustCompile(`simple_retro_stored\{type="` + kind + `"\} (\d+)`).FindStringSubmatch(body)
+		if !assert.NotNil(t, match, "missing stored gauge for %s", kind) {
+			return 0
+		}
+		n, _ := strconv.Atoi(match[1])
+		return n
+	}
+
+	// The test database is shared, other tests may have stored rows already
+	before := scrape()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/limits", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	var retro types.Retrospective
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Metrics"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	var questions []types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/questions/bulk", `{"questions": [{"text": "First"}, {"text": "Second"}]}`, retro.ID, &questions)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	body := `{"question_id": "` + questions[0].ID.String() + `", "text": "Answer"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body = scrape()
+	assert.Contains(t, body, `simple_retro_http_requests_total{method="GET",route="/api/limits",status="200"} 1`)
+	assert.Contains(t, body, "simple_retro_http_request_duration_seconds_bucket")
+	assert.Contains(t, body, "simple_retro_websocket_connections")
+	assert.Contains(t, body, `simple_retro_created_total{type="answer"}`)
+
+	assert.Equal(t, stored(before, "retrospective")+1, stored(body, "retrospective"))
+	assert.Equal(t, stored(before, "question")+2, stored(body, "question"))
+	assert.Equal(t, stored(before, "answer")+1, stored(body, "answer"))
+}
+
+func TestGetFeatures(t *testing.T) {
+	ct := newTestController(t)
+	router := ct.router()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/features", nil)
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"phases": true}`, res.Body.String())
+
+	config.Get().Features.Phases = false
+	router = ct.router()
+
+	req = httptest.NewRequest(http.MethodGet, "/api/features", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"phases": false}`, res.Body.String())
+
+	req = httptest.NewRequest(http.MethodPatch, "/api/retrospective/"+uuid.NewString()+"/phase", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestDuplicateQuestion(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Duplicate"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Everything"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var duplicate types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question/"+question.ID.String()+"/duplicate", "", retro.ID, &duplicate)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "/api/retrospective/"+retro.ID.String(), res.Header().Get("Location"))
+	assert.NotEqual(t, question.ID, duplicate.ID)
+	assert.Equal(t, question.Text, duplicate.Text)
+	assert.Empty(t, duplicate.Answers)
+
+	var stored types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, stored.Questions, 2)
+	last := stored.Questions[len(stored.Questions)-1]
+	assert.Equal(t, duplicate.ID, last.ID)
+	assert.Empty(t, last.Answers)
+
+	// A question from another retrospective can't be duplicated
+	res = doRequest(t, router, http.MethodPost, "/api/question/"+question.ID.String()+"/duplicate", "", uuid.New(), nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestDeleteQuestionAnswers(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro, other types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Columns"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Other"}`, uuid.Nil, &other)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	questions := make([]types.Question, 3)
+	for i := range questions {
+		res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Column"}`, retro.ID, &questions[i])
+		assert.Equal(t, http.StatusCreated, res.Code)
+
+		body := `{"question_id": "` + questions[i].ID.String() + `", "text": "Answer ` + strconv.Itoa(i) + `"}`
+		res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+	var elsewhere types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Elsewhere"}`, other.ID, &elsewhere)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	path := "/api/question/" + questions[0].ID.String()
+	res = doRequest(t, router, http.MethodDelete, path+"?move_answers_to=column", "", retro.ID, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	res = doRequest(t, router, http.MethodDelete, path+"?move_answers_to="+elsewhere.ID.String(), "", retro.ID, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code, "answers can't move to another retrospective")
+	assert.JSONEq(t, `{"error": "answers can only be moved to another question of the retrospective"}`, res.Body.String())
+
+	// Reparent: the answers follow the ones of the target question
+	var deleted types.Question
+	res = doRequest(t, router, http.MethodDelete, path+"?move_answers_to="+questions[1].ID.String(), "", retro.ID, &deleted)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, deleted.Answers, 1)
+
+	var answers []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+questions[1].ID.String()+"/answers", "", retro.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	if assert.Len(t, answers, 2) {
+		assert.Equal(t, "Answer 1", answers[0].Text)
+		assert.Equal(t, "Answer 0", answers[1].Text)
+		assert.Equal(t, 2, answers[1].Position)
+	}
+
+	// Cascade: without a target the answers are deleted with the question
+	res = doRequest(t, router, http.MethodDelete, "/api/question/"+questions[2].ID.String(), "", retro.ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	var stats types.RetrospectiveStats
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String()+"/stats", "", retro.ID, &stats)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 1, stats.QuestionCount)
+	assert.Equal(t, 2, stats.AnswerCount)
+}
+
+func TestValidationErrors(t *testing.T) {
+	router := newTestController(t).router()
+
+	body := `{"name": "` + strings.Repeat("n", types.NAME_LIMIT+1) + `", "description": "` + strings.Repeat("d", types.DESC_LIMIT+1) + `"}`
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", body, uuid.Nil, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{
+		"error": "retrospective name too big. Limit is 100; retrospective description too big. Limit is 300",
+		"errors": [
+			{"field": "name", "code": "too_long", "limit": 100, "message": "retrospective name too big. Limit is 100"},
+			{"field": "description", "code": "too_long", "limit": 300, "message": "retrospective description too big. Limit is 300"}
+		]
+	}`, res.Body.String())
+
+	// Malformed bodies aren't validation errors
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": 42}`, uuid.Nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+}
+
+func TestCreateAnswerUnknownQuestion(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Unknown question"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"question_id": "` + uuid.NewString() + `", "text": "Orphan"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.JSONEq(t, `{"error": "question not found"}`, res.Body.String())
+}
+
+func TestAnswerScopedToRetrospective(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retroA, retroB types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retro A"}`, uuid.Nil, &retroA)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retro B"}`, uuid.Nil, &retroB)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retroB.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retroB.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var answer types.Answer
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Everything"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retroB.ID, &answer)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body = `{"question_id": "` + question.ID.String() + `", "text": "Nothing"}`
+	res = doRequest(t, router, http.MethodPatch, "/api/answer/"+answer.ID.String(), body, retroA.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = doRequest(t, router, http.MethodDelete, "/api/answer/"+answer.ID.String(), "", retroA.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	var answers []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+question.ID.String()+"/answers", "", retroB.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, answers, 1)
+	assert.Equal(t, "Everything", answers[0].Text)
+
+	res = doRequest(t, router, http.MethodDelete, "/api/answer/"+answer.ID.String(), "", retroB.ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestCreateAnswerOtherRetrospective(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retroA, retroB types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retro A"}`, uuid.Nil, &retroA)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retro B"}`, uuid.Nil, &retroB)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retroB.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Intruder"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retroA.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	var answers []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+question.ID.String()+"/answers", "", retroB.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, answers)
+}
+
+func TestHealth(t *testing.T) {
+	router := newTestController(t).router()
+
+	var health health
+	res := doRequest(t, router, http.MethodGet, "/api/health", "", uuid.Nil, &health)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, DATABASE_OK, health.Database)
+	assert.Equal(t, config.Get().Name, health.Name)
+
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	logger := zap.NewNop()
+	router = New(service.New(unreachableRepository{}, wsrepo, logger), logger).router()
+
+	res = doRequest(t, router, http.MethodGet, "/api/health", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+
+	err = json.Unmarshal(res.Body.Bytes(), &health)
+	assert.Nilf(t, err, "error decoding response")
+	assert.Equal(t, DATABASE_DOWN, health.Database)
+	assert.Equal(t, 0, health.WebSocketConnections)
+}
+
+func TestProbes(t *testing.T) {
+	router := newTestController(t).router()
+
+	res := doRequest(t, router, http.MethodGet, "/healthz", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, res.Body.String())
+
+	res = doRequest(t, router, http.MethodGet, "/readyz", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.JSONEq(t, `{"status": "ok"}`, res.Body.String())
+
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	logger := zap.NewNop()
+	router = New(service.New(unreachableRepository{}, wsrepo, logger), logger).router()
+
+	res = doRequest(t, router, http.MethodGet, "/healthz", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = doRequest(t, router, http.MethodGet, "/readyz", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, res.Code)
+	assert.JSONEq(t, `{"status": "unavailable", "reason": "database not ready"}`, res.Body.String())
+}
+
+func TestInternalErrorDetail(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	logger := zap.NewNop()
+	router := New(service.New(unreachableRepository{}, wsrepo, logger), logger).router()
+	path := "/api/retrospective/" + uuid.NewString() + "?answers=false"
+
+	conf.Development = false
+	res := doRequest(t, router, http.MethodGet, path, "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+
+	var body map[string]string
+	err = json.Unmarshal(res.Body.Bytes(), &body)
+	assert.Nilf(t, err, "error decoding response")
+	assert.Equal(t, "internal server error", body["error"])
+	assert.Equal(t, res.Header().Get("X-Request-ID"), body["request_id"])
+	assert.NotContains(t, body, "detail")
+
+	conf.Development = true
+	res = doRequest(t, router, http.MethodGet, path, "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusInternalServerError, res.Code)
+
+	body = nil
+	err = json.Unmarshal(res.Body.Bytes(), &body)
+	assert.Nilf(t, err, "error decoding response")
+	assert.Equal(t, "internal server error", body["error"])
+	assert.Equal(t, "database is locked", body["detail"])
+}
+
+func TestGetAnswerContext(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro, other types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Context"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Other"}`, uuid.Nil, &other)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var question, otherQuestion types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went wrong?"}`, retro.ID, &otherQuestion)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	answers := make([]types.Answer, 3)
+	for i, text := range []string{"First", "Second", "Third"} {
+		body := `{"question_id": "` + question.ID.String() + `", "text": "` + text + `"}`
+		res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, &answers[i])
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+	body := `{"question_id": "` + otherQuestion.ID.String() + `", "text": "Unrelated"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var answerContext types.AnswerContext
+	res = doRequest(t, router, http.MethodGet, "/api/answer/"+answers[1].ID.String()+"/context", "", retro.ID, &answerContext)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, answers[1].ID, answerContext.Answer.ID)
+	assert.Equal(t, "Second", answerContext.Answer.Text)
+	assert.Equal(t, question.ID, answerContext.Question.ID)
+	assert.Equal(t, question.Text, answerContext.Question.Text)
+	assert.Equal(t, 3, answerContext.Question.AnswerCount)
+	assert.Len(t, answerContext.Siblings, 2)
+	assert.Equal(t, answers[0].ID, answerContext.Siblings[0].ID)
+	assert.Equal(t, answers[2].ID, answerContext.Siblings[1].ID)
+
+	res = doRequest(t, router, http.MethodGet, "/api/answer/"+answers[1].ID.String()+"/context", "", other.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = doRequest(t, router, http.MethodGet, "/api/answer/"+uuid.NewString()+"/context", "", retro.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestCreateQuestionsBulk(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Template"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"questions": [{"text": "What went well"}, {"text": "  "}, {"text": "Action items"}]}`
+	res = doRequest(t, router, http.MethodPost, "/api/questions/bulk", body, retro.ID, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{"error": "question 2: question text cannot be empty", "errors": [
+		{"field": "questions[1].text", "code": "required", "message": "question 2: question text cannot be empty"}
+	]}`, res.Body.String())
+
+	var stored types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, stored.Questions, "a rejected batch must not create any question")
+
+	var questions []types.Question
+	body = `{"questions": [{"text": "What went well"}, {"text": "What didn't"}, {"text": "Action items"}]}`
+	res = doRequest(t, router, http.MethodPost, "/api/questions/bulk", body, retro.ID, &questions)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Len(t, questions, 3)
+	for _, question := range questions {
+		assert.NotEqual(t, uuid.Nil, question.ID)
+	}
+	assert.Equal(t, "What didn't", questions[1].Text)
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, stored.Questions, 3)
+}
+
+func TestCreateRetrospectiveFromTemplate(t *testing.T) {
+	router := newTestController(t).router()
+
+	var templates []types.Template
+	res := doRequest(t, router, http.MethodGet, "/api/templates", "", uuid.Nil, &templates)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, types.GetTemplates(), templates)
+
+	for _, template := range templates {
+		t.Run(template.Name, func(t *testing.T) {
+			var retro types.Retrospective
+			body := `{"name": "From ` + template.Title + `", "template": "` + template.Name + `"}`
+			res := doRequest(t, router, http.MethodPost, "/api/retrospective/from-template", body, uuid.Nil, &retro)
+			assert.Equal(t, http.StatusCreated, res.Code)
+			assert.Equal(t, "From "+template.Title, retro.Name)
+			assert.Len(t, retro.Questions, len(template.Questions))
+
+			var stored types.Retrospective
+			res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+			assert.Equal(t, http.StatusOK, res.Code)
+			texts := []string{}
+			for _, question := range stored.Questions {
+				texts = append(texts, question.Text)
+			}
+			assert.ElementsMatch(t, template.Questions, texts)
+		})
+	}
+
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective/from-template", `{"name": "Unknown", "template": "kanban"}`, uuid.Nil, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{"error": "unknown template \"kanban\"", "errors": [
+		{"field": "template", "code": "invalid", "message": "unknown template \"kanban\""}
+	]}`, res.Body.String())
+}
+
+func TestUpdateUnknownAnswer(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Unknown answer"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Nothing"}`
+	res = doRequest(t, router, http.MethodPatch, "/api/answer/"+uuid.NewString(), body, retro.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+	assert.JSONEq(t, `{"error": "answer not found"}`, res.Body.String())
+}
+
+func TestResolveQuestion(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retroA, retroB types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retro A"}`, uuid.Nil, &retroA)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retro B"}`, uuid.Nil, &retroB)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var questionA, questionB types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retroA.ID, &questionA)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went wrong?"}`, retroB.ID, &questionB)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var answer types.Answer
+	body := `{"question_id": "` + questionA.ID.String() + `", "text": "Deploys"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retroA.ID, &answer)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, questionA.ID, answer.QuestionID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		error  string
+	}{
+		{"create in another retrospective", http.MethodPost, "/api/answer",
+			`{"question_id": "` + questionB.ID.String() + `", "text": "Intruder"}`, http.StatusNotFound, "question not found"},
+		{"update into another retrospective", http.MethodPatch, "/api/answer/" + answer.ID.String(),
+			`{"question_id": "` + questionB.ID.String() + `", "text": "Moved"}`, http.StatusNotFound, "question not found"},
+		{"missing question id", http.MethodPost, "/api/answer",
+			`{"text": "Orphan"}`, http.StatusBadRequest, "question id cannot be empty"},
+		{"invalid body", http.MethodPost, "/api/answer",
+			`{"question_id": 42}`, http.StatusBadRequest, "invalid body content"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := doRequest(t, router, tt.method, tt.path, tt.body, retroA.ID, nil)
+			assert.Equal(t, tt.status, res.Code)
+			assert.JSONEq(t, `{"error": "`+tt.error+`"}`, res.Body.String())
+		})
+	}
+}
+
+func TestSubscribePrivateRetrospective(t *testing.T) {
+	router := newTestController(t).router()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var private, public types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Private", "private": true}`, uuid.Nil, &private)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.True(t, private.Private)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Public"}`, uuid.Nil, &public)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	dial := func(retroID, cookieID uuid.UUID) (*http.Response, error) {
+		header := http.Header{}
+		if cookieID != uuid.Nil {
+			header.Set("Cookie", "retrospective_id="+cookieID.String())
+		}
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/hello/" + retroID.String()
+		conn, res, err := websocket.DefaultDialer.Dial(url, header)
+		if err == nil {
+			conn.Close()
+		}
+		return res, err
+	}
+
+	wsRes, err := dial(private.ID, uuid.Nil)
+	assert.NotNil(t, err, "subscribing without the cookie should be refused")
+	assert.Equal(t, http.StatusUnauthorized, wsRes.StatusCode)
+
+	wsRes, err = dial(private.ID, public.ID)
+	assert.NotNil(t, err, "subscribing with another retrospective cookie should be refused")
+	assert.Equal(t, http.StatusUnauthorized, wsRes.StatusCode)
+
+	_, err = dial(private.ID, private.ID)
+	assert.Nil(t, err, "subscribing with the matching cookie should work")
+
+	_, err = dial(public.ID, uuid.Nil)
+	assert.Nil(t, err, "public retrospectives don't need the cookie")
+
+	// retroCookie returns the retrospective cookie set by the response
+	retroCookie := func(res *httptest.ResponseRecorder) string {
+		for _, cookie := range res.Result().Cookies() {
+			if cookie.Name == "retrospective_id" {
+				return cookie.Value
+			}
+		}
+		return ""
+	}
+
+	// Creating a retrospective joins it
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Private", "private": true}`, uuid.Nil, &private)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, private.ID.String(), retroCookie(res))
+
+	// A second participant joins by opening the retrospective, then
+	// subscribes with the cookie it got
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+private.ID.String(), "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	joined, err := uuid.Parse(retroCookie(res))
+	assert.Nilf(t, err, "reading a retrospective should join it")
+	_, err = dial(private.ID, joined)
+	assert.Nil(t, err, "a participant which joined should be able to subscribe")
+
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Joined?"}`, joined, nil)
+	assert.Equal(t, http.StatusCreated, res.Code, "a participant which joined should be able to write")
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	router := newTestController(t).router()
+
+	res := doRequest(t, router, http.MethodGet, "/api/hello/"+uuid.NewString(), "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "error subscribing: retrospective doesn't exist"}`, res.Body.String())
+
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Who am I?"}`, uuid.Nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+	assert.JSONEq(t, `{"error": "not in any retrospective"}`, res.Body.String())
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/not-an-id", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "invalid id"}`, res.Body.String())
+}
+
+func TestContentLimits(t *testing.T) {
+	router := newTestController(t).router()
+	config.Get().Limits.MaxQuestions = 2
+	config.Get().Limits.MaxAnswersPerQuestion = 2
+
+	var limits types.ApiLimits
+	res := doRequest(t, router, http.MethodGet, "/api/limits", "", uuid.Nil, &limits)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 2, limits.Retrospective.Questions)
+	assert.Equal(t, 2, limits.Question.Answers)
+
+	var retro types.Retrospective
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Limits"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"questions": [{"text": "What didn't"}, {"text": "Action items"}]}`
+	res = doRequest(t, router, http.MethodPost, "/api/questions/bulk", body, retro.ID, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.JSONEq(t, `{"error": "question limit reached"}`, res.Body.String())
+
+	var other types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What didn't"}`, retro.ID, &other)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Action items"}`, retro.ID, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.JSONEq(t, `{"error": "question limit reached"}`, res.Body.String())
+
+	res = doRequest(t, router, http.MethodPost, "/api/question/"+question.ID.String()+"/duplicate", "", retro.ID, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+
+	body = `{"question_id": "` + question.ID.String() + `", "text": "Everything"}`
+	for i := 0; i < 2; i++ {
+		res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.JSONEq(t, `{"error": "answer limit reached"}`, res.Body.String())
+
+	// Moving answers can't take the target over the limit either
+	body = `{"question_id": "` + other.ID.String() + `", "text": "Nothing"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = doRequest(t, router, http.MethodDelete, "/api/question/"+other.ID.String()+"?move_answers_to="+question.ID.String(), "", retro.ID, nil)
+	assert.Equal(t, http.StatusForbidden, res.Code)
+	assert.JSONEq(t, `{"error": "answer limit reached"}`, res.Body.String())
+
+	var answers []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+other.ID.String()+"/answers", "", retro.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, answers, 1, "the question should be kept with its answers")
+}
+
+func TestGetRetrospectiveAnswersQuery(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Paged"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	questions := make([]types.Question, 2)
+	for i := range questions {
+		res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Question"}`, retro.ID, &questions[i])
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+
+	texts := []string{"first", "second", "third"}
+	for _, text := range texts {
+		body := `{"question_id": "` + questions[0].ID.String() + `", "text": "` + text + `"}`
+		res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+	body := `{"question_id": "` + questions[1].ID.String() + `", "text": "other"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	get := func(query string) types.Retrospective {
+		var stored types.Retrospective
+		res := doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String()+query, "", retro.ID, &stored)
+		assert.Equal(t, http.StatusOK, res.Code)
+		return stored
+	}
+	answerTexts := func(question types.Question) []string {
+		texts := []string{}
+		for _, answer := range question.Answers {
+			texts = append(texts, answer.Text)
+		}
+		return texts
+	}
+
+	stored := get("")
+	if assert.Len(t, stored.Questions, 2) {
+		assert.Len(t, stored.Questions[0].Answers, 3)
+		assert.Len(t, stored.Questions[1].Answers, 1)
+	}
+
+	stored = get("?answers_limit=2&sort=position")
+	if assert.Len(t, stored.Questions, 2) {
+		assert.Equal(t, []string{"first", "second"}, answerTexts(stored.Questions[0]))
+		assert.Equal(t, []string{"other"}, answerTexts(stored.Questions[1]))
+	}
+
+	stored = get("?answers_limit=2&answers_offset=2&sort=created_at")
+	if assert.Len(t, stored.Questions, 2) {
+		assert.Equal(t, []string{"third"}, answerTexts(stored.Questions[0]))
+		assert.Empty(t, stored.Questions[1].Answers)
+	}
+
+	stored = get("?question_id=" + questions[1].ID.String())
+	if assert.Len(t, stored.Questions, 1) {
+		assert.Equal(t, questions[1].ID, stored.Questions[0].ID)
+		assert.Equal(t, []string{"other"}, answerTexts(stored.Questions[0]))
+	}
+
+	invalid := []struct {
+		query string
+		error string
+	}{
+		{"?sort=votes", `invalid answers sort "votes". Use position or created_at`},
+		{"?answers_limit=-1", "answers limit cannot be negative"},
+		{"?answers_offset=many", "invalid answers_offset parameter"},
+		{"?question_id=nope", "invalid question_id parameter"},
+	}
+	for _, tc := range invalid {
+		res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String()+tc.query, "", retro.ID, nil)
+		assert.Equal(t, http.StatusBadRequest, res.Code, tc.query)
+		var body types.ErrorResponse
+		err := json.Unmarshal(res.Body.Bytes(), &body)
+		assert.Nilf(t, err, "error decoding response")
+		assert.Equal(t, tc.error, body.Error, tc.query)
+	}
+}
+
+func TestUpdateAnswerVersion(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Versions"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var answer types.Answer
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Nothing"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, &answer)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, 1, answer.Version)
+
+	update := func(text string, version int, out *types.Answer) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"question_id": "%s", "text": "%s", "version": %d}`, question.ID, text, version)
+		return doRequest(t, router, http.MethodPatch, "/api/answer/"+answer.ID.String(), body, retro.ID, out)
+	}
+
+	var updated types.Answer
+	res = update("Everything", 1, &updated)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 2, updated.Version)
+
+	// A second editor still on version 1 doesn't overwrite the first one
+	res = update("Something else", 1, nil)
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.JSONEq(t, `{"error": "answer was modified"}`, res.Body.String())
+
+	var stored []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+question.ID.String()+"/answers", "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	if assert.Len(t, stored, 1) {
+		assert.Equal(t, "Everything", stored[0].Text)
+		assert.Equal(t, 2, stored[0].Version)
+	}
+
+	// Without a version the update isn't checked
+	res = update("Something else", 0, &updated)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 3, updated.Version)
+}
+
+func TestAnswerColor(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Colors"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Nothing", "color": "magenta"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{"error": "invalid answer color \"magenta\"", "errors": [
+		{"field": "color", "code": "invalid", "message": "invalid answer color \"magenta\""}
+	]}`, res.Body.String())
+
+	var neutral types.Answer
+	body = `{"question_id": "` + question.ID.String() + `", "text": "Neutral"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, &neutral)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Empty(t, neutral.Color)
+
+	var answer types.Answer
+	body = `{"question_id": "` + question.ID.String() + `", "text": "Nothing", "color": "blue"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, &answer)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, types.COLOR_BLUE, answer.Color)
+
+	colors := func() []string {
+		var stored types.Retrospective
+		res := doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+		assert.Equal(t, http.StatusOK, res.Code)
+		colors := []string{}
+		for _, answer := range stored.Questions[0].Answers {
+			colors = append(colors, answer.Color)
+		}
+		return colors
+	}
+	assert.Equal(t, []string{"", types.COLOR_BLUE}, colors())
+
+	// Updating without a color keeps the current one
+	var updated types.Answer
+	body = `{"question_id": "` + question.ID.String() + `", "text": "Everything"}`
+	res = doRequest(t, router, http.MethodPatch, "/api/answer/"+answer.ID.String(), body, retro.ID, &updated)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, types.COLOR_BLUE, updated.Color)
+
+	body = `{"question_id": "` + question.ID.String() + `", "text": "Everything", "color": "green"}`
+	res = doRequest(t, router, http.MethodPatch, "/api/answer/"+answer.ID.String(), body, retro.ID, &updated)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, types.COLOR_GREEN, updated.Color)
+	assert.Equal(t, []string{"", types.COLOR_GREEN}, colors())
+}
+
+func TestMergeAnswers(t *testing.T) {
+	router := newTestController(t).router()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Merge"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	questions := make([]types.Question, 2)
+	for i := range questions {
+		res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Question"}`, retro.ID, &questions[i])
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+
+	createAnswer := func(question types.Question, text string) types.Answer {
+		var answer types.Answer
+		body := `{"question_id": "` + question.ID.String() + `", "text": "` + text + `"}`
+		res := doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, &answer)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		return answer
+	}
+	first := createAnswer(questions[0], "first")
+	second := createAnswer(questions[0], "second")
+	third := createAnswer(questions[0], "third")
+	other := createAnswer(questions[1], "other")
+
+	merge := func(source, target uuid.UUID, out *types.Answer) *httptest.ResponseRecorder {
+		body := fmt.Sprintf(`{"source_id": "%s", "target_id": "%s"}`, source, target)
+		return doRequest(t, router, http.MethodPost, "/api/answer/merge", body, retro.ID, out)
+	}
+
+	res = merge(first.ID, other.ID, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+	assert.JSONEq(t, `{"error": "answers belong to different questions"}`, res.Body.String())
+
+	res = merge(first.ID, first.ID, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	res = merge(uuid.New(), first.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	header := http.Header{"Cookie": {"retrospective_id=" + retro.ID.String()}}
+	conn, _, err := latestDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/hello/"+retro.ID.String(), header)
+	assert.Nilf(t, err, "error connecting to websocket")
+	defer conn.Close()
+
+	// The pong comes from the read loop, so the client is registered by then
+	var message types.WebSocketMessage
+	err = conn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+
+	var merged types.Answer
+	res = merge(first.ID, third.ID, &merged)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, third.ID, merged.ID)
+	assert.Equal(t, "third\nfirst", merged.Text)
+	assert.Equal(t, 2, merged.Position)
+	assert.Equal(t, third.Version+1, merged.Version)
+
+	var mergeMessage struct {
+		Action string            `json:"action"`
+		Type   string            `json:"type"`
+		Value  types.AnswerMerge `json:"value"`
+	}
+	err = conn.ReadJSON(&mergeMessage)
+	assert.Nilf(t, err, "error reading merge message")
+	assert.Equal(t, "merge", mergeMessage.Action)
+	assert.Equal(t, first.ID, mergeMessage.Value.SourceID)
+	assert.Equal(t, merged.Text, mergeMessage.Value.Answer.Text)
+
+	var deleteMessage struct {
+		Action string       `json:"action"`
+		Type   string       `json:"type"`
+		Value  types.Answer `json:"value"`
+	}
+	err = conn.ReadJSON(&deleteMessage)
+	assert.Nilf(t, err, "error reading delete message")
+	assert.Equal(t, "delete", deleteMessage.Action)
+	assert.Equal(t, "answer", deleteMessage.Type)
+	assert.Equal(t, first.ID, deleteMessage.Value.ID)
+
+	var stored []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+questions[0].ID.String()+"/answers", "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	if assert.Len(t, stored, 2) {
+		assert.Equal(t, second.ID, stored[0].ID)
+		assert.Equal(t, 1, stored[0].Position)
+		assert.Equal(t, third.ID, stored[1].ID)
+		assert.Equal(t, 2, stored[1].Position)
+	}
+
+	// Answers of another retrospective can't be merged
+	body := fmt.Sprintf(`{"source_id": "%s", "target_id": "%s"}`, second.ID, third.ID)
+	res = doRequest(t, router, http.MethodPost, "/api/answer/merge", body, uuid.New(), nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Retries"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	send := func(path, body, key, session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		req.AddCookie(&http.Cookie{Name: "retrospective_id", Value: retro.ID.String()})
+		req.AddCookie(&http.Cookie{Name: "simple-retro-session", Value: session})
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	session := uuid.NewString()
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Everything"}`
+	first := send("/api/answer", body, "retry-1", session)
+	assert.Equal(t, http.StatusCreated, first.Code)
+
+	retried := send("/api/answer", body, "retry-1", session)
+	assert.Equal(t, http.StatusCreated, retried.Code)
+	assert.Equal(t, first.Body.String(), retried.Body.String())
+	assert.Equal(t, first.Header().Get("Location"), retried.Header().Get("Location"))
+	assert.Equal(t, "true", retried.Header().Get("Idempotent-Replayed"))
+
+	var answers []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+question.ID.String()+"/answers", "", retro.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, answers, 1)
+
+	// Keys are scoped to the session, another client creates its own answer
+	other := send("/api/answer", body, "retry-1", uuid.NewString())
+	assert.Equal(t, http.StatusCreated, other.Code)
+	assert.NotEqual(t, first.Body.String(), other.Body.String())
+
+	// A failed request isn't stored, so it can be retried once fixed
+	res = send("/api/answer", `{"question_id": "`+question.ID.String()+`", "text": ""}`, "retry-2", session)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	res = send("/api/answer", body, "retry-2", session)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = send("/api/question", `{"text": "Reused key"}`, "retry-1", session)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.JSONEq(t, `{"error": "idempotency key already used for another request"}`, res.Body.String())
+
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+question.ID.String()+"/answers", "", retro.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, answers, 3)
+}
+
+func TestIdempotencyKeyConcurrent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	// With the shared memory cache concurrent writers fail on table locks
+	// instead of waiting for the busy timeout
+	conf.Database.Address = filepath.Join(t.TempDir(), "idempotency.db")
+	conf.Database.Cache = "private"
+	conf.Database.JournalMode = "WAL"
+
+	repo, err := repository.NewSQLite()
+	assert.Nilf(t, err, "error connecting to database")
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	ct := New(service.New(repo, wsrepo, zap.NewNop()), zap.NewNop())
+	router := ct.router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Concurrent retries"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	session := uuid.NewString()
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/question", strings.NewReader(`{"text": "Retried"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		req.AddCookie(&http.Cookie{Name: "retrospective_id", Value: retro.ID.String()})
+		req.AddCookie(&http.Cookie{Name: "simple-retro-session", Value: session})
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	// A retry sent while the first request is pending isn't run again
+	ctx := context.WithValue(context.Background(), "session_id", session)
+	reserved, err := ct.service.ReserveIdempotencyKey(ctx, "pending", "POST /api/question")
+	assert.Nilf(t, err, "error reserving idempotency key")
+	assert.True(t, reserved)
+	res = send("pending")
+	assert.Equal(t, http.StatusConflict, res.Code)
+	assert.JSONEq(t, `{"error": "a request with this idempotency key is in progress"}`, res.Body.String())
+
+	responses := make([]*httptest.ResponseRecorder, 10)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = send("concurrent")
+		}(i)
+	}
+	wg.Wait()
+
+	created := ""
+	for _, res := range responses {
+		switch res.Code {
+		case http.StatusCreated:
+			if created == "" {
+				created = res.Body.String()
+			}
+			assert.Equal(t, created, res.Body.String(), "retries should get the first response")
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status %d: %s", res.Code, res.Body.String())
+		}
+	}
+
+	assert.NotEmpty(t, created, "one of the requests should create the question")
+
+	var got types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &got)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, got.Questions, 1, "the question should be created once")
+}
+
+func TestClearAnswers(t *testing.T) {
+	router := newTestController(t).router()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var retro, other types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Clear"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Other"}`, uuid.Nil, &other)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, other.ID)
+
+	seed := func(retroID uuid.UUID, answers int) types.Question {
+		var question types.Question
+		res := doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Question"}`, retroID, &question)
+		assert.Equal(t, http.StatusCreated, res.Code)
+		for i := 0; i < answers; i++ {
+			body := `{"question_id": "` + question.ID.String() + `", "text": "answer"}`
+			res = doRequest(t, router, http.MethodPost, "/api/answer", body, retroID, nil)
+			assert.Equal(t, http.StatusCreated, res.Code)
+		}
+		return question
+	}
+	seed(retro.ID, 2)
+	seed(retro.ID, 1)
+	kept := seed(other.ID, 1)
+
+	res = doRequest(t, router, http.MethodDelete, "/api/retrospective/"+other.ID.String()+"/answers", "", retro.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "only the retrospective of the session can be cleared")
+
+	header := http.Header{"Cookie": {"retrospective_id=" + retro.ID.String()}}
+	subscribe := func(dialer *websocket.Dialer) *websocket.Conn {
+		conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/hello/"+retro.ID.String(), header)
+		assert.Nilf(t, err, "error connecting to websocket")
+		t.Cleanup(func() { conn.Close() })
+
+		// The pong comes from the read loop, so the client is registered by then
+		var message types.WebSocketMessage
+		err = conn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+		assert.Nilf(t, err, "error sending ping")
+		err = conn.ReadJSON(&message)
+		assert.Nilf(t, err, "error reading pong")
+		return conn
+	}
+	conn := subscribe(&latestDialer)
+	legacy := subscribe(websocket.DefaultDialer)
+
+	var cleared types.AnswersCleared
+	res = doRequest(t, router, http.MethodDelete, "/api/retrospective/"+retro.ID.String()+"/answers", "", retro.ID, &cleared)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 3, cleared.Deleted)
+
+	var message types.WebSocketMessage
+	err := conn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading clear message")
+	assert.Equal(t, "clear", message.Action)
+	assert.Equal(t, "answers", message.Type)
+
+	// v1 clients are told about each deletion instead
+	for i := 0; i < cleared.Deleted; i++ {
+		err = legacy.ReadJSON(&message)
+		assert.Nilf(t, err, "error reading delete message")
+		assert.Equal(t, "delete", message.Action)
+		assert.Equal(t, "answer", message.Type)
+	}
+
+	var got types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &got)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, got.Questions, 2, "questions should be kept")
+	for _, question := range got.Questions {
+		assert.Empty(t, question.Answers)
+	}
+
+	var answers []types.Answer
+	res = doRequest(t, router, http.MethodGet, "/api/question/"+kept.ID.String()+"/answers", "", other.ID, &answers)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, answers, 1, "answers of other retrospectives should be kept")
+}
+
+func TestGetRetrospectiveStats(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Stats"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Question"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	body := `{"question_id": "` + question.ID.String() + `", "text": "answer"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	var stats types.RetrospectiveStats
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String()+"/stats", "", retro.ID, &stats)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 1, stats.QuestionCount)
+	assert.Equal(t, 1, stats.AnswerCount)
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String()+"/stats", "", uuid.New(), nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "only the retrospective of the session can be read")
+}
+
+func TestSuppressEcho(t *testing.T) {
+	router := newTestController(t).router()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Echo"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Question"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	subscribe := func(session, query string) *websocket.Conn {
+		header := http.Header{"Cookie": {"retrospective_id=" + retro.ID.String() + "; simple-retro-session=" + session}}
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/hello/" + retro.ID.String() + query
+		conn, _, err := websocket.DefaultDialer.Dial(url, header)
+		assert.Nilf(t, err, "error connecting to websocket")
+		t.Cleanup(func() { conn.Close() })
+
+		// The pong comes from the read loop, so the client is registered by then
+		var message types.WebSocketMessage
+		err = conn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+		assert.Nilf(t, err, "error sending ping")
+		err = conn.ReadJSON(&message)
+		assert.Nilf(t, err, "error reading pong")
+		return conn
+	}
+	session := uuid.NewString()
+	origin := subscribe(session, "?suppress_echo=true")
+	echoed := subscribe(session, "")
+	other := subscribe(uuid.NewString(), "?suppress_echo=true")
+
+	body := `{"question_id": "` + question.ID.String() + `", "text": "mine"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/answer", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: "retrospective_id", Value: retro.ID.String()})
+	req.AddCookie(&http.Cookie{Name: "simple-retro-session", Value: session})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	for _, conn := range []*websocket.Conn{echoed, other} {
+		var message types.WebSocketMessage
+		err := conn.ReadJSON(&message)
+		assert.Nilf(t, err, "error reading create message")
+		assert.Equal(t, "create", message.Action)
+		assert.Equal(t, "answer", message.Type)
+	}
+
+	// Messages are sent in order, the echo would come before the pong
+	var message types.WebSocketMessage
+	err := origin.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = origin.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", message.Type, "the originator shouldn't get its own change back")
+}
+
+func TestBrainstormAnswers(t *testing.T) {
+	router := newTestController(t).router()
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Brainstorm"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, types.PHASE_BRAINSTORM, retro.Phase)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "Question"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	cookies := func(session string) string {
+		return "retrospective_id=" + retro.ID.String() + "; simple-retro-session=" + session
+	}
+	subscribe := func(session string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/hello/" + retro.ID.String()
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Cookie": {cookies(session)}})
+		assert.Nilf(t, err, "error connecting to websocket")
+		t.Cleanup(func() { conn.Close() })
+
+		var message types.WebSocketMessage
+		err = conn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+		assert.Nilf(t, err, "error sending ping")
+		err = conn.ReadJSON(&message)
+		assert.Nilf(t, err, "error reading pong")
+		return conn
+	}
+	send := func(session, method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Cookie", cookies(session))
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+	alice, bob := uuid.NewString(), uuid.NewString()
+	aliceConn, bobConn := subscribe(alice), subscribe(bob)
+
+	rec := send(alice, http.MethodPost, "/api/answer", `{"question_id": "`+question.ID.String()+`", "text": "mine"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var answer types.Answer
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &answer))
+
+	var message types.WebSocketMessage
+	err := aliceConn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading create message")
+	assert.Equal(t, "create", message.Action)
+
+	// Messages are sent in order, the answer would come before the pong
+	err = bobConn.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = bobConn.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", message.Type, "other sessions shouldn't get the answer")
+
+	rec = send(bob, http.MethodPost, "/api/answer", `{"question_id": "`+question.ID.String()+`", "text": "bob's"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var bobAnswer types.Answer
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &bobAnswer))
+
+	for _, session := range []string{alice, bob} {
+		var stored types.Retrospective
+		rec = send(session, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stored))
+		if assert.Len(t, stored.Questions[0].Answers, 1) {
+			assert.True(t, stored.Questions[0].Answers[0].Mine)
+		}
+
+		var answers []types.Answer
+		rec = send(session, http.MethodGet, "/api/question/"+question.ID.String()+"/answers", "")
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &answers))
+		if assert.Len(t, answers, 1) {
+			assert.True(t, answers[0].Mine)
+		}
+	}
+
+	var answerContext types.AnswerContext
+	rec = send(alice, http.MethodGet, "/api/answer/"+answer.ID.String()+"/context", "")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &answerContext))
+	assert.Equal(t, 1, answerContext.Question.AnswerCount)
+	assert.Empty(t, answerContext.Siblings, "siblings of other sessions should be hidden")
+	rec = send(bob, http.MethodGet, "/api/answer/"+answer.ID.String()+"/context", "")
+	assert.Equal(t, http.StatusNotFound, rec.Code, "other sessions shouldn't see the answer")
+
+	// Hidden answers can't be merged nor moved
+	for _, body := range []string{
+		`{"source_id": "` + answer.ID.String() + `", "target_id": "` + bobAnswer.ID.String() + `"}`,
+		`{"source_id": "` + bobAnswer.ID.String() + `", "target_id": "` + answer.ID.String() + `"}`,
+	} {
+		rec = send(bob, http.MethodPost, "/api/answer/merge", body)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "another session's answer shouldn't be merged")
+	}
+
+	var target types.Question
+	rec = send(alice, http.MethodPost, "/api/question", `{"text": "Target"}`)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &target))
+	rec = send(alice, http.MethodDelete, "/api/question/"+question.ID.String()+"?move_answers_to="+target.ID.String(), "")
+	assert.Equal(t, http.StatusConflict, rec.Code)
+
+	for _, session := range []string{alice, bob} {
+		var stored types.Retrospective
+		rec = send(session, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "")
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stored))
+		if assert.Len(t, stored.Questions, 2) {
+			assert.Len(t, stored.Questions[0].Answers, 1, "answers should be left untouched")
+		}
+	}
+
+	// Leaving brainstorm answers with every answer
+	var revealed types.Retrospective
+	rec = send(alice, http.MethodPatch, "/api/retrospective/"+retro.ID.String()+"/phase", `{"phase": "voting"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &revealed))
+	assert.Equal(t, types.PHASE_VOTING, revealed.Phase)
+	if assert.Len(t, revealed.Questions, 2) {
+		assert.Len(t, revealed.Questions[0].Answers, 2)
+	}
+}
+
+func TestCreateLocation(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Location"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "/api/retrospective/"+retro.ID.String(), res.Header().Get("Location"))
+
+	res = doRequest(t, router, http.MethodGet, res.Header().Get("Location"), "", retro.ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code, "the location should point to the retrospective")
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "/api/retrospective/"+retro.ID.String(), res.Header().Get("Location"), "questions have no route of their own")
+
+	body := `{"question_id": "` + question.ID.String() + `", "text": "Everything"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "/api/retrospective/"+retro.ID.String(), res.Header().Get("Location"), "answers have no route of their own")
+
+	res = doRequest(t, router, http.MethodGet, res.Header().Get("Location"), "", retro.ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+}
+
+func TestCookieAttributes(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Cookies"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	cookies := func(res *httptest.ResponseRecorder) map[string]*http.Cookie {
+		byName := map[string]*http.Cookie{}
+		for _, cookie := range res.Result().Cookies() {
+			byName[cookie.Name] = cookie
+		}
+		return byName
+	}
+
+	// The test config works over plain HTTP
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	cookie := cookies(res)["retrospective_id"]
+	if assert.NotNil(t, cookie) {
+		assert.Equal(t, retro.ID.String(), cookie.Value)
+		assert.False(t, cookie.Secure)
+		assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+		assert.Equal(t, "/", cookie.Path)
+		assert.False(t, cookie.HttpOnly, "the frontend reads the retrospective cookie")
+	}
+
+	config.Get().Cookie = config.Cookie{Domain: "retro.example.com", Path: "/api", Secure: true, SameSite: "strict"}
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	for name, cookie := range cookies(res) {
+		assert.True(t, cookie.Secure, name)
+		assert.Equal(t, http.SameSiteStrictMode, cookie.SameSite, name)
+		assert.Equal(t, "retro.example.com", cookie.Domain, name)
+		assert.Equal(t, "/api", cookie.Path, name)
+	}
+	session := cookies(res)["simple-retro-session"]
+	if assert.NotNil(t, session, "a new session should be started") {
+		assert.True(t, session.HttpOnly)
+	}
+}
+
+func TestRetrospectiveCookieMaxAge(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Expiring"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	maxAge := func(path string) int {
+		res := doRequest(t, router, http.MethodGet, path, "", uuid.Nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+		for _, cookie := range res.Result().Cookies() {
+			if cookie.Name == "retrospective_id" {
+				return cookie.MaxAge
+			}
+		}
+		t.Fatal("retrospective cookie not set")
+		return 0
+	}
+
+	// The cookie expires with the retrospective, clean_up_days after creation
+	window := config.Get().Schedule.CleanUpDays * 24 * 60 * 60
+	path := "/api/retrospective/" + retro.ID.String()
+	for _, path := range []string{path, path + "?answers=false"} {
+		age := maxAge(path)
+		assert.LessOrEqual(t, age, window, path)
+		assert.Greater(t, age, window-60, path)
+	}
+
+	config.Get().Cookie.MaxAgeHours = 1
+	assert.Equal(t, 60*60, maxAge(path), "the configured cap should win")
+}
+
+func TestVisitedRetrospectives(t *testing.T) {
+	router := newTestController(t).router()
+
+	session := uuid.NewString()
+	send := func(method, path string, retroID uuid.UUID, out interface{}) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.AddCookie(&http.Cookie{Name: "simple-retro-session", Value: session})
+		if retroID != uuid.Nil {
+			req.AddCookie(&http.Cookie{Name: "retrospective_id", Value: retroID.String()})
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if out != nil {
+			err := json.Unmarshal(res.Body.Bytes(), out)
+			assert.Nilf(t, err, "error decoding response")
+		}
+		return res
+	}
+
+	retros := make([]types.Retrospective, 3)
+	for i, name := range []string{"First", "Second", "Third"} {
+		res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "`+name+`"}`, uuid.Nil, &retros[i])
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+
+	var visits []types.RetrospectiveVisit
+	res := send(http.MethodGet, "/api/session/retrospectives", uuid.Nil, &visits)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, visits, "creating isn't visiting")
+
+	for _, retro := range []types.Retrospective{retros[0], retros[1], retros[2], retros[0]} {
+		res = send(http.MethodGet, "/api/retrospective/"+retro.ID.String(), uuid.Nil, nil)
+		assert.Equal(t, http.StatusOK, res.Code)
+	}
+
+	res = send(http.MethodDelete, "/api/retrospective/"+retros[1].ID.String(), retros[1].ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+
+	res = send(http.MethodGet, "/api/session/retrospectives", uuid.Nil, &visits)
+	assert.Equal(t, http.StatusOK, res.Code)
+	if assert.Len(t, visits, 2, "deleted retrospectives should be left out") {
+		assert.Equal(t, retros[0].ID, visits[0].ID, "the most recent visit should come first")
+		assert.Equal(t, "First", visits[0].Name)
+		assert.Equal(t, retros[2].ID, visits[1].ID)
+		assert.True(t, visits[0].LastVisited.After(visits[1].LastVisited))
+	}
+
+	// Other sessions have their own history
+	res = doRequest(t, router, http.MethodGet, "/api/session/retrospectives", "", uuid.Nil, &visits)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, visits)
+}
+
+func TestDuplicateRetrospective(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Weekly", "description": "Every Friday"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	questions := make([]types.Question, 2)
+	for i, text := range []string{"What went well?", "What went wrong?"} {
+		res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "`+text+`"}`, retro.ID, &questions[i])
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+	body := `{"question_id": "` + questions[0].ID.String() + `", "text": "Everything"}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer", body, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	path := "/api/retrospective/" + retro.ID.String() + "/duplicate"
+	res = doRequest(t, router, http.MethodPost, path, "", uuid.New(), nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "only the retrospective of the cookie can be copied")
+
+	var duplicate types.Retrospective
+	res = doRequest(t, router, http.MethodPost, path, "", retro.ID, &duplicate)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.NotEqual(t, retro.ID, duplicate.ID)
+	assert.Equal(t, "Weekly (copy)", duplicate.Name)
+	assert.Equal(t, "Every Friday", duplicate.Description)
+	assert.Equal(t, "/api/retrospective/"+duplicate.ID.String(), res.Header().Get("Location"))
+
+	var cookie *http.Cookie
+	for _, c := range res.Result().Cookies() {
+		if c.Name == "retrospective_id" {
+			cookie = c
+		}
+	}
+	if assert.NotNil(t, cookie, "the cookie should move to the copy") {
+		assert.Equal(t, duplicate.ID.String(), cookie.Value)
+	}
+
+	var stored types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+duplicate.ID.String(), "", duplicate.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	if assert.Len(t, stored.Questions, 2) {
+		for i, question := range stored.Questions {
+			assert.Equal(t, questions[i].Text, question.Text, "questions should be copied in order")
+			assert.NotEqual(t, questions[i].ID, question.ID)
+			assert.Empty(t, question.Answers, "answers shouldn't be copied")
+		}
+	}
+
+	// The source keeps its answers
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, stored.Questions[0].Answers, 1)
+}
+
+func TestImportRetrospective(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Weekly", "description": "Every Friday"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went wrong?"}`, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	for _, body := range []string{`"text": "Shipping", "color": "green"`, `"text": "Pairing"`} {
+		res = doRequest(t, router, http.MethodPost, "/api/answer", `{"question_id": "`+question.ID.String()+`", `+body+`}`, retro.ID, nil)
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+
+	// The export is the retrospective as returned by the API
+	exported := doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &retro)
+	assert.Equal(t, http.StatusOK, exported.Code)
+
+	var imported types.Retrospective
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective/import", exported.Body.String(), uuid.Nil, &imported)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.NotEqual(t, retro.ID, imported.ID)
+	assert.Equal(t, "/api/retrospective/"+imported.ID.String(), res.Header().Get("Location"))
+	assert.Equal(t, types.PHASE_DISCUSSION, imported.Phase, "imported answers have no author to be shown to")
+
+	var stored types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+imported.ID.String(), "", imported.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, retro.Name, stored.Name)
+	assert.Equal(t, retro.Description, stored.Description)
+	if assert.Len(t, stored.Questions, len(retro.Questions)) {
+		for i, question := range stored.Questions {
+			assert.NotEqual(t, retro.Questions[i].ID, question.ID)
+			assert.Equal(t, retro.Questions[i].Text, question.Text)
+			if !assert.Len(t, question.Answers, len(retro.Questions[i].Answers)) {
+				continue
+			}
+			for j, answer := range question.Answers {
+				assert.NotEqual(t, retro.Questions[i].Answers[j].ID, answer.ID)
+				assert.Equal(t, question.ID, answer.QuestionID)
+				assert.Equal(t, retro.Questions[i].Answers[j].Text, answer.Text, "answers should keep their order")
+				assert.Equal(t, retro.Questions[i].Answers[j].Color, answer.Color)
+				assert.Equal(t, j+1, answer.Position)
+				assert.False(t, answer.Mine, "imported answers have no author")
+			}
+		}
+	}
+
+	// The source is left untouched
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, stored.Questions[0].Answers, 2)
+
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective/import", `{"name": "Broken", "questions": {}}`, uuid.Nil, nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code)
+
+	var errorResponse types.ErrorResponse
+	body := `{"name": "Weekly", "questions": [{"text": "Ok?", "answers": [{"text": ""}, {"text": "Fine", "color": "pink"}]}]}`
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective/import", body, uuid.Nil, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &errorResponse))
+	fields := make([]string, 0, len(errorResponse.Errors))
+	for _, fieldErr := range errorResponse.Errors {
+		fields = append(fields, fieldErr.Field)
+	}
+	assert.Equal(t, []string{"questions[0].answers[0].text", "questions[0].answers[1].color"}, fields)
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := newTestController(t).router()
+
+	res := doRequest(t, router, http.MethodPut, "/api/retrospective/"+uuid.NewString(), "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	assert.Equal(t, "DELETE, GET, PATCH", res.Header().Get("Allow"))
+
+	res = doRequest(t, router, http.MethodPost, "/api/session/retrospectives", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	assert.Equal(t, "GET", res.Header().Get("Allow"))
+
+	// Static segments are matched by the parameters of other methods too
+	res = doRequest(t, router, http.MethodGet, "/api/answer/merge", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, res.Code)
+	assert.Equal(t, "DELETE, PATCH, POST", res.Header().Get("Allow"))
+
+	res = doRequest(t, router, http.MethodPut, "/api/unknown", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "unknown paths are still not found")
+}
+
+func TestRetrospectiveETag(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Weekly"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/retrospective/"+retro.ID.String(), nil)
+		req.AddCookie(&http.Cookie{Name: "retrospective_id", Value: retro.ID.String()})
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	res = get("")
+	assert.Equal(t, http.StatusOK, res.Code)
+	etag := res.Header().Get("ETag")
+	assert.True(t, strings.HasPrefix(etag, `W/"`), "expected a weak ETag, got %q", etag)
+
+	res = get(etag)
+	assert.Equal(t, http.StatusNotModified, res.Code)
+	assert.Empty(t, res.Body.String())
+
+	res = get(`W/"stale", ` + etag)
+	assert.Equal(t, http.StatusNotModified, res.Code, "any listed ETag can match")
+
+	res = get(`W/"stale"`)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, etag, res.Header().Get("ETag"))
+
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = get(etag)
+	assert.Equal(t, http.StatusOK, res.Code, "a change should give a new ETag")
+	assert.NotEqual(t, etag, res.Header().Get("ETag"))
+}
+
+func TestCreateAnswersBulk(t *testing.T) {
+	router := newTestController(t).router()
+
+	var retro types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Bulk"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	showAnswers(t, router, retro.ID)
+
+	var question types.Question
+	res = doRequest(t, router, http.MethodPost, "/api/question", `{"text": "What went well?"}`, retro.ID, &question)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/answer", `{"question_id": "`+question.ID.String()+`", "text": "First"}`, retro.ID, nil)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	body := `{"question_id": "` + question.ID.String() + `", "texts": ["Fine", "` + strings.Repeat("a", types.ANSWER_LIMIT+1) + `"]}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer/bulk", body, retro.ID, nil)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.Code)
+	var errorResponse types.ErrorResponse
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &errorResponse))
+	if assert.Len(t, errorResponse.Errors, 1) {
+		assert.Equal(t, "texts[1]", errorResponse.Errors[0].Field)
+		assert.Equal(t, types.CODE_TOO_LONG, errorResponse.Errors[0].Code)
+	}
+
+	var stored types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Len(t, stored.Questions[0].Answers, 1, "a rejected batch must not create any answer")
+
+	var answers []types.Answer
+	body = `{"question_id": "` + question.ID.String() + `", "texts": ["Second", " Third ", "Fourth"]}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer/bulk", body, retro.ID, &answers)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	if assert.Len(t, answers, 3) {
+		for i, answer := range answers {
+			assert.Equal(t, i+2, answer.Position, "positions should follow the existing answers")
+			assert.Equal(t, question.ID, answer.QuestionID)
+			assert.True(t, answer.Mine)
+		}
+		assert.Equal(t, "Third", answers[1].Text)
+	}
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	texts := []string{}
+	for _, answer := range stored.Questions[0].Answers {
+		texts = append(texts, answer.Text)
+	}
+	assert.Equal(t, []string{"First", "Second", "Third", "Fourth"}, texts)
+
+	// The question must be part of the caller's retrospective
+	body = `{"question_id": "` + question.ID.String() + `", "texts": ["Elsewhere"]}`
+	res = doRequest(t, router, http.MethodPost, "/api/answer/bulk", body, uuid.New(), nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestPreviewCleanUp(t *testing.T) {
+	ct := newTestController(t)
+	res := doRequest(t, ct.router(), http.MethodGet, "/api/admin/cleanup/preview", "", uuid.Nil, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "admin routes are off without a token")
+
+	config.Get().Admin.Token = "0123456789abcdef"
+	router := ct.router()
+
+	// Created already expired
+	config.Get().Schedule.CleanUpDays = -1
+	var retro types.Retrospective
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Expired"}`, uuid.Nil, &retro)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	preview := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/cleanup/preview", nil)
+		if token != "" {
+			req.Header.Set("X-Admin-Token", token)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, preview("").Code)
+	assert.Equal(t, http.StatusUnauthorized, preview("fedcba9876543210").Code)
+
+	res = preview("0123456789abcdef")
+	assert.Equal(t, http.StatusOK, res.Code)
+	var cleanUp types.CleanUpPreview
+	assert.NoError(t, json.Unmarshal(res.Body.Bytes(), &cleanUp))
+	assert.Contains(t, cleanUp.Old, retro.ID)
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+retro.ID.String(), "", retro.ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code, "the preview must not delete anything")
+}
+
+func TestAdminRetrospectiveExpiry(t *testing.T) {
+	ct := newTestController(t)
+	config.Get().Admin.Token = "0123456789abcdef"
+	router := ct.router()
+
+	admin := func(method, path, body, token string, out interface{}) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("X-Admin-Token", token)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if out != nil && res.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(res.Body.Bytes(), out))
+		}
+		return res
+	}
+
+	// Both are created already expired
+	config.Get().Schedule.CleanUpDays = -1
+	var kept, expired types.Retrospective
+	res := doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Kept"}`, uuid.Nil, &kept)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	res = doRequest(t, router, http.MethodPost, "/api/retrospective", `{"name": "Expired"}`, uuid.Nil, &expired)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	ttlPath := "/api/admin/retrospective/" + kept.ID.String() + "/ttl"
+	expireAt := time.Now().UTC().Add(48 * time.Hour).Truncate(time.Second)
+	body := `{"expire_at": "` + expireAt.Format(time.RFC3339) + `"}`
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodPatch, ttlPath, body, "", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodPatch, ttlPath, body, "fedcba9876543210", nil).Code)
+	assert.Equal(t, http.StatusUnauthorized, admin(http.MethodDelete, "/api/admin/retrospective/"+kept.ID.String(), "", "", nil).Code)
+
+	res = admin(http.MethodPatch, ttlPath, `{"expire_at": "`+expireAt.Format(time.RFC3339)+`", "extend_days": 1}`, "0123456789abcdef", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code, "only one of expire_at and extend_days can be set")
+	res = admin(http.MethodPatch, ttlPath, `{"expire_at": "2000-01-01T00:00:00Z"}`, "0123456789abcdef", nil)
+	assert.Equal(t, http.StatusBadRequest, res.Code, "the expiry must be in the future")
+
+	var summary types.RetrospectiveSummary
+	res = admin(http.MethodPatch, ttlPath, body, "0123456789abcdef", &summary)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, expireAt.Equal(summary.ExpireAt))
+
+	res = admin(http.MethodPatch, ttlPath, `{"extend_days": 2}`, "0123456789abcdef", &summary)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, expireAt.AddDate(0, 0, 2).Equal(summary.ExpireAt), "the extension adds to the current expiry")
+
+	var stored types.Retrospective
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+kept.ID.String(), "", kept.ID, &stored)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.True(t, expireAt.AddDate(0, 0, 2).Equal(stored.ExpireAt))
+
+	_, err := ct.service.CleanUpRetros(context.Background())
+	assert.Nilf(t, err, "error cleaning up retrospectives")
+
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+kept.ID.String(), "", kept.ID, nil)
+	assert.Equal(t, http.StatusOK, res.Code, "the extended retrospective should survive the clean up")
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+expired.ID.String(), "", expired.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+
+	res = admin(http.MethodDelete, "/api/admin/retrospective/"+kept.ID.String(), "", "0123456789abcdef", nil)
+	assert.Equal(t, http.StatusOK, res.Code)
+	res = doRequest(t, router, http.MethodGet, "/api/retrospective/"+kept.ID.String(), "", kept.ID, nil)
+	assert.Equal(t, http.StatusNotFound, res.Code, "the purge deletes right away")
+	res = admin(http.MethodDelete, "/api/admin/retrospective/"+kept.ID.String(), "", "0123456789abcdef", nil)
+	assert.Equal(t, http.StatusNotFound, res.Code)
+}
+
+func TestListRetrospectives(t *testing.T) {
+	ct := newTestController(t)
+	config.Get().Admin.Token = "0123456789abcdef"
+	router := ct.router()
+
+	list := func(query string, out *types.RetrospectiveList) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/admin/retrospectives"+query, nil)
+		req.Header.Set("X-Admin-Token", "0123456789abcdef")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		if out != nil && res.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(res.Body.Bytes(), out))
+		}
+		return res
+	}
+
+	// The name keeps the search apart from the retrospectives of other tests
+	prefix := "listed-" + uuid.NewString()[:8]
+	for i := 0; i < 3; i++ {
+		body := fmt.Sprintf(`{"name": "%s %d"}`, prefix, i)
+		res := doRequest(t, router, http.MethodPost, "/api/retrospective", body, uuid.Nil, nil)
+		assert.Equal(t, http.StatusCreated, res.Code)
+	}
+
+	var page types.RetrospectiveList
+	res := list("?search="+prefix, &page)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 3, page.Total)
+	assert.Equal(t, 1, page.Page)
+	assert.Equal(t, types.SEARCH_PAGE_SIZE, page.Size)
+	assert.Len(t, page.Retrospectives, 3)
+
+	res = list("?search="+prefix+"&page=2&size=2", &page)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Equal(t, 3, page.Total)
+	if assert.Len(t, page.Retrospectives, 1, "the last page holds what is left") {
+		assert.Equal(t, prefix+" 0", page.Retrospectives[0].Name)
+	}
+
+	res = list("?search="+prefix+"&page=3&size=2", &page)
+	assert.Equal(t, http.StatusOK, res.Code)
+	assert.Empty(t, page.Retrospectives, "a page past the end is empty")
+
+	for _, query := range []string{"?page=0", "?page=one", "?size=0", "?size=101", "?size=-1"} {
+		assert.Equal(t, http.StatusBadRequest, list(query, nil).Code, query)
+	}
+	assert.Equal(t, http.StatusOK, list("?size=100", nil).Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/retrospectives", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	assert.Equal(t, http.StatusUnauthorized, res.Code)
+}
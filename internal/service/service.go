@@ -2,69 +2,354 @@ package service
 
 import (
 	"api/config"
+	"api/internal/metrics"
 	"api/internal/repository"
 	"api/types"
 	"context"
-	"log"
+	"errors"
+	"fmt"
 	"net/http"
+	"sync"
 	"time"
 
 	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrQuestionLimit is returned when a retrospective already holds the
+	// maximum number of questions.
+	ErrQuestionLimit = errors.New("question limit reached")
+	// ErrAnswerLimit is returned when a question already holds the maximum
+	// number of answers.
+	ErrAnswerLimit = errors.New("answer limit reached")
+	// ErrCleanUpRunning is returned when a clean up routine starts while
+	// another one is still running.
+	ErrCleanUpRunning = errors.New("clean up already running")
+	// ErrAnswersHidden is returned when moving answers while the
+	// retrospective only shows them to their authors.
+	ErrAnswersHidden = errors.New("answers can't be moved while they are hidden")
 )
 
 type Service struct {
-	repository          repository.Repository
-	webSocketRepository repository.WebSocketRepository
+	repository  repository.Repository
+	broadcaster repository.Broadcaster
+	logger      *zap.Logger
+	// Held by the running clean up routine, so a slow one isn't overlapped
+	cleanUp sync.Mutex
 }
 
-func New(repo repository.Repository, webSocketRepo repository.WebSocketRepository) *Service {
+func New(repo repository.Repository, broadcaster repository.Broadcaster, logger *zap.Logger) *Service {
 	return &Service{
-		repository:          repo,
-		webSocketRepository: webSocketRepo,
+		repository:  withQueryTimeout(repo),
+		broadcaster: broadcaster,
+		logger:      logger,
 	}
 }
 
 func (s *Service) CreateRetrospective(ctx context.Context, retro *types.Retrospective) error {
+	return s.createRetrospective(ctx, retro, types.PHASE_BRAINSTORM)
+}
+
+func (s *Service) createRetrospective(ctx context.Context, retro *types.Retrospective, phase string) error {
 	id, err := uuid.NewV7()
 	if err != nil {
 		return err
 	}
 
 	retro.ID = id
+	retro.Phase = phase
 	retro.CreatedAt = time.Now().UTC()
+	retro.ExpireAt = retro.CreatedAt.Add(retention())
 	err = s.repository.CreateRetrospective(ctx, retro)
 	if err != nil {
 		return err
 	}
-	return s.webSocketRepository.CreateRetrospective(ctx, retro)
+	metrics.CreatedTotal.WithLabelValues("retrospective").Inc()
+	s.logBroadcastError(ctx, "retrospective", s.broadcaster.CreateRetrospective(ctx, retro))
+	return nil
 }
 
-func (s *Service) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
-	config := config.Get()
-	cleanUpDays := time.Duration(config.Schedule.CleanUpDays)
+// logBroadcastError logs a failed creation broadcast. Broadcasts are best
+// effort, the write already succeeded and clients catch up on their next
+// load, so the error isn't returned to the caller.
+func (s *Service) logBroadcastError(ctx context.Context, kind string, err error) {
+	if err == nil {
+		return
+	}
+	s.logger.Warn("error broadcasting creation",
+		zap.Any("request_id", ctx.Value("request_id")),
+		zap.String("type", kind),
+		zap.Error(err),
+	)
+}
+
+// CreateRetrospectiveFromTemplate creates a retrospective with the questions
+// of a built-in template.
+func (s *Service) CreateRetrospectiveFromTemplate(ctx context.Context, retro *types.Retrospective, template types.Template) error {
+	retro.Questions = make([]types.Question, 0, len(template.Questions))
+	for _, text := range template.Questions {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		retro.Questions = append(retro.Questions, types.Question{
+			ID:      id,
+			Text:    text,
+			Answers: []types.Answer{},
+		})
+	}
 
+	if err := s.CreateRetrospective(ctx, retro); err != nil {
+		return err
+	}
+	metrics.CreatedTotal.WithLabelValues("question").Add(float64(len(retro.Questions)))
+	return nil
+}
+
+// ImportRetrospective creates a retrospective with the given questions and
+// answers, all of them under new ids. Answers are numbered in their order. A
+// retrospective with answers starts in discussion, so they are shown.
+func (s *Service) ImportRetrospective(ctx context.Context, retro *types.Retrospective) error {
+	limits := config.Get().Limits
+	if limits.MaxQuestions > 0 && len(retro.Questions) > limits.MaxQuestions {
+		return ErrQuestionLimit
+	}
+
+	answerCount := 0
+	for i := range retro.Questions {
+		question := &retro.Questions[i]
+		if limits.MaxAnswersPerQuestion > 0 && len(question.Answers) > limits.MaxAnswersPerQuestion {
+			return ErrAnswerLimit
+		}
+
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		question.ID = id
+
+		for j := range question.Answers {
+			answer := &question.Answers[j]
+			if answer.ID, err = uuid.NewV7(); err != nil {
+				return err
+			}
+			answer.QuestionID = question.ID
+			answer.Position = j + 1
+			answer.Version = 1
+		}
+		answerCount += len(question.Answers)
+	}
+
+	// Imported answers have no author, brainstorm would hide them from everyone
+	phase := types.PHASE_BRAINSTORM
+	if answerCount > 0 {
+		phase = types.PHASE_DISCUSSION
+	}
+	if err := s.createRetrospective(ctx, retro, phase); err != nil {
+		return err
+	}
+	metrics.CreatedTotal.WithLabelValues("question").Add(float64(len(retro.Questions)))
+	metrics.CreatedTotal.WithLabelValues("answer").Add(float64(answerCount))
+	return nil
+}
+
+// DuplicateRetrospective creates a retrospective with the description and
+// questions of the source one, but none of its answers.
+func (s *Service) DuplicateRetrospective(ctx context.Context, sourceID uuid.UUID) (*types.Retrospective, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, err
+	}
+
+	retro := &types.Retrospective{
+		ID:        id,
+		Phase:     types.PHASE_BRAINSTORM,
+		CreatedAt: time.Now().UTC(),
+	}
+	retro.ExpireAt = retro.CreatedAt.Add(retention())
+	err = s.repository.DuplicateRetrospective(ctx, sourceID, retro)
+	if err != nil {
+		return nil, err
+	}
+
+	metrics.CreatedTotal.WithLabelValues("retrospective").Inc()
+	metrics.CreatedTotal.WithLabelValues("question").Add(float64(len(retro.Questions)))
+	s.logBroadcastError(ctx, "retrospective", s.broadcaster.CreateRetrospective(ctx, retro))
+	return retro, nil
+}
+
+func (s *Service) GetTemplates(ctx context.Context) []types.Template {
+	return types.GetTemplates()
+}
+
+func (s *Service) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
 	retro, err := s.repository.GetRetrospective(ctx, id)
-	retro.ExpireAt = retro.CreatedAt.Add(cleanUpDays * 24 * time.Hour)
-	return retro, err
+	if err != nil {
+		return nil, err
+	}
+	retro.PendingDeletionAt = pendingDeletionAt(retro.ExpireAt)
+	return retro, nil
+}
+
+// GetRetrospectivePage returns a retrospective with only the questions and
+// answers selected by the query.
+func (s *Service) GetRetrospectivePage(ctx context.Context, id uuid.UUID, query types.AnswersQuery) (*types.Retrospective, error) {
+	retro, err := s.repository.GetRetrospectivePage(ctx, id, query)
+	if err != nil {
+		return nil, err
+	}
+	retro.PendingDeletionAt = pendingDeletionAt(retro.ExpireAt)
+	return retro, nil
+}
+
+// retention is how long new retrospectives are kept. Their expiry is stored
+// on creation, so changing it doesn't move the existing ones.
+func retention() time.Duration {
+	return time.Duration(config.Get().Schedule.CleanUpDays) * 24 * time.Hour
+}
+
+// pendingDeletionAt returns expireAt when it falls within the configured
+// deletion notice, nil otherwise.
+func pendingDeletionAt(expireAt time.Time) *time.Time {
+	notice := time.Duration(config.Get().Schedule.DeletionNoticeHours) * time.Hour
+	if notice <= 0 || time.Until(expireAt) > notice {
+		return nil
+	}
+	return &expireAt
+}
+
+func (s *Service) GetRetrospectiveSummary(ctx context.Context, id uuid.UUID) (*types.RetrospectiveSummary, error) {
+	retro, err := s.repository.GetRetrospectiveSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return retro, nil
+}
+
+// SearchRetrospectives lists a page of the retrospectives whose name contains
+// the search.
+func (s *Service) SearchRetrospectives(ctx context.Context, search types.RetrospectiveSearch) (*types.RetrospectiveList, error) {
+	return s.repository.SearchRetrospectives(ctx, search)
+}
+
+func (s *Service) GetRetrospectiveStats(ctx context.Context, id uuid.UUID) (*types.RetrospectiveStats, error) {
+	return s.repository.GetRetrospectiveStats(ctx, id)
+}
+
+// RefreshStoredMetrics sets the stored gauges to the number of rows
+// currently in the database.
+func (s *Service) RefreshStoredMetrics(ctx context.Context) error {
+	count, err := s.repository.CountContent(ctx)
+	if err != nil {
+		return err
+	}
+
+	metrics.Stored.WithLabelValues("retrospective").Set(float64(count.Retrospectives))
+	metrics.Stored.WithLabelValues("question").Set(float64(count.Questions))
+	metrics.Stored.WithLabelValues("answer").Set(float64(count.Answers))
+	return nil
+}
+
+// recentVisitsLimit is how many visited retrospectives a session is shown.
+const recentVisitsLimit = 20
+
+// RecordVisit remembers that the session in the context opened the
+// retrospective.
+func (s *Service) RecordVisit(ctx context.Context, id uuid.UUID) error {
+	return s.repository.SaveVisit(ctx, id)
+}
+
+// GetVisitedRetrospectives returns the retrospectives the session in the
+// context opened lately, most recent first. Deleted ones are left out.
+func (s *Service) GetVisitedRetrospectives(ctx context.Context) ([]types.RetrospectiveVisit, error) {
+	return s.repository.GetVisits(ctx, recentVisitsLimit)
 }
 
 func (s *Service) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
-	config := config.Get()
-	cleanUpDays := time.Duration(config.Schedule.CleanUpDays)
 	retro, err := s.repository.DeleteRetrospective(ctx, id)
 	if err != nil {
 		return nil, err
 	}
-	retro.ExpireAt = retro.CreatedAt.Add(cleanUpDays * 24 * time.Hour)
-	_, err = s.webSocketRepository.DeleteRetrospective(ctx, id)
+	_, err = s.broadcaster.DeleteRetrospective(ctx, id)
 	return retro, err
 }
 
+// SetRetrospectiveExpiry moves the expiry of a retrospective, either to the
+// requested date or some days after the current one.
+func (s *Service) SetRetrospectiveExpiry(ctx context.Context, id uuid.UUID, request types.RetrospectiveExpiryRequest) (*types.RetrospectiveSummary, error) {
+	retro, err := s.GetRetrospectiveSummary(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	expireAt := retro.ExpireAt.AddDate(0, 0, request.ExtendDays)
+	if request.ExpireAt != nil {
+		expireAt = *request.ExpireAt
+	}
+
+	err = s.repository.SetRetrospectiveExpiry(ctx, id, expireAt.UTC())
+	if err != nil {
+		return nil, err
+	}
+	retro.ExpireAt = expireAt.UTC()
+	return retro, nil
+}
+
 func (s *Service) UpdateRetrospective(ctx context.Context, retro *types.Retrospective) error {
-	return s.repository.UpdateRetrospective(ctx, retro)
+	err := s.repository.UpdateRetrospective(ctx, retro)
+	if err != nil {
+		return err
+	}
+	return s.broadcaster.UpdateRetrospective(ctx, retro)
+}
+
+func (s *Service) UpdateRetrospectivePhase(ctx context.Context, id uuid.UUID, phase string) (*types.Retrospective, error) {
+	current, err := s.repository.GetRetrospectivePhase(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := types.ValidatePhaseTransition(current, phase); err != nil {
+		return nil, err
+	}
+
+	err = s.repository.UpdateRetrospectivePhase(ctx, &types.Retrospective{ID: id, Phase: phase})
+	if err != nil {
+		return nil, err
+	}
+
+	// Loaded after the change, so the answers shown follow the new phase
+	retro, err := s.repository.GetRetrospective(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return retro, s.broadcaster.UpdateRetrospectivePhase(ctx, retro)
+}
+
+// checkQuestionLimit fails when adding count questions would go past the
+// configured maximum.
+func (s *Service) checkQuestionLimit(ctx context.Context, count int) error {
+	max := config.Get().Limits.MaxQuestions
+	if max <= 0 {
+		return nil
+	}
+
+	existing, err := s.repository.CountQuestions(ctx)
+	if err != nil {
+		return err
+	}
+	if existing+count > max {
+		return ErrQuestionLimit
+	}
+	return nil
 }
 
 func (s *Service) CreateQuestion(ctx context.Context, question *types.Question) error {
+	if err := s.checkQuestionLimit(ctx, 1); err != nil {
+		return err
+	}
+
 	id, err := uuid.NewV7()
 	if err != nil {
 		return err
@@ -75,7 +360,49 @@ func (s *Service) CreateQuestion(ctx context.Context, question *types.Question)
 	if err != nil {
 		return err
 	}
-	return s.webSocketRepository.CreateQuestion(ctx, question)
+	metrics.CreatedTotal.WithLabelValues("question").Inc()
+	s.logBroadcastError(ctx, "question", s.broadcaster.CreateQuestion(ctx, question))
+	return nil
+}
+
+func (s *Service) CreateQuestions(ctx context.Context, questions []*types.Question) error {
+	if err := s.checkQuestionLimit(ctx, len(questions)); err != nil {
+		return err
+	}
+
+	for _, question := range questions {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		question.ID = id
+	}
+
+	err := s.repository.CreateQuestions(ctx, questions)
+	if err != nil {
+		return err
+	}
+	metrics.CreatedTotal.WithLabelValues("question").Add(float64(len(questions)))
+	s.logBroadcastError(ctx, "question", s.broadcaster.CreateQuestions(ctx, questions))
+	return nil
+}
+
+func (s *Service) GetQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
+	return s.repository.GetQuestion(ctx, id)
+}
+
+// DuplicateQuestion creates a copy of a question, without its answers.
+func (s *Service) DuplicateQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
+	source, err := s.repository.GetQuestion(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	question := &types.Question{
+		Text:    source.Text,
+		Answers: []types.Answer{},
+	}
+	return question, s.CreateQuestion(ctx, question)
 }
 
 func (s *Service) UpdateQuestion(ctx context.Context, question *types.Question) error {
@@ -83,7 +410,7 @@ func (s *Service) UpdateQuestion(ctx context.Context, question *types.Question)
 	if err != nil {
 		return err
 	}
-	return s.webSocketRepository.UpdateQuestion(ctx, question)
+	return s.broadcaster.UpdateQuestion(ctx, question)
 }
 
 func (s *Service) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
@@ -91,14 +418,130 @@ func (s *Service) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Ques
 	if err != nil {
 		return question, err
 	}
-	_, err = s.webSocketRepository.DeleteQuestion(ctx, id)
+	_, err = s.broadcaster.DeleteQuestion(ctx, id)
+	return question, err
+}
+
+// MoveAnswersAndDeleteQuestion deletes the question after moving its
+// answers to the target question of the same retrospective. The returned
+// question holds the moved answers. Answers can't be moved while they are
+// hidden.
+func (s *Service) MoveAnswersAndDeleteQuestion(ctx context.Context, id uuid.UUID, targetID uuid.UUID) (*types.Question, error) {
+	// The moved answers are sent to every subscriber, whoever wrote them
+	hidden, err := s.answersHidden(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if hidden {
+		return nil, ErrAnswersHidden
+	}
+
+	// A question moved onto itself is rejected by the repository
+	if max := config.Get().Limits.MaxAnswersPerQuestion; max > 0 && id != targetID {
+		moved, err := s.repository.CountAnswers(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		existing, err := s.repository.CountAnswers(ctx, targetID)
+		if err != nil {
+			return nil, err
+		}
+		if existing+moved > max {
+			return nil, ErrAnswerLimit
+		}
+	}
+
+	question := &types.Question{ID: id}
+	err = s.repository.MoveAnswersAndDeleteQuestion(ctx, question, targetID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.broadcaster.MoveAnswersAndDeleteQuestion(ctx, question, targetID)
 	return question, err
 }
 
+func (s *Service) GetAnswers(ctx context.Context, questionID uuid.UUID) ([]types.Answer, error) {
+	return s.repository.GetAnswers(ctx, questionID)
+}
+
+// GetAnswerContext returns an answer with its question and sibling answers.
+func (s *Service) GetAnswerContext(ctx context.Context, id uuid.UUID) (*types.AnswerContext, error) {
+	answer, err := s.repository.GetAnswer(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	question, err := s.repository.GetQuestion(ctx, answer.QuestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	answers, err := s.repository.GetAnswers(ctx, answer.QuestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	siblings := make([]types.Answer, 0, len(answers))
+	for _, sibling := range answers {
+		if sibling.ID != answer.ID {
+			siblings = append(siblings, sibling)
+		}
+	}
+
+	return &types.AnswerContext{
+		Answer: *answer,
+		Question: types.QuestionSummary{
+			ID:          question.ID,
+			Text:        question.Text,
+			AnswerCount: len(answers),
+		},
+		Siblings: siblings,
+	}, nil
+}
+
+// answersHidden tells whether the retrospective of the context only shows
+// its answers to the session which wrote them.
+func (s *Service) answersHidden(ctx context.Context) (bool, error) {
+	if !config.Get().Features.Phases {
+		return false, nil
+	}
+
+	retroID, _ := ctx.Value("retrospective_id").(uuid.UUID)
+	phase, err := s.repository.GetRetrospectivePhase(ctx, retroID)
+	if err != nil {
+		return false, err
+	}
+	return types.HidesAnswers(phase), nil
+}
+
+// answerAudience returns the context to broadcast answer changes with. While
+// the retrospective hides its answers, only the session making the change
+// gets them.
+func (s *Service) answerAudience(ctx context.Context) (context.Context, error) {
+	hidden, err := s.answersHidden(ctx)
+	if err != nil || !hidden {
+		return ctx, err
+	}
+
+	session, _ := ctx.Value("session_id").(string)
+	return context.WithValue(ctx, "author_only", session), nil
+}
+
 func (s *Service) CreateAnswer(ctx context.Context, answer *types.Answer) error {
+	if max := config.Get().Limits.MaxAnswersPerQuestion; max > 0 {
+		existing, err := s.repository.CountAnswers(ctx, answer.QuestionID)
+		if err != nil {
+			return err
+		}
+		if existing >= max {
+			return ErrAnswerLimit
+		}
+	}
+
 	id, err := uuid.NewV7()
 	if err != nil {
-		return nil
+		return err
 	}
 
 	answer.ID = id
@@ -106,7 +549,52 @@ func (s *Service) CreateAnswer(ctx context.Context, answer *types.Answer) error
 	if err != nil {
 		return err
 	}
-	return s.webSocketRepository.CreateAnswer(ctx, answer)
+	metrics.CreatedTotal.WithLabelValues("answer").Inc()
+
+	audience, err := s.answerAudience(ctx)
+	if err == nil {
+		err = s.broadcaster.CreateAnswer(audience, answer)
+	}
+	s.logBroadcastError(ctx, "answer", err)
+	return nil
+}
+
+// CreateAnswers creates answers of the same question, all of them or none.
+func (s *Service) CreateAnswers(ctx context.Context, answers []*types.Answer) error {
+	if len(answers) == 0 {
+		return nil
+	}
+
+	if max := config.Get().Limits.MaxAnswersPerQuestion; max > 0 {
+		existing, err := s.repository.CountAnswers(ctx, answers[0].QuestionID)
+		if err != nil {
+			return err
+		}
+		if existing+len(answers) > max {
+			return ErrAnswerLimit
+		}
+	}
+
+	for _, answer := range answers {
+		id, err := uuid.NewV7()
+		if err != nil {
+			return err
+		}
+		answer.ID = id
+	}
+
+	err := s.repository.CreateAnswers(ctx, answers)
+	if err != nil {
+		return err
+	}
+	metrics.CreatedTotal.WithLabelValues("answer").Add(float64(len(answers)))
+
+	audience, err := s.answerAudience(ctx)
+	if err == nil {
+		err = s.broadcaster.CreateAnswers(audience, answers)
+	}
+	s.logBroadcastError(ctx, "answer", err)
+	return nil
 }
 
 func (s *Service) UpdateAnswer(ctx context.Context, answer *types.Answer) error {
@@ -114,7 +602,12 @@ func (s *Service) UpdateAnswer(ctx context.Context, answer *types.Answer) error
 	if err != nil {
 		return err
 	}
-	return s.webSocketRepository.UpdateAnswer(ctx, answer)
+
+	audience, err := s.answerAudience(ctx)
+	if err != nil {
+		return err
+	}
+	return s.broadcaster.UpdateAnswer(audience, answer)
 }
 
 func (s *Service) DeleteAnswer(ctx context.Context, answer *types.Answer) error {
@@ -122,49 +615,262 @@ func (s *Service) DeleteAnswer(ctx context.Context, answer *types.Answer) error
 	if err != nil {
 		return err
 	}
-	err = s.webSocketRepository.DeleteAnswer(ctx, answer)
-	return err
+
+	audience, err := s.answerAudience(ctx)
+	if err != nil {
+		return err
+	}
+	return s.broadcaster.DeleteAnswer(audience, answer)
+}
+
+// MergeAnswers appends the text of the source answer to the target and
+// deletes the source. Subscribers get the merge and the deletion.
+func (s *Service) MergeAnswers(ctx context.Context, source *types.Answer, target *types.Answer) error {
+	err := s.repository.MergeAnswers(ctx, source, target)
+	if err != nil {
+		return err
+	}
+
+	audience, err := s.answerAudience(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = s.broadcaster.MergeAnswers(audience, source, target)
+	if err != nil {
+		return err
+	}
+	return s.broadcaster.DeleteAnswer(audience, source)
+}
+
+// ClearAnswers deletes every answer of the retrospective, keeping its
+// questions, and returns how many were deleted.
+func (s *Service) ClearAnswers(ctx context.Context, retroID uuid.UUID) (int, error) {
+	clear := &types.RetrospectiveClear{ID: retroID}
+	err := s.repository.DeleteAnswersByRetrospective(ctx, clear)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(clear.Answers), s.broadcaster.DeleteAnswersByRetrospective(ctx, clear)
+}
+
+// idempotencyTTL is how long the response of a request sent with an
+// Idempotency-Key is kept.
+func idempotencyTTL() time.Duration {
+	return time.Duration(config.Get().Server.IdempotencyTTLMinutes) * time.Minute
+}
+
+// GetIdempotentResponse returns the response the session got for the key,
+// or sql.ErrNoRows when there is none or it expired.
+func (s *Service) GetIdempotentResponse(ctx context.Context, key string) (*types.IdempotentResponse, error) {
+	return s.repository.GetIdempotentResponse(ctx, key, time.Now().UTC().Add(-idempotencyTTL()))
+}
+
+// ReserveIdempotencyKey claims the key for a request of the session, false
+// means it is already taken by a pending or answered request.
+func (s *Service) ReserveIdempotencyKey(ctx context.Context, key string, route string) (bool, error) {
+	return s.repository.ReserveIdempotencyKey(ctx, key, route, time.Now().UTC().Add(-idempotencyTTL()))
+}
+
+// ReleaseIdempotencyKey frees a key whose request failed, so it can be
+// retried.
+func (s *Service) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	return s.repository.ReleaseIdempotencyKey(ctx, key)
+}
+
+func (s *Service) SaveIdempotentResponse(ctx context.Context, key string, response *types.IdempotentResponse) error {
+	return s.repository.SaveIdempotentResponse(ctx, key, response)
+}
+
+// CleanUpIdempotentResponses deletes the expired idempotent responses.
+func (s *Service) CleanUpIdempotentResponses(ctx context.Context) (int, error) {
+	return s.repository.DeleteIdempotentResponses(ctx, time.Now().UTC().Add(-idempotencyTTL()))
+}
+
+// CleanUpEvents deletes the broadcast messages older than the retention.
+func (s *Service) CleanUpEvents(ctx context.Context) (int, error) {
+	retention := time.Duration(config.Get().WebSocket.EventRetentionMinutes) * time.Minute
+	return s.repository.DeleteEvents(ctx, time.Now().UTC().Add(-retention))
 }
 
 func (s *Service) SubscribeChanges(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	return s.webSocketRepository.AddConnection(ctx, w, r)
+	return s.broadcaster.AddConnection(ctx, w, r)
 }
 
+// LoadAllRetrospectives registers every stored retrospective for WebSocket
+// subscriptions. A failing retrospective doesn't prevent the others from
+// being loaded, all failures are returned together.
 func (s *Service) LoadAllRetrospectives(ctx context.Context) error {
 	ids, err := s.repository.GetAllRetrospectives(ctx)
 	if err != nil {
 		return err
 	}
 
+	var errs []error
 	for _, id := range ids {
-		err := s.webSocketRepository.CreateRetrospective(ctx, &types.Retrospective{ID: id})
+		err := s.broadcaster.CreateRetrospective(ctx, &types.Retrospective{ID: id})
 		if err != nil {
-			return err
+			s.logger.Warn("error loading retrospective", zap.Stringer("retrospective_id", id), zap.Error(err))
+			errs = append(errs, fmt.Errorf("retrospective %s: %w", id, err))
 		}
 	}
 
-	return nil
+	return errors.Join(errs...)
+}
+
+// Ping checks the database is reachable.
+func (s *Service) Ping(ctx context.Context) error {
+	return s.repository.Ping(ctx)
+}
+
+func (s *Service) ConnectionCount() int {
+	return s.broadcaster.ConnectionCount()
 }
 
 func (s *Service) GetLimits(ctx context.Context) *types.ApiLimits {
-	return types.GetApiLimits()
+	limits := types.GetApiLimits()
+	limits.Retrospective.Questions = config.Get().Limits.MaxQuestions
+	limits.Question.Answers = config.Get().Limits.MaxAnswersPerQuestion
+	return limits
+}
+
+func (s *Service) GetFeatures(ctx context.Context) map[string]bool {
+	return config.Get().Features.Enabled()
+}
+
+// CleanUpRetros deletes retrospectives older than the configured retention.
+func (s *Service) CleanUpRetros(ctx context.Context) (*types.CleanUpSummary, error) {
+	if !s.cleanUp.TryLock() {
+		return nil, ErrCleanUpRunning
+	}
+	defer s.cleanUp.Unlock()
+
+	start := time.Now()
+	ids, err := s.oldRetrospectives(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.deleteRetrospectives(ctx, "old", ids, start)
+}
+
+// CleanUpEmptyRetros deletes retrospectives that never had content once the
+// configured grace period is over.
+func (s *Service) CleanUpEmptyRetros(ctx context.Context) (*types.CleanUpSummary, error) {
+	if !s.cleanUp.TryLock() {
+		return nil, ErrCleanUpRunning
+	}
+	defer s.cleanUp.Unlock()
+
+	start := time.Now()
+	ids, err := s.emptyRetrospectives(ctx, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.deleteRetrospectives(ctx, "empty", ids, start)
+}
+
+// PreviewCleanUp lists the retrospectives the clean up would delete now,
+// without deleting anything.
+func (s *Service) PreviewCleanUp(ctx context.Context) (*types.CleanUpPreview, error) {
+	now := time.Now()
+	old, err := s.oldRetrospectives(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	empty, err := s.emptyRetrospectives(ctx, now)
+	if err != nil {
+		return nil, err
+	}
+
+	return &types.CleanUpPreview{Old: old, Empty: empty}, nil
+}
+
+// oldRetrospectives returns the expired retrospectives.
+func (s *Service) oldRetrospectives(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	return s.repository.GetOldRetrospectives(ctx, now)
+}
+
+// emptyRetrospectives returns the retrospectives that never had content and
+// are past the configured grace period, none when it is disabled.
+func (s *Service) emptyRetrospectives(ctx context.Context, now time.Time) ([]uuid.UUID, error) {
+	graceMinutes := time.Duration(config.Get().Schedule.EmptyGraceMinutes)
+	if graceMinutes <= 0 {
+		return []uuid.UUID{}, nil
+	}
+
+	date := now.Add(-(graceMinutes * time.Minute))
+	return s.repository.GetEmptyRetrospectives(ctx, date)
 }
 
-func (s *Service) CleanUpRetros(ctx context.Context) error {
+// NotifyPendingDeletions warns the subscribers of every retrospective that
+// will be deleted within the configured deletion notice.
+func (s *Service) NotifyPendingDeletions(ctx context.Context) error {
 	config := config.Get()
-	cleanUpDays := time.Duration(config.Schedule.CleanUpDays)
-	date := time.Now().Add(-(cleanUpDays * 24 * time.Hour))
-	ids, err := s.repository.GetOldRetrospectives(ctx, date)
+	notice := time.Duration(config.Schedule.DeletionNoticeHours) * time.Hour
+	if notice <= 0 {
+		return nil
+	}
+
+	ids, err := s.oldRetrospectives(ctx, time.Now().Add(notice))
 	if err != nil {
 		return err
 	}
 
+	var errs []error
+	for _, id := range ids {
+		retro, err := s.repository.GetRetrospectiveSummary(ctx, id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("retrospective %s: %w", id, err))
+			continue
+		}
+
+		err = s.broadcaster.NotifyPendingDeletion(ctx, &types.Retrospective{ID: id, ExpireAt: retro.ExpireAt})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("retrospective %s: %w", id, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// deleteRetrospectives deletes every given retrospective, carrying on after
+// failures. All failures are returned together with the summary. In dry run
+// the retrospectives are only logged and listed in the summary.
+func (s *Service) deleteRetrospectives(ctx context.Context, routine string, ids []uuid.UUID, start time.Time) (*types.CleanUpSummary, error) {
+	summary := &types.CleanUpSummary{Scanned: len(ids)}
+
+	if config.Get().Schedule.DryRun {
+		for _, id := range ids {
+			s.logger.Info("retrospective would be deleted", zap.String("routine", routine), zap.Stringer("retrospective_id", id))
+		}
+		summary.DryRun = true
+		summary.IDs = ids
+		summary.Duration = time.Since(start)
+		return summary, nil
+	}
+
+	var errs []error
 	for _, id := range ids {
 		if _, err := s.repository.DeleteRetrospective(ctx, id); err != nil {
-			return err
+			s.logger.Warn("error deleting retrospective", zap.String("routine", routine), zap.Stringer("retrospective_id", id), zap.Error(err))
+			errs = append(errs, fmt.Errorf("retrospective %s: %w", id, err))
+			summary.Failed++
+			metrics.CleanUpFailed.WithLabelValues(routine).Inc()
+			continue
+		}
+		summary.Deleted++
+		metrics.CleanUpDeleted.WithLabelValues(routine).Inc()
+
+		// Subscribers must learn about the deletion and let go of the retrospective
+		if _, err := s.broadcaster.DeleteRetrospective(ctx, id); err != nil {
+			s.logger.Warn("error notifying retrospective deletion", zap.String("routine", routine), zap.Stringer("retrospective_id", id), zap.Error(err))
 		}
 	}
 
-	log.Printf("deleted %d retrospectives older than %s", len(ids), date.String())
-	return nil
+	summary.Duration = time.Since(start)
+	return summary, errors.Join(errs...)
 }
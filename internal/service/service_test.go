@@ -0,0 +1,493 @@
+package service
+
+import (
+	"api/config"
+	"api/internal/metrics"
+	"api/internal/repository"
+	"api/types"
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+// mockRepository implements only the methods a test needs, any other call
+// panics on the nil embedded interface.
+type mockRepository struct {
+	repository.Repository
+	ids       []uuid.UUID
+	failing   map[uuid.UUID]bool
+	deleted   []uuid.UUID
+	retros    map[uuid.UUID]*types.Retrospective
+	questions []*types.Question
+	answers   []*types.Answer
+}
+
+func (m *mockRepository) CountQuestions(ctx context.Context) (int, error) {
+	return len(m.questions), nil
+}
+
+func (m *mockRepository) CreateQuestion(ctx context.Context, question *types.Question) error {
+	m.questions = append(m.questions, question)
+	return nil
+}
+
+func (m *mockRepository) CountAnswers(ctx context.Context, questionID uuid.UUID) (int, error) {
+	return len(m.answers), nil
+}
+
+func (m *mockRepository) CreateAnswer(ctx context.Context, answer *types.Answer) error {
+	m.answers = append(m.answers, answer)
+	return nil
+}
+
+func (m *mockRepository) CreateRetrospective(ctx context.Context, retro *types.Retrospective) error {
+	if m.retros == nil {
+		m.retros = make(map[uuid.UUID]*types.Retrospective)
+	}
+	stored := *retro
+	m.retros[retro.ID] = &stored
+	return nil
+}
+
+func (m *mockRepository) GetAllRetrospectives(ctx context.Context) ([]uuid.UUID, error) {
+	return m.ids, nil
+}
+
+func (m *mockRepository) GetOldRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
+	return m.ids, nil
+}
+
+func (m *mockRepository) GetRetrospectivePhase(ctx context.Context, id uuid.UUID) (string, error) {
+	if retro, ok := m.retros[id]; ok {
+		return retro.Phase, nil
+	}
+	return types.PHASE_DISCUSSION, nil
+}
+
+func (m *mockRepository) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
+	stored, ok := m.retros[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	retro := *stored
+	return &retro, nil
+}
+
+func (m *mockRepository) UpdateRetrospectivePhase(ctx context.Context, retro *types.Retrospective) error {
+	stored, ok := m.retros[retro.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	stored.Phase = retro.Phase
+	return nil
+}
+
+func (m *mockRepository) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
+	if m.failing[id] {
+		return nil, fmt.Errorf("broken retrospective")
+	}
+	m.deleted = append(m.deleted, id)
+	return &types.Retrospective{ID: id}, nil
+}
+
+type mockWebSocket struct {
+	repository.Broadcaster
+	failing    map[uuid.UUID]bool
+	registered []uuid.UUID
+	// err is returned by every broadcast when set
+	err error
+}
+
+func (m *mockWebSocket) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
+	return nil, m.err
+}
+
+func (m *mockWebSocket) CreateQuestion(ctx context.Context, question *types.Question) error {
+	return m.err
+}
+
+func (m *mockWebSocket) CreateAnswer(ctx context.Context, answer *types.Answer) error {
+	return m.err
+}
+
+func (m *mockWebSocket) CreateRetrospective(ctx context.Context, retro *types.Retrospective) error {
+	if m.err != nil {
+		return m.err
+	}
+	if m.failing[retro.ID] {
+		return fmt.Errorf("broken retrospective")
+	}
+	m.registered = append(m.registered, retro.ID)
+	return nil
+}
+
+// subscribe returns a client registered for the retrospective changes, with
+// the latest version of the message schema.
+func subscribe(t *testing.T, s *Service, retroID uuid.UUID) *websocket.Conn {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), "retrospective_id", retroID)
+		_ = s.SubscribeChanges(ctx, w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	dialer := websocket.Dialer{Subprotocols: []string{"simple-retro.v2"}}
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nilf(t, err, "error connecting to websocket")
+	t.Cleanup(func() { client.Close() })
+
+	// The pong comes from the read loop, so the client is registered by then
+	var message types.WebSocketMessage
+	err = client.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = client.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", message.Type)
+
+	return client
+}
+
+func TestLoadAllRetrospectivesContinuesOnError(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New()}
+	repo := &mockRepository{ids: ids}
+	ws := &mockWebSocket{failing: map[uuid.UUID]bool{ids[1]: true}}
+
+	s := New(repo, ws, zap.NewNop())
+	err = s.LoadAllRetrospectives(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ids[1].String())
+	assert.Equal(t, []uuid.UUID{ids[0], ids[2]}, ws.registered)
+}
+
+// deadlineRepository records the deadline of the context it's called with.
+type deadlineRepository struct {
+	repository.Repository
+	deadline    time.Time
+	hasDeadline bool
+}
+
+func (d *deadlineRepository) GetQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
+	d.deadline, d.hasDeadline = ctx.Deadline()
+	return nil, ctx.Err()
+}
+
+func TestCreateRetrospective(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	repo := &mockRepository{}
+	ws := &mockWebSocket{}
+	s := New(repo, ws, zap.NewNop())
+
+	before := time.Now().UTC()
+	retro := &types.Retrospective{Name: "Sprint 1"}
+	err = s.CreateRetrospective(context.Background(), retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	assert.NotEqual(t, uuid.Nil, retro.ID)
+	assert.Equal(t, types.PHASE_BRAINSTORM, retro.Phase)
+	assert.Equal(t, time.UTC, retro.CreatedAt.Location())
+	assert.WithinRange(t, retro.CreatedAt, before, time.Now().UTC())
+	assert.Contains(t, repo.retros, retro.ID)
+	assert.Equal(t, []uuid.UUID{retro.ID}, ws.registered)
+}
+
+func TestRetrospectiveExpireAt(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Schedule.CleanUpDays = 30
+	conf.Schedule.DeletionNoticeHours = 24
+
+	repo := &mockRepository{}
+	s := New(repo, &mockWebSocket{}, zap.NewNop())
+	ctx := context.Background()
+
+	retro := &types.Retrospective{Name: "Weekly"}
+	err = s.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+	assert.Equal(t, retro.CreatedAt.Add(30*24*time.Hour), retro.ExpireAt)
+
+	// The expiry is stored on creation, a later retention doesn't move it
+	conf.Schedule.CleanUpDays = 1
+	got, err := s.GetRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Equal(t, retro.ExpireAt, got.ExpireAt)
+	assert.Nil(t, got.PendingDeletionAt)
+
+	expired := &types.Retrospective{ID: uuid.New(), ExpireAt: time.Date(2024, time.March, 31, 12, 0, 0, 0, time.UTC)}
+	repo.retros[expired.ID] = expired
+	got, err = s.GetRetrospective(ctx, expired.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	if assert.NotNil(t, got.PendingDeletionAt, "an expired retrospective is pending deletion") {
+		assert.Equal(t, expired.ExpireAt, *got.PendingDeletionAt)
+	}
+}
+
+func TestBroadcastError(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	broken := fmt.Errorf("broadcast failed")
+	repo := &mockRepository{}
+	s := New(repo, &mockWebSocket{err: broken}, zap.NewNop())
+
+	retro := &types.Retrospective{Name: "Sprint 1"}
+	err = s.CreateRetrospective(context.Background(), retro)
+	assert.Nil(t, err, "creation broadcasts are best effort")
+	assert.Contains(t, repo.retros, retro.ID, "the retrospective should be stored anyway")
+
+	question := &types.Question{Text: "What went well?"}
+	err = s.CreateQuestion(context.Background(), question)
+	assert.Nil(t, err, "creation broadcasts are best effort")
+	assert.Equal(t, []*types.Question{question}, repo.questions)
+
+	answer := &types.Answer{QuestionID: question.ID, Text: "Everything"}
+	err = s.CreateAnswer(context.Background(), answer)
+	assert.Nil(t, err, "creation broadcasts are best effort")
+	assert.Equal(t, []*types.Answer{answer}, repo.answers)
+
+	_, err = s.DeleteRetrospective(context.Background(), retro.ID)
+	assert.ErrorIs(t, err, broken)
+}
+
+func TestRetrospectiveNotFound(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	id := uuid.New()
+	s := New(&mockRepository{failing: map[uuid.UUID]bool{id: true}}, &mockWebSocket{}, zap.NewNop())
+
+	retro, err := s.GetRetrospective(context.Background(), id)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Nil(t, retro)
+
+	retro, err = s.UpdateRetrospectivePhase(context.Background(), id, types.PHASE_VOTING)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.Nil(t, retro)
+
+	retro, err = s.DeleteRetrospective(context.Background(), id)
+	assert.NotNil(t, err)
+	assert.Nil(t, retro)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	repo := &deadlineRepository{}
+	s := New(repo, &mockWebSocket{}, zap.NewNop())
+
+	conf.Database.QueryTimeoutMs = 500
+	start := time.Now()
+	_, err = s.GetQuestion(context.Background(), uuid.New())
+	assert.Nil(t, err)
+	if assert.True(t, repo.hasDeadline) {
+		assert.WithinDuration(t, start.Add(500*time.Millisecond), repo.deadline, 100*time.Millisecond)
+	}
+
+	conf.Database.QueryTimeoutMs = 0
+	_, err = s.GetQuestion(context.Background(), uuid.New())
+	assert.Nil(t, err)
+	assert.False(t, repo.hasDeadline)
+}
+
+func TestCleanUpRetrosSummary(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ids := []uuid.UUID{uuid.New(), uuid.New(), uuid.New(), uuid.New()}
+	repo := &mockRepository{
+		ids:     ids,
+		failing: map[uuid.UUID]bool{ids[1]: true, ids[3]: true},
+	}
+	deleted := testutil.ToFloat64(metrics.CleanUpDeleted.WithLabelValues("old"))
+	failed := testutil.ToFloat64(metrics.CleanUpFailed.WithLabelValues("old"))
+
+	s := New(repo, &mockWebSocket{}, zap.NewNop())
+	summary, err := s.CleanUpRetros(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), ids[3].String())
+	assert.Equal(t, 4, summary.Scanned)
+	assert.Equal(t, 2, summary.Deleted)
+	assert.Equal(t, 2, summary.Failed)
+	assert.Positive(t, summary.Duration)
+	assert.Equal(t, []uuid.UUID{ids[0], ids[2]}, repo.deleted)
+
+	assert.Equal(t, deleted+2, testutil.ToFloat64(metrics.CleanUpDeleted.WithLabelValues("old")))
+	assert.Equal(t, failed+2, testutil.ToFloat64(metrics.CleanUpFailed.WithLabelValues("old")))
+}
+
+// slowRepository holds GetOldRetrospectives until release is closed.
+type slowRepository struct {
+	*mockRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (m *slowRepository) GetOldRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
+	m.started <- struct{}{}
+	<-m.release
+	return m.mockRepository.GetOldRetrospectives(ctx, date)
+}
+
+func TestCleanUpRetrosDoesNotOverlap(t *testing.T) {
+	_, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	ids := []uuid.UUID{uuid.New()}
+	repo := &slowRepository{
+		mockRepository: &mockRepository{ids: ids},
+		started:        make(chan struct{}, 1),
+		release:        make(chan struct{}),
+	}
+	s := New(repo, &mockWebSocket{}, zap.NewNop())
+
+	done := make(chan *types.CleanUpSummary)
+	go func() {
+		summary, err := s.CleanUpRetros(context.Background())
+		assert.Nil(t, err)
+		done <- summary
+	}()
+	<-repo.started
+
+	// Ticks arriving while the first run is still going are skipped
+	_, err = s.CleanUpRetros(context.Background())
+	assert.ErrorIs(t, err, ErrCleanUpRunning)
+	_, err = s.CleanUpEmptyRetros(context.Background())
+	assert.ErrorIs(t, err, ErrCleanUpRunning)
+
+	close(repo.release)
+	summary := <-done
+	assert.Equal(t, 1, summary.Deleted)
+	assert.Equal(t, ids, repo.deleted, "the retrospective should be deleted once")
+
+	// The next run goes through once the first one is over
+	go func() { <-repo.started }()
+	_, err = s.CleanUpRetros(context.Background())
+	assert.Nil(t, err)
+}
+
+func TestCleanUpRetrosDryRun(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Schedule.DryRun = true
+
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	repo := &mockRepository{ids: ids}
+
+	s := New(repo, &mockWebSocket{}, zap.NewNop())
+	summary, err := s.CleanUpRetros(context.Background())
+
+	assert.Nil(t, err)
+	assert.True(t, summary.DryRun)
+	assert.Equal(t, 2, summary.Scanned)
+	assert.Equal(t, 0, summary.Deleted)
+	assert.Equal(t, ids, summary.IDs, "the retrospectives to delete should be reported")
+	assert.Empty(t, repo.deleted, "nothing should be deleted in dry run")
+}
+
+func TestCleanUpRetrosNotifiesSubscribers(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+
+	repo, err := repository.NewSQLite()
+	assert.Nilf(t, err, "error connecting to database")
+
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	s := New(repo, wsrepo, zap.NewNop())
+
+	// Created already expired
+	conf.Schedule.CleanUpDays = -1
+	retro := &types.Retrospective{Name: "Expired", Questions: []types.Question{}}
+	err = s.CreateRetrospective(context.Background(), retro)
+	assert.Nilf(t, err, "error creating retrospective")
+
+	client := subscribe(t, s, retro.ID)
+
+	summary, err := s.CleanUpRetros(context.Background())
+	assert.Nilf(t, err, "error cleaning up retrospectives")
+	assert.GreaterOrEqual(t, summary.Deleted, 1)
+
+	var message types.WebSocketMessage
+	err = client.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading delete message")
+	assert.Equal(t, "delete", message.Action)
+	assert.Equal(t, "retrospective", message.Type)
+}
+
+func TestPendingDeletion(t *testing.T) {
+	conf, err := config.Load("../../config/config_test.yaml")
+	assert.Nilf(t, err, "error loading config")
+	conf.Schedule.CleanUpDays = 1
+	conf.Schedule.DeletionNoticeHours = 2
+
+	repo, err := repository.NewSQLite()
+	assert.Nilf(t, err, "error connecting to database")
+
+	wsrepo, err := repository.NewWebSocket(zap.NewNop(), nil)
+	assert.Nilf(t, err, "error creating websocket repository")
+
+	s := New(repo, wsrepo, zap.NewNop())
+	ctx := context.Background()
+
+	retro := &types.Retrospective{Name: "Fresh", Questions: []types.Question{}}
+	err = s.CreateRetrospective(ctx, retro)
+	assert.Nilf(t, err, "error creating retrospective")
+	client := subscribe(t, s, retro.ID)
+
+	fresh, err := s.GetRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	assert.Nil(t, fresh.PendingDeletionAt)
+
+	err = s.NotifyPendingDeletions(ctx)
+	assert.Nilf(t, err, "error notifying pending deletions")
+
+	// Messages are written in order, a pong first means no warning was sent
+	var pong types.WebSocketMessage
+	err = client.WriteJSON(types.WebSocketMessage{Type: "ping"})
+	assert.Nilf(t, err, "error sending ping")
+	err = client.ReadJSON(&pong)
+	assert.Nilf(t, err, "error reading pong")
+	assert.Equal(t, "pong", pong.Type)
+
+	// A notice longer than the retention makes every retrospective near expiry
+	conf.Schedule.DeletionNoticeHours = 48
+
+	expiring, err := s.GetRetrospective(ctx, retro.ID)
+	assert.Nilf(t, err, "error getting retrospective")
+	if assert.NotNil(t, expiring.PendingDeletionAt) {
+		assert.Equal(t, expiring.ExpireAt, *expiring.PendingDeletionAt)
+	}
+
+	err = s.NotifyPendingDeletions(ctx)
+	assert.Nilf(t, err, "error notifying pending deletions")
+
+	var message struct {
+		Action string                `json:"action"`
+		Type   string                `json:"type"`
+		Value  types.PendingDeletion `json:"value"`
+	}
+	err = client.ReadJSON(&message)
+	assert.Nilf(t, err, "error reading pending deletion message")
+	assert.Equal(t, "pending_deletion", message.Action)
+	assert.Equal(t, "retrospective", message.Type)
+	assert.Equal(t, retro.ID, message.Value.ID)
+	assert.WithinDuration(t, expiring.ExpireAt, message.Value.PendingDeletionAt, time.Second)
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"api/config"
+	"api/internal/repository"
+	"api/types"
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// timeoutRepository bounds every call to the wrapped repository by the
+// configured query timeout, so a hung query can't block a request forever.
+type timeoutRepository struct {
+	repository repository.Repository
+}
+
+func withQueryTimeout(repo repository.Repository) repository.Repository {
+	return &timeoutRepository{repository: repo}
+}
+
+func (r *timeoutRepository) context(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := time.Duration(config.Get().Database.QueryTimeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (r *timeoutRepository) Ping(ctx context.Context) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.Ping(ctx)
+}
+
+func (r *timeoutRepository) GetOldRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetOldRetrospectives(ctx, date)
+}
+
+func (r *timeoutRepository) GetAllRetrospectives(ctx context.Context) ([]uuid.UUID, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetAllRetrospectives(ctx)
+}
+
+func (r *timeoutRepository) GetEmptyRetrospectives(ctx context.Context, date time.Time) ([]uuid.UUID, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetEmptyRetrospectives(ctx, date)
+}
+
+func (r *timeoutRepository) GetRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetRetrospective(ctx, id)
+}
+
+func (r *timeoutRepository) GetRetrospectivePage(ctx context.Context, id uuid.UUID, query types.AnswersQuery) (*types.Retrospective, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetRetrospectivePage(ctx, id, query)
+}
+
+func (r *timeoutRepository) GetRetrospectiveStats(ctx context.Context, id uuid.UUID) (*types.RetrospectiveStats, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetRetrospectiveStats(ctx, id)
+}
+
+func (r *timeoutRepository) CountContent(ctx context.Context) (*types.ContentCount, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CountContent(ctx)
+}
+
+func (r *timeoutRepository) SearchRetrospectives(ctx context.Context, search types.RetrospectiveSearch) (*types.RetrospectiveList, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.SearchRetrospectives(ctx, search)
+}
+
+func (r *timeoutRepository) GetRetrospectivePhase(ctx context.Context, id uuid.UUID) (string, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetRetrospectivePhase(ctx, id)
+}
+
+func (r *timeoutRepository) GetRetrospectiveSummary(ctx context.Context, id uuid.UUID) (*types.RetrospectiveSummary, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetRetrospectiveSummary(ctx, id)
+}
+
+func (r *timeoutRepository) CreateRetrospective(ctx context.Context, retro *types.Retrospective) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CreateRetrospective(ctx, retro)
+}
+
+func (r *timeoutRepository) UpdateRetrospective(ctx context.Context, retro *types.Retrospective) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.UpdateRetrospective(ctx, retro)
+}
+
+func (r *timeoutRepository) DeleteRetrospective(ctx context.Context, id uuid.UUID) (*types.Retrospective, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DeleteRetrospective(ctx, id)
+}
+
+func (r *timeoutRepository) UpdateRetrospectivePhase(ctx context.Context, retro *types.Retrospective) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.UpdateRetrospectivePhase(ctx, retro)
+}
+
+func (r *timeoutRepository) GetQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetQuestion(ctx, id)
+}
+
+func (r *timeoutRepository) CountQuestions(ctx context.Context) (int, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CountQuestions(ctx)
+}
+
+func (r *timeoutRepository) CreateQuestion(ctx context.Context, question *types.Question) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CreateQuestion(ctx, question)
+}
+
+func (r *timeoutRepository) CreateQuestions(ctx context.Context, questions []*types.Question) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CreateQuestions(ctx, questions)
+}
+
+func (r *timeoutRepository) CreateAnswers(ctx context.Context, answers []*types.Answer) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CreateAnswers(ctx, answers)
+}
+
+func (r *timeoutRepository) UpdateQuestion(ctx context.Context, question *types.Question) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.UpdateQuestion(ctx, question)
+}
+
+func (r *timeoutRepository) DeleteQuestion(ctx context.Context, id uuid.UUID) (*types.Question, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DeleteQuestion(ctx, id)
+}
+
+func (r *timeoutRepository) GetAnswer(ctx context.Context, id uuid.UUID) (*types.Answer, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetAnswer(ctx, id)
+}
+
+func (r *timeoutRepository) GetAnswers(ctx context.Context, questionID uuid.UUID) ([]types.Answer, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetAnswers(ctx, questionID)
+}
+
+func (r *timeoutRepository) CountAnswers(ctx context.Context, questionID uuid.UUID) (int, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CountAnswers(ctx, questionID)
+}
+
+func (r *timeoutRepository) CreateAnswer(ctx context.Context, answer *types.Answer) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.CreateAnswer(ctx, answer)
+}
+
+func (r *timeoutRepository) UpdateAnswer(ctx context.Context, answer *types.Answer) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.UpdateAnswer(ctx, answer)
+}
+
+func (r *timeoutRepository) DeleteAnswer(ctx context.Context, answer *types.Answer) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DeleteAnswer(ctx, answer)
+}
+
+func (r *timeoutRepository) MoveAnswersAndDeleteQuestion(ctx context.Context, question *types.Question, targetID uuid.UUID) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.MoveAnswersAndDeleteQuestion(ctx, question, targetID)
+}
+
+func (r *timeoutRepository) MergeAnswers(ctx context.Context, source *types.Answer, target *types.Answer) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.MergeAnswers(ctx, source, target)
+}
+
+func (r *timeoutRepository) DeleteAnswersByRetrospective(ctx context.Context, clear *types.RetrospectiveClear) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DeleteAnswersByRetrospective(ctx, clear)
+}
+
+func (r *timeoutRepository) GetIdempotentResponse(ctx context.Context, key string, since time.Time) (*types.IdempotentResponse, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetIdempotentResponse(ctx, key, since)
+}
+
+func (r *timeoutRepository) ReserveIdempotencyKey(ctx context.Context, key string, route string, since time.Time) (bool, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.ReserveIdempotencyKey(ctx, key, route, since)
+}
+
+func (r *timeoutRepository) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.ReleaseIdempotencyKey(ctx, key)
+}
+
+func (r *timeoutRepository) SaveIdempotentResponse(ctx context.Context, key string, response *types.IdempotentResponse) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.SaveIdempotentResponse(ctx, key, response)
+}
+
+func (r *timeoutRepository) DeleteIdempotentResponses(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DeleteIdempotentResponses(ctx, before)
+}
+
+func (r *timeoutRepository) DeleteEvents(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DeleteEvents(ctx, before)
+}
+
+func (r *timeoutRepository) SaveVisit(ctx context.Context, retroID uuid.UUID) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.SaveVisit(ctx, retroID)
+}
+
+func (r *timeoutRepository) GetVisits(ctx context.Context, limit int) ([]types.RetrospectiveVisit, error) {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.GetVisits(ctx, limit)
+}
+
+func (r *timeoutRepository) DuplicateRetrospective(ctx context.Context, sourceID uuid.UUID, retro *types.Retrospective) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.DuplicateRetrospective(ctx, sourceID, retro)
+}
+
+func (r *timeoutRepository) SetRetrospectiveExpiry(ctx context.Context, id uuid.UUID, expireAt time.Time) error {
+	ctx, cancel := r.context(ctx)
+	defer cancel()
+	return r.repository.SetRetrospectiveExpiry(ctx, id, expireAt)
+}
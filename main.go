@@ -8,32 +8,65 @@ import (
 	"api/internal/service"
 	"context"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
 )
 
+const CONFIG_FILE = "config/config.yaml"
+
 func main() {
-	config, err := config.Load("config/config.yaml")
+	conf, err := config.Load(CONFIG_FILE)
 	if err != nil {
 		log.Fatalf("error loading config: %s", err.Error())
 	}
+	if err := conf.Validate(); err != nil {
+		log.Fatalf("invalid config:\n%s", err.Error())
+	}
+
+	logger, err := config.NewLogger(conf)
+	if err != nil {
+		log.Fatalf("error creating logger: %s", err.Error())
+	}
+	defer logger.Sync()
 
 	repo, err := repository.NewSQLite()
 	if err != nil {
-		log.Fatalf("error creating repository: %s", err.Error())
+		logger.Fatal("error creating repository", zap.Error(err))
 	}
 
-	wsrepo, err := repository.NewWebSocket()
+	broadcaster, err := repository.NewWebSocket(logger, repo)
 	if err != nil {
-		log.Fatalf("error creating repository: %s", err.Error())
+		logger.Fatal("error creating broadcaster", zap.Error(err))
 	}
 
-	service := service.New(repo, wsrepo)
-	service.LoadAllRetrospectives(context.Background())
+	service := service.New(repo, broadcaster, logger)
+	if err := service.LoadAllRetrospectives(context.Background()); err != nil {
+		logger.Warn("some retrospectives could not be loaded", zap.Error(err))
+	}
 
-	controller := server.New(service)
+	controller := server.New(service, logger)
 
-	schedule := schedule.New(service)
+	schedule := schedule.New(service, logger)
 	schedule.Start()
 
-	log.Printf("initing service: %s", config.Name)
+	// SIGHUP reloads the config, the clean up interval included
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			conf, err := config.Reload(CONFIG_FILE)
+			if err != nil {
+				logger.Error("error reloading config, keeping the current one", zap.Error(err))
+				continue
+			}
+			schedule.Reload(conf.Schedule)
+			logger.Info("config reloaded")
+		}
+	}()
+
+	logger.Info("initing service", zap.String("name", conf.Name))
 	controller.Start()
 }
@@ -0,0 +1,25 @@
+package types
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CleanUpSummary is the outcome of a clean up run.
+type CleanUpSummary struct {
+	Scanned  int           `json:"scanned"`
+	Deleted  int           `json:"deleted"`
+	Failed   int           `json:"failed"`
+	Duration time.Duration `json:"duration"`
+	// Set when nothing was deleted because of schedule.dry_run, IDs then
+	// lists the retrospectives that would have been
+	DryRun bool        `json:"dry_run,omitempty"`
+	IDs    []uuid.UUID `json:"ids,omitempty"`
+}
+
+// CleanUpPreview lists the retrospectives the clean up would delete now.
+type CleanUpPreview struct {
+	Old   []uuid.UUID `json:"old"`
+	Empty []uuid.UUID `json:"empty"`
+}
@@ -0,0 +1,21 @@
+package types
+
+const (
+	COLOR_RED    = "red"
+	COLOR_ORANGE = "orange"
+	COLOR_YELLOW = "yellow"
+	COLOR_GREEN  = "green"
+	COLOR_BLUE   = "blue"
+	COLOR_PURPLE = "purple"
+	COLOR_GRAY   = "gray"
+)
+
+// IsValidColor reports whether an answer card can use the color. The empty
+// color is the neutral default.
+func IsValidColor(color string) bool {
+	switch color {
+	case "", COLOR_RED, COLOR_ORANGE, COLOR_YELLOW, COLOR_GREEN, COLOR_BLUE, COLOR_PURPLE, COLOR_GRAY:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	PHASE_BRAINSTORM = "brainstorm"
+	PHASE_VOTING     = "voting"
+	PHASE_DISCUSSION = "discussion"
+	PHASE_CLOSED     = "closed"
+)
+
+var ErrInvalidPhaseTransition = errors.New("invalid phase transition")
+
+type PhaseUpdateRequest struct {
+	Phase string `json:"phase"`
+}
+
+func IsValidPhase(phase string) bool {
+	switch phase {
+	case PHASE_BRAINSTORM, PHASE_VOTING, PHASE_DISCUSSION, PHASE_CLOSED:
+		return true
+	}
+	return false
+}
+
+func (p *PhaseUpdateRequest) Validate() error {
+	if !IsValidPhase(p.Phase) {
+		return fmt.Errorf("unknown phase %q", p.Phase)
+	}
+
+	return nil
+}
+
+// HidesAnswers tells whether the answers of a retrospective in the phase are
+// only shown to the session which wrote them, so participants brainstorm
+// without seeing each other's answers.
+func HidesAnswers(phase string) bool {
+	return phase == PHASE_BRAINSTORM
+}
+
+// ValidatePhaseTransition checks if a retrospective can move from one phase
+// to another. A closed retrospective can be reopened for discussion or voting,
+// but never sent back to brainstorm.
+func ValidatePhaseTransition(from, to string) error {
+	if !IsValidPhase(from) || !IsValidPhase(to) {
+		return fmt.Errorf("%w: unknown phase", ErrInvalidPhaseTransition)
+	}
+
+	if from == to {
+		return fmt.Errorf("%w: already in %s", ErrInvalidPhaseTransition, to)
+	}
+
+	if from == PHASE_CLOSED && to == PHASE_BRAINSTORM {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidPhaseTransition, from, to)
+	}
+
+	return nil
+}
@@ -0,0 +1,43 @@
+package types
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatePhaseTransition(t *testing.T) {
+	tests := []struct {
+		from  string
+		to    string
+		valid bool
+	}{
+		{PHASE_BRAINSTORM, PHASE_VOTING, true},
+		{PHASE_VOTING, PHASE_DISCUSSION, true},
+		{PHASE_DISCUSSION, PHASE_CLOSED, true},
+		{PHASE_VOTING, PHASE_BRAINSTORM, true},
+		{PHASE_CLOSED, PHASE_DISCUSSION, true},
+		{PHASE_CLOSED, PHASE_BRAINSTORM, false},
+		{PHASE_VOTING, PHASE_VOTING, false},
+		{PHASE_BRAINSTORM, "finished", false},
+		{"", PHASE_VOTING, false},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePhaseTransition(tt.from, tt.to)
+		if tt.valid {
+			assert.Nilf(t, err, "expected %s -> %s to be valid", tt.from, tt.to)
+			continue
+		}
+		assert.Truef(t, errors.Is(err, ErrInvalidPhaseTransition), "expected %s -> %s to be invalid", tt.from, tt.to)
+	}
+}
+
+func TestPhaseUpdateRequestValidate(t *testing.T) {
+	req := &PhaseUpdateRequest{Phase: PHASE_DISCUSSION}
+	assert.Nil(t, req.Validate())
+
+	req = &PhaseUpdateRequest{Phase: "Discussion"}
+	assert.NotNil(t, req.Validate())
+}
@@ -0,0 +1,27 @@
+package types
+
+// ErrorResponse is the body of every error answered by the API.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	// Only set for internal errors, to be reported when asking for help
+	RequestID string `json:"request_id,omitempty"`
+	// Only set in development
+	Detail string `json:"detail,omitempty"`
+	// Every rule broken by an invalid request
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// APIResponse is the body of successful answers that carry no object.
+type APIResponse struct {
+	Message string `json:"message"`
+}
+
+// IdempotentResponse is the response of a request sent with an
+// Idempotency-Key, answered again when the request is retried.
+type IdempotentResponse struct {
+	// Method and route template of the request
+	Route    string
+	Status   int
+	Location string
+	Body     []byte
+}
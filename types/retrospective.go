@@ -1,6 +1,7 @@
 package types
 
 import (
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,9 +11,95 @@ type Retrospective struct {
 	ID          uuid.UUID  `json:"id"`
 	Name        string     `json:"name"`
 	Description string     `json:"description"`
+	Phase       string     `json:"phase"`
+	Private     bool       `json:"private"`
 	Questions   []Question `json:"questions"`
 	CreatedAt   time.Time  `json:"created_at"`
 	ExpireAt    time.Time  `json:"expire_at"`
+	// Set once the retrospective is close enough to its deletion to warn
+	PendingDeletionAt *time.Time `json:"pending_deletion_at,omitempty"`
+}
+
+// RetrospectiveSummary is a lighter view of a retrospective that carries
+// only the number of answers of each question instead of the answers.
+type RetrospectiveSummary struct {
+	ID          uuid.UUID         `json:"id"`
+	Name        string            `json:"name"`
+	Description string            `json:"description"`
+	Phase       string            `json:"phase"`
+	Private     bool              `json:"private"`
+	Questions   []QuestionSummary `json:"questions"`
+	CreatedAt   time.Time         `json:"created_at"`
+	ExpireAt    time.Time         `json:"expire_at"`
+}
+
+type QuestionSummary struct {
+	ID          uuid.UUID `json:"id"`
+	Text        string    `json:"text"`
+	AnswerCount int       `json:"answer_count"`
+}
+
+// CopyName returns the name of a copy of a retrospective, shortening the
+// original so the result stays within the name limit.
+func CopyName(name string) string {
+	const suffix = " (copy)"
+
+	runes := []rune(name)
+	if limit := NAME_LIMIT - len(suffix); len(runes) > limit {
+		runes = runes[:limit]
+	}
+	return strings.TrimSpace(string(runes)) + suffix
+}
+
+// RetrospectiveVisit is a retrospective a session opened.
+type RetrospectiveVisit struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	LastVisited time.Time `json:"last_visited"`
+}
+
+// RetrospectiveStats sums up the content of a retrospective.
+type RetrospectiveStats struct {
+	ID                 uuid.UUID         `json:"id"`
+	QuestionCount      int               `json:"question_count"`
+	AnswerCount        int               `json:"answer_count"`
+	AnswersPerQuestion []QuestionSummary `json:"answers_per_question"`
+}
+
+// ContentCount is the number of rows currently stored, across every
+// retrospective.
+type ContentCount struct {
+	Retrospectives int
+	Questions      int
+	Answers        int
+}
+
+// RetrospectiveSearch narrows the retrospectives listed to operators to the
+// ones whose name contains Search, a page at a time. Pages start at 1.
+type RetrospectiveSearch struct {
+	Search string
+	Page   int
+	Size   int
+}
+
+// RetrospectiveListing is a retrospective as listed to operators.
+type RetrospectiveListing struct {
+	ID            uuid.UUID `json:"id"`
+	Name          string    `json:"name"`
+	CreatedAt     time.Time `json:"created_at"`
+	ExpireAt      time.Time `json:"expire_at"`
+	QuestionCount int       `json:"question_count"`
+	AnswerCount   int       `json:"answer_count"`
+}
+
+// RetrospectiveList is a page of the retrospectives matching a search, the
+// most recent first.
+type RetrospectiveList struct {
+	Retrospectives []RetrospectiveListing `json:"retrospectives"`
+	// Retrospectives matching the search across all pages
+	Total int `json:"total"`
+	Page  int `json:"page"`
+	Size  int `json:"size"`
 }
 
 type Question struct {
@@ -26,18 +113,96 @@ type Answer struct {
 	QuestionID uuid.UUID `json:"question_id"`
 	Text       string    `json:"text"`
 	Position   int       `json:"position"`
+	Version    int       `json:"version"`
+	Color      string    `json:"color"`
+	Mine       bool      `json:"mine"`
+}
+
+// AnswerContext is an answer along with its question and the other answers
+// of the same question, ordered by position.
+type AnswerContext struct {
+	Answer   Answer          `json:"answer"`
+	Question QuestionSummary `json:"question"`
+	Siblings []Answer        `json:"siblings"`
+}
+
+const (
+	ANSWERS_SORT_POSITION   = "position"
+	ANSWERS_SORT_CREATED_AT = "created_at"
+)
+
+// AnswersQuery narrows the questions and answers returned with a
+// retrospective. The zero value returns everything.
+type AnswersQuery struct {
+	QuestionID uuid.UUID
+	// Answers per question, 0 means no limit
+	Limit  int
+	Offset int
+	Sort   string
 }
 
 type RetrospectiveCreateRequest struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	// Only taken into account on creation
+	Private bool `json:"private"`
 }
 
 type QuestionCreateRequest struct {
 	Text string `json:"text"`
 }
 
+type QuestionsBulkCreateRequest struct {
+	Questions []QuestionCreateRequest `json:"questions"`
+}
+
 type AnswerCreateRequest struct {
 	QuestionID uuid.UUID `json:"question_id"`
 	Text       string    `json:"text"`
+	// One of the palette colors, empty for the neutral one. An empty color
+	// keeps the current one on update
+	Color string `json:"color,omitempty"`
+	// Version the client last saw, only used on update. When set, the
+	// update is rejected if the answer was modified since
+	Version int `json:"version,omitempty"`
+}
+
+// AnswersBulkCreateRequest creates one answer of the neutral color per text,
+// in order, at the end of the question.
+type AnswersBulkCreateRequest struct {
+	QuestionID uuid.UUID `json:"question_id"`
+	Texts      []string  `json:"texts"`
+}
+
+// RetrospectiveImportRequest is a retrospective as the API returns it, to be
+// recreated under new ids. Ids, versions and dates in it are ignored.
+type RetrospectiveImportRequest struct {
+	RetrospectiveCreateRequest
+	Questions []QuestionImport `json:"questions"`
+}
+
+type QuestionImport struct {
+	Text    string         `json:"text"`
+	Answers []AnswerImport `json:"answers"`
+}
+
+type AnswerImport struct {
+	Text  string `json:"text"`
+	Color string `json:"color,omitempty"`
+}
+
+// RetrospectiveExpiryRequest sets when a retrospective is deleted, either
+// at a given date or some days after its current expiry.
+type RetrospectiveExpiryRequest struct {
+	ExpireAt   *time.Time `json:"expire_at,omitempty"`
+	ExtendDays int        `json:"extend_days,omitempty"`
+}
+
+type AnswerMergeRequest struct {
+	SourceID uuid.UUID `json:"source_id"`
+	TargetID uuid.UUID `json:"target_id"`
+}
+
+type AnswersCleared struct {
+	Deleted int `json:"deleted"`
 }
@@ -0,0 +1,58 @@
+package types
+
+// Template is a set of questions a retrospective can be started from.
+type Template struct {
+	Name      string   `json:"name"`
+	Title     string   `json:"title"`
+	Questions []string `json:"questions"`
+}
+
+var templates = []Template{
+	{
+		Name:      "start-stop-continue",
+		Title:     "Start, Stop, Continue",
+		Questions: []string{"Start", "Stop", "Continue"},
+	},
+	{
+		Name:      "mad-sad-glad",
+		Title:     "Mad, Sad, Glad",
+		Questions: []string{"Mad", "Sad", "Glad"},
+	},
+	{
+		Name:      "4ls",
+		Title:     "4Ls",
+		Questions: []string{"Liked", "Learned", "Lacked", "Longed for"},
+	},
+}
+
+// GetTemplates returns the built-in templates.
+func GetTemplates() []Template {
+	return templates
+}
+
+// GetTemplate returns the built-in template with the given name.
+func GetTemplate(name string) (Template, bool) {
+	for _, template := range templates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return Template{}, false
+}
+
+type RetrospectiveFromTemplateRequest struct {
+	RetrospectiveCreateRequest
+	Template string `json:"template"`
+}
+
+// ValidateCreate returns a *ValidationError listing every broken rule.
+func (r *RetrospectiveFromTemplateRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	r.validateCreate(errs)
+
+	if _, ok := GetTemplate(r.Template); !ok {
+		errs.add("template", CODE_INVALID, 0, "unknown template %q", r.Template)
+	}
+
+	return errs.err()
+}
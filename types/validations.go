@@ -1,13 +1,31 @@
 package types
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
 
 const (
 	NAME_LIMIT   = 100
 	DESC_LIMIT   = 300
 	ANSWER_LIMIT = 600
+	BULK_LIMIT   = 20
+	// Days a retrospective can be extended by at once
+	EXTEND_DAYS_LIMIT = 365
+	// Retrospectives listed per page to operators
+	SEARCH_PAGE_SIZE  = 20
+	SEARCH_PAGE_LIMIT = 100
 )
 
+// ApiLimits are the maximum lengths accepted for each field, counted in
+// characters (runes) rather than bytes, and the maximum number of questions
+// and answers.
 type ApiLimits struct {
 	Retrospective limits `json:"retrospective,omitempty"`
 	Question      limits `json:"question,omitempty"`
@@ -18,6 +36,8 @@ type limits struct {
 	Name        int `json:"name,omitempty"`
 	Text        int `json:"text,omitempty"`
 	Description int `json:"description,omitempty"`
+	Questions   int `json:"questions,omitempty"`
+	Answers     int `json:"answers,omitempty"`
 }
 
 func GetApiLimits() *ApiLimits {
@@ -35,65 +55,334 @@ func GetApiLimits() *ApiLimits {
 	}
 }
 
-func (r *RetrospectiveCreateRequest) ValidateCreate() error {
-	if len(r.Name) == 0 {
-		return fmt.Errorf("retrospective name cannot be empty")
+// Codes of the FieldError rules.
+const (
+	CODE_REQUIRED = "required"
+	CODE_TOO_LONG = "too_long"
+	CODE_TOO_MANY = "too_many"
+	CODE_INVALID  = "invalid"
+)
+
+// FieldError is a rule broken by a field of a request.
+type FieldError struct {
+	// Empty when the rule covers the whole request
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Limit   int    `json:"limit,omitempty"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every rule a request breaks, so clients can show
+// them all at once.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldErr := range e.Errors {
+		messages = append(messages, fieldErr.Message)
+	}
+	return strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, code string, limit int, format string, args ...interface{}) {
+	e.Errors = append(e.Errors, FieldError{
+		Field:   field,
+		Code:    code,
+		Limit:   limit,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// nest adds the rules broken by an element of a list, prefixing their field
+// with the element's and their message with its name.
+func (e *ValidationError) nest(field, name string, err error) {
+	nested, _ := err.(*ValidationError)
+	if nested == nil {
+		return
+	}
+	for _, fieldErr := range nested.Errors {
+		fieldErr.Field = field + "." + fieldErr.Field
+		fieldErr.Message = name + ": " + fieldErr.Message
+		e.Errors = append(e.Errors, fieldErr)
+	}
+}
+
+// err returns e when a rule was broken, nil otherwise.
+func (e *ValidationError) err() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// normalize trims surrounding whitespace and rejects invalid UTF-8 and control
+// characters. Line breaks and tabs are kept when multiline is set.
+func normalize(errs *ValidationError, field, name, value string, multiline bool) string {
+	if !utf8.ValidString(value) {
+		errs.add(field, CODE_INVALID, 0, "%s must be valid UTF-8", name)
+		return value
+	}
+
+	value = strings.TrimSpace(value)
+	for _, r := range value {
+		if multiline && (r == '\n' || r == '\r' || r == '\t') {
+			continue
+		}
+		if unicode.IsControl(r) {
+			errs.add(field, CODE_INVALID, 0, "%s cannot contain control characters", name)
+			break
+		}
 	}
+	return value
+}
+
+func (r *RetrospectiveCreateRequest) normalize(errs *ValidationError) {
+	r.Name = normalize(errs, "name", "retrospective name", r.Name, false)
+	r.Description = normalize(errs, "description", "retrospective description", r.Description, true)
+}
 
+// validateLengths checks the limits shared by create and update.
+func (r *RetrospectiveCreateRequest) validateLengths(errs *ValidationError) {
 	retroLimits := GetApiLimits().Retrospective
 
-	if len(r.Name) > retroLimits.Name {
-		return fmt.Errorf("retrospective name too big. Limit is %d", retroLimits.Name)
+	if utf8.RuneCountInString(r.Name) > retroLimits.Name {
+		errs.add("name", CODE_TOO_LONG, retroLimits.Name, "retrospective name too big. Limit is %d", retroLimits.Name)
 	}
 
-	if len(r.Description) > retroLimits.Description {
-		return fmt.Errorf("retrospective description too big. Limit is %d", retroLimits.Description)
+	if utf8.RuneCountInString(r.Description) > retroLimits.Description {
+		errs.add("description", CODE_TOO_LONG, retroLimits.Description, "retrospective description too big. Limit is %d", retroLimits.Description)
 	}
+}
 
-	return nil
+func (r *RetrospectiveCreateRequest) validateCreate(errs *ValidationError) {
+	r.normalize(errs)
+
+	if len(r.Name) == 0 {
+		errs.add("name", CODE_REQUIRED, 0, "retrospective name cannot be empty")
+	}
+
+	r.validateLengths(errs)
+}
+
+// ValidateCreate returns a *ValidationError listing every broken rule.
+func (r *RetrospectiveCreateRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	r.validateCreate(errs)
+	return errs.err()
 }
 
+// ValidateUpdate returns a *ValidationError listing every broken rule.
 func (r *RetrospectiveCreateRequest) ValidateUpdate() error {
+	errs := &ValidationError{}
+	r.normalize(errs)
+
 	if len(r.Name) == 0 && len(r.Description) == 0 {
-		return fmt.Errorf("nothing to do")
+		errs.add("", CODE_REQUIRED, 0, "nothing to do")
 	}
 
-	retroLimits := GetApiLimits().Retrospective
+	r.validateLengths(errs)
+	return errs.err()
+}
+
+// ValidateCreate returns a *ValidationError listing every broken rule.
+func (r *QuestionCreateRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	r.Text = normalize(errs, "text", "question text", r.Text, true)
+
+	if len(r.Text) == 0 {
+		errs.add("text", CODE_REQUIRED, 0, "question text cannot be empty")
+	}
+
+	questionLimits := GetApiLimits().Question
+
+	if utf8.RuneCountInString(r.Text) > questionLimits.Text {
+		errs.add("text", CODE_TOO_LONG, questionLimits.Text, "question too big. Limit is %d", questionLimits.Text)
+	}
+
+	return errs.err()
+}
+
+// ValidateCreate validates every question, a single invalid one rejects the
+// whole batch. The fields of the questions are named after their index.
+func (r *QuestionsBulkCreateRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	if len(r.Questions) == 0 {
+		errs.add("questions", CODE_REQUIRED, 0, "questions cannot be empty")
+	}
+
+	if len(r.Questions) > BULK_LIMIT {
+		errs.add("questions", CODE_TOO_MANY, BULK_LIMIT, "too many questions. Limit is %d", BULK_LIMIT)
+		return errs
+	}
 
-	if len(r.Name) > retroLimits.Name {
-		return fmt.Errorf("retrospective name too big. Limit is %d", retroLimits.Description)
+	for i := range r.Questions {
+		errs.nest(fmt.Sprintf("questions[%d]", i), fmt.Sprintf("question %d", i+1), r.Questions[i].ValidateCreate())
 	}
 
-	if len(r.Description) > retroLimits.Description {
-		return fmt.Errorf("retrospective description too big. Limit is %d", DESC_LIMIT)
+	return errs.err()
+}
+
+// validateAnswerContent checks the text and color shared by created and
+// imported answers, and returns them normalized.
+func validateAnswerContent(errs *ValidationError, text, color string) (string, string) {
+	text = normalize(errs, "text", "answer text", text, true)
+
+	if len(text) == 0 {
+		errs.add("text", CODE_REQUIRED, 0, "answer text cannot be empty")
+	}
+
+	answerLimits := GetApiLimits().Answer
+	if utf8.RuneCountInString(text) > answerLimits.Text {
+		errs.add("text", CODE_TOO_LONG, answerLimits.Text, "answer text too big. Limit is %d", answerLimits.Text)
+	}
+
+	color = strings.TrimSpace(color)
+	if !IsValidColor(color) {
+		errs.add("color", CODE_INVALID, 0, "invalid answer color %q", color)
+	}
+
+	return text, color
+}
+
+// ValidateCreate returns a *ValidationError listing every broken rule.
+func (a *AnswerCreateRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	a.Text, a.Color = validateAnswerContent(errs, a.Text, a.Color)
+
+	if a.QuestionID == uuid.Nil {
+		errs.add("question_id", CODE_REQUIRED, 0, "question id cannot be empty")
+	}
+
+	return errs.err()
+}
+
+// ValidateCreate validates every text, a single invalid one rejects the whole
+// batch. The texts are named after their index.
+func (r *AnswersBulkCreateRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	if r.QuestionID == uuid.Nil {
+		errs.add("question_id", CODE_REQUIRED, 0, "question id cannot be empty")
+	}
+
+	if len(r.Texts) == 0 {
+		errs.add("texts", CODE_REQUIRED, 0, "texts cannot be empty")
+	}
+
+	if len(r.Texts) > BULK_LIMIT {
+		errs.add("texts", CODE_TOO_MANY, BULK_LIMIT, "too many answers. Limit is %d", BULK_LIMIT)
+		return errs
+	}
+
+	for i := range r.Texts {
+		textErrs := &ValidationError{}
+		r.Texts[i], _ = validateAnswerContent(textErrs, r.Texts[i], "")
+		for _, fieldErr := range textErrs.Errors {
+			fieldErr.Field = fmt.Sprintf("texts[%d]", i)
+			fieldErr.Message = fmt.Sprintf("answer %d: %s", i+1, fieldErr.Message)
+			errs.Errors = append(errs.Errors, fieldErr)
+		}
+	}
+
+	return errs.err()
+}
+
+// ValidateCreate returns a *ValidationError listing every broken rule. The
+// fields of questions and answers are named after their index.
+func (r *RetrospectiveImportRequest) ValidateCreate() error {
+	errs := &ValidationError{}
+	r.validateCreate(errs)
+
+	for i := range r.Questions {
+		question := QuestionCreateRequest{Text: r.Questions[i].Text}
+		errs.nest(fmt.Sprintf("questions[%d]", i), fmt.Sprintf("question %d", i+1), question.ValidateCreate())
+		r.Questions[i].Text = question.Text
+
+		for j := range r.Questions[i].Answers {
+			answer := &r.Questions[i].Answers[j]
+			answerErrs := &ValidationError{}
+			answer.Text, answer.Color = validateAnswerContent(answerErrs, answer.Text, answer.Color)
+			errs.nest(fmt.Sprintf("questions[%d].answers[%d]", i, j), fmt.Sprintf("question %d answer %d", i+1, j+1), answerErrs.err())
+		}
+	}
+
+	return errs.err()
+}
+
+func (q *AnswersQuery) Validate() error {
+	if q.Limit < 0 {
+		return fmt.Errorf("answers limit cannot be negative")
+	}
+
+	if q.Offset < 0 {
+		return fmt.Errorf("answers offset cannot be negative")
+	}
+
+	switch q.Sort {
+	case "", ANSWERS_SORT_POSITION, ANSWERS_SORT_CREATED_AT:
+		return nil
+	default:
+		return fmt.Errorf("invalid answers sort %q. Use %s or %s", q.Sort, ANSWERS_SORT_POSITION, ANSWERS_SORT_CREATED_AT)
+	}
+}
+
+// Validate checks the page, its size and the length of the search.
+func (q *RetrospectiveSearch) Validate() error {
+	if utf8.RuneCountInString(q.Search) > NAME_LIMIT {
+		return fmt.Errorf("search too big. Limit is %d", NAME_LIMIT)
+	}
+
+	if q.Size < 1 || q.Size > SEARCH_PAGE_LIMIT {
+		return fmt.Errorf("size must be between 1 and %d", SEARCH_PAGE_LIMIT)
+	}
+
+	// The offset of the page must not overflow
+	if q.Page < 1 || q.Page > math.MaxInt32/q.Size {
+		return fmt.Errorf("page must be between 1 and %d", math.MaxInt32/q.Size)
 	}
 
 	return nil
 }
 
-func (r *QuestionCreateRequest) ValidateCreate() error {
-	if len(r.Text) == 0 {
-		return fmt.Errorf("question text cannot be empty")
+// Validate checks that exactly one of the expiry and the extension is set,
+// and that the expiry is after now.
+func (r *RetrospectiveExpiryRequest) Validate(now time.Time) error {
+	if (r.ExpireAt == nil) == (r.ExtendDays == 0) {
+		return fmt.Errorf("either expire_at or extend_days must be set")
 	}
 
-	questionLimits := GetApiLimits().Question
+	if r.ExpireAt != nil && !r.ExpireAt.After(now) {
+		return fmt.Errorf("expire_at must be in the future")
+	}
 
-	if len(r.Text) > questionLimits.Text {
-		return fmt.Errorf("question too big. Limit is %d", questionLimits.Text)
+	if r.ExtendDays < 0 || r.ExtendDays > EXTEND_DAYS_LIMIT {
+		return fmt.Errorf("extend_days must be between 1 and %d", EXTEND_DAYS_LIMIT)
 	}
 
 	return nil
 }
 
-func (a *AnswerCreateRequest) ValidateCreate() error {
-	answerLimits := GetApiLimits().Answer
-	if len(a.Text) > answerLimits.Text {
-		return fmt.Errorf("answer text too big. Limit is %d", answerLimits.Text)
+func (m *AnswerMergeRequest) Validate() error {
+	if m.SourceID == uuid.Nil || m.TargetID == uuid.Nil {
+		return fmt.Errorf("source and target ids cannot be empty")
 	}
 
-	if len(a.QuestionID.String()) == 0 {
-		return fmt.Errorf("question id cannot be empty")
+	if m.SourceID == m.TargetID {
+		return fmt.Errorf("cannot merge an answer into itself")
 	}
 
 	return nil
 }
+
+var ErrMergeTooBig = fmt.Errorf("merged answer text too big. Limit is %d", ANSWER_LIMIT)
+
+// MergeAnswerText appends the text of a merged answer to its target's,
+// failing when the result goes over the answer limit.
+func MergeAnswerText(target, source string) (string, error) {
+	text := target + "\n" + source
+	if utf8.RuneCountInString(text) > ANSWER_LIMIT {
+		return "", ErrMergeTooBig
+	}
+	return text, nil
+}
@@ -0,0 +1,215 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetrospectiveValidateCreateNormalization(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       RetrospectiveCreateRequest
+		expected    RetrospectiveCreateRequest
+		expectedErr string
+	}{
+		{
+			name:     "surrounding whitespace is trimmed",
+			input:    RetrospectiveCreateRequest{Name: "  Sprint 42\t", Description: " review \n"},
+			expected: RetrospectiveCreateRequest{Name: "Sprint 42", Description: "review"},
+		},
+		{
+			name:        "whitespace only name",
+			input:       RetrospectiveCreateRequest{Name: "   \t "},
+			expectedErr: "retrospective name cannot be empty",
+		},
+		{
+			name:        "embedded newline in name",
+			input:       RetrospectiveCreateRequest{Name: "Sprint\n42"},
+			expectedErr: "retrospective name cannot contain control characters",
+		},
+		{
+			name:        "null byte in name",
+			input:       RetrospectiveCreateRequest{Name: "Sprint\x0042"},
+			expectedErr: "retrospective name cannot contain control characters",
+		},
+		{
+			name:        "invalid UTF-8 in name",
+			input:       RetrospectiveCreateRequest{Name: "Sprint \xff42"},
+			expectedErr: "retrospective name must be valid UTF-8",
+		},
+		{
+			name:        "invalid UTF-8 in description",
+			input:       RetrospectiveCreateRequest{Name: "Sprint 42", Description: "review \xc3\x28"},
+			expectedErr: "retrospective description must be valid UTF-8",
+		},
+		{
+			name:     "embedded newline in description",
+			input:    RetrospectiveCreateRequest{Name: "Sprint 42", Description: "first line\nsecond line"},
+			expected: RetrospectiveCreateRequest{Name: "Sprint 42", Description: "first line\nsecond line"},
+		},
+		{
+			name:     "unicode content",
+			input:    RetrospectiveCreateRequest{Name: "Retrô 🚀 振り返り", Description: "Ação e reação"},
+			expected: RetrospectiveCreateRequest{Name: "Retrô 🚀 振り返り", Description: "Ação e reação"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.input.ValidateCreate()
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, tt.input)
+		})
+	}
+}
+
+func TestRetrospectiveValidateUpdateNormalization(t *testing.T) {
+	req := RetrospectiveCreateRequest{Name: "  ", Description: " \n "}
+	assert.EqualError(t, req.ValidateUpdate(), "nothing to do")
+
+	req = RetrospectiveCreateRequest{Name: "New\tname"}
+	assert.EqualError(t, req.ValidateUpdate(), "retrospective name cannot contain control characters")
+
+	req = RetrospectiveCreateRequest{Name: " New name "}
+	assert.Nil(t, req.ValidateUpdate())
+	assert.Equal(t, "New name", req.Name)
+}
+
+func TestQuestionValidateCreateNormalization(t *testing.T) {
+	req := QuestionCreateRequest{Text: " \t\n "}
+	assert.EqualError(t, req.ValidateCreate(), "question text cannot be empty")
+
+	req = QuestionCreateRequest{Text: "What\x07 went well?"}
+	assert.EqualError(t, req.ValidateCreate(), "question text cannot contain control characters")
+
+	req = QuestionCreateRequest{Text: "What went \xe2\x82 well?"}
+	assert.EqualError(t, req.ValidateCreate(), "question text must be valid UTF-8")
+
+	req = QuestionCreateRequest{Text: " What went well?\nAnd why? "}
+	assert.Nil(t, req.ValidateCreate())
+	assert.Equal(t, "What went well?\nAnd why?", req.Text)
+}
+
+func TestAnswerValidateCreateNormalization(t *testing.T) {
+	req := AnswerCreateRequest{QuestionID: uuid.New(), Text: "Deploys\x00 were slow"}
+	assert.EqualError(t, req.ValidateCreate(), "answer text cannot contain control characters")
+
+	req = AnswerCreateRequest{QuestionID: uuid.New(), Text: "Deploys \xfe were slow"}
+	assert.EqualError(t, req.ValidateCreate(), "answer text must be valid UTF-8")
+
+	req = AnswerCreateRequest{QuestionID: uuid.New(), Text: "Déploiements lents 🐢\tà corriger"}
+	assert.Nil(t, req.ValidateCreate())
+
+	req = AnswerCreateRequest{QuestionID: uuid.New(), Text: "  Deploys were slow\n- twice  "}
+	assert.Nil(t, req.ValidateCreate())
+	assert.Equal(t, "Deploys were slow\n- twice", req.Text)
+}
+
+func TestAnswerValidateCreateRequiredFields(t *testing.T) {
+	req := AnswerCreateRequest{QuestionID: uuid.Nil, Text: "Deploys were slow"}
+	assert.EqualError(t, req.ValidateCreate(), "question id cannot be empty")
+
+	req = AnswerCreateRequest{QuestionID: uuid.New(), Text: ""}
+	assert.EqualError(t, req.ValidateCreate(), "answer text cannot be empty")
+
+	req = AnswerCreateRequest{QuestionID: uuid.New(), Text: " \n\t "}
+	assert.EqualError(t, req.ValidateCreate(), "answer text cannot be empty")
+}
+
+func TestAnswerValidateCreateColor(t *testing.T) {
+	for _, color := range []string{"", COLOR_RED, COLOR_BLUE} {
+		req := AnswerCreateRequest{QuestionID: uuid.New(), Text: "Deploys were slow", Color: color}
+		assert.Nil(t, req.ValidateCreate(), color)
+	}
+
+	req := AnswerCreateRequest{QuestionID: uuid.New(), Text: "Deploys were slow", Color: " green "}
+	assert.Nil(t, req.ValidateCreate())
+	assert.Equal(t, COLOR_GREEN, req.Color)
+
+	for _, color := range []string{"magenta", "#ff0000", "Red"} {
+		req := AnswerCreateRequest{QuestionID: uuid.New(), Text: "Deploys were slow", Color: color}
+		assert.EqualError(t, req.ValidateCreate(), fmt.Sprintf("invalid answer color %q", color))
+	}
+}
+
+func TestLimitsCountCharacters(t *testing.T) {
+	// Each of these runes takes several bytes, so the strings are at the limit
+	// in characters but well over it in bytes.
+	name := strings.Repeat("🚀", NAME_LIMIT)
+	description := strings.Repeat("振", DESC_LIMIT)
+	answer := strings.Repeat("ã", ANSWER_LIMIT)
+
+	retro := RetrospectiveCreateRequest{Name: name, Description: description}
+	assert.Greater(t, len(retro.Name), NAME_LIMIT)
+	assert.Nil(t, retro.ValidateCreate())
+	assert.Nil(t, retro.ValidateUpdate())
+
+	question := QuestionCreateRequest{Text: description}
+	assert.Nil(t, question.ValidateCreate())
+
+	answerReq := AnswerCreateRequest{QuestionID: uuid.New(), Text: answer}
+	assert.Nil(t, answerReq.ValidateCreate())
+
+	retro = RetrospectiveCreateRequest{Name: name + "🚀"}
+	assert.EqualError(t, retro.ValidateCreate(), "retrospective name too big. Limit is 100")
+
+	answerReq = AnswerCreateRequest{QuestionID: uuid.New(), Text: answer + "ã"}
+	assert.EqualError(t, answerReq.ValidateCreate(), "answer text too big. Limit is 600")
+}
+
+func TestRetrospectiveValidateUpdateLimits(t *testing.T) {
+	req := RetrospectiveCreateRequest{Name: strings.Repeat("a", NAME_LIMIT+1)}
+	assert.EqualError(t, req.ValidateUpdate(), "retrospective name too big. Limit is 100")
+
+	req = RetrospectiveCreateRequest{Description: strings.Repeat("a", DESC_LIMIT+1)}
+	assert.EqualError(t, req.ValidateUpdate(), "retrospective description too big. Limit is 300")
+
+	// Update and create must report the same errors
+	create := RetrospectiveCreateRequest{Name: strings.Repeat("a", NAME_LIMIT+1)}
+	update := create
+	assert.Equal(t, create.ValidateCreate(), update.ValidateUpdate())
+}
+
+func TestValidateCreateListsEveryViolation(t *testing.T) {
+	req := RetrospectiveCreateRequest{
+		Name:        strings.Repeat("n", NAME_LIMIT+1),
+		Description: strings.Repeat("d", DESC_LIMIT+1),
+	}
+
+	err := req.ValidateCreate()
+	var validationErr *ValidationError
+	if assert.ErrorAs(t, err, &validationErr) {
+		assert.Equal(t, []FieldError{
+			{Field: "name", Code: CODE_TOO_LONG, Limit: NAME_LIMIT, Message: "retrospective name too big. Limit is 100"},
+			{Field: "description", Code: CODE_TOO_LONG, Limit: DESC_LIMIT, Message: "retrospective description too big. Limit is 300"},
+		}, validationErr.Errors)
+	}
+	assert.EqualError(t, err, "retrospective name too big. Limit is 100; retrospective description too big. Limit is 300")
+
+	answer := AnswerCreateRequest{Text: " ", Color: "magenta"}
+	err = answer.ValidateCreate()
+	if assert.ErrorAs(t, err, &validationErr) {
+		fields := []string{}
+		for _, fieldErr := range validationErr.Errors {
+			fields = append(fields, fieldErr.Field)
+		}
+		assert.Equal(t, []string{"text", "color", "question_id"}, fields)
+	}
+}
+
+func TestCopyName(t *testing.T) {
+	assert.Equal(t, "Sprint 42 (copy)", CopyName("Sprint 42"))
+
+	copied := CopyName(strings.Repeat("é", NAME_LIMIT))
+	assert.Equal(t, NAME_LIMIT, utf8.RuneCountInString(copied), "the copy should fit the name limit")
+	assert.True(t, strings.HasSuffix(copied, " (copy)"))
+}
@@ -1,13 +1,64 @@
 package types
 
-import "github.com/google/uuid"
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
 
 type Object struct {
 	ID uuid.UUID `json:"id,omitempty"`
 }
 
+type PendingDeletion struct {
+	ID                uuid.UUID `json:"id"`
+	PendingDeletionAt time.Time `json:"pending_deletion_at"`
+}
+
+// RetrospectiveUpdate is broadcast, as a partial message, when the name or
+// description of a retrospective change. It carries no questions, clients
+// keep the ones they hold.
+type RetrospectiveUpdate struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+}
+
+type PhaseChange struct {
+	ID    uuid.UUID `json:"id"`
+	Phase string    `json:"phase"`
+}
+
+// AnswerMerge is broadcast when an answer is merged into another one.
+type AnswerMerge struct {
+	SourceID uuid.UUID `json:"source_id"`
+	Answer   Answer    `json:"answer"`
+}
+
+// RetrospectiveClear is broadcast when every answer of a retrospective is deleted.
+type RetrospectiveClear struct {
+	ID uuid.UUID `json:"id"`
+	// Answers lists the deleted answers, for the clients told about each
+	// deletion
+	Answers []Answer `json:"answers"`
+}
+
+// Typing tells the other subscribers someone is editing an answer.
+type Typing struct {
+	AnswerID uuid.UUID `json:"answer_id"`
+}
+
 type WebSocketMessage struct {
+	// Seq orders the logged messages of a retrospective, clients reconnect
+	// with the last one they got to receive what they missed
+	Seq    int64       `json:"seq,omitempty"`
 	Action string      `json:"action,omitempty"`
 	Type   string      `json:"type,omitempty"`
 	Value  interface{} `json:"value,omitempty"`
+	// Partial values only carry the fields that changed, clients merge them
+	// into their state instead of replacing it
+	Partial bool `json:"partial,omitempty"`
+	// Author restricts the message to the subscribers of that session when
+	// set, for the answers hidden during brainstorm
+	Author string `json:"-"`
 }